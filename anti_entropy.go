@@ -0,0 +1,47 @@
+package percounter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+)
+
+// StateDigest maps CRDT type tags to replica names to hashes of the replica state,
+// allowing peers to find out which replicas differ without exchanging them
+type StateDigest map[string]map[string]string
+
+func (d StateDigest) Set(typeTag, name, hash string) {
+	if _, ok := d[typeTag]; !ok {
+		d[typeTag] = map[string]string{}
+	}
+	d[typeTag][name] = hash
+}
+
+func (d StateDigest) Get(typeTag, name string) (string, bool) {
+	hash, ok := d[typeTag][name]
+	return hash, ok
+}
+
+// staleIn are the replicas of this digest missing or different in the other one
+func (d StateDigest) staleIn(other StateDigest) []replicaKey {
+	res := []replicaKey{}
+	for _, typeTag := range slices.Sorted(maps.Keys(d)) {
+		for _, name := range slices.Sorted(maps.Keys(d[typeTag])) {
+			hash, ok := other.Get(typeTag, name)
+			if !ok || hash != d[typeTag][name] {
+				res = append(res, replicaKey{typeTag, name})
+			}
+		}
+	}
+	return res
+}
+
+func digestOf(c CRDT) (string, error) {
+	data, err := c.Marshal()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
@@ -0,0 +1,55 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateDigest(t *testing.T) {
+	t.Run("equal states have equal digests", func(t *testing.T) {
+		a := NewGCounter("a")
+		a.Increment()
+		b := NewGCounter("b")
+		b.MergeWith(a)
+
+		digestA, err := digestOf(&gcounterCRDT{a})
+		require.NoError(t, err)
+		digestB, err := digestOf(&gcounterCRDT{b})
+		require.NoError(t, err)
+		assert.Equal(t, digestA, digestB)
+
+		b.Increment()
+		digestB, err = digestOf(&gcounterCRDT{b})
+		require.NoError(t, err)
+		assert.NotEqual(t, digestA, digestB)
+	})
+
+	t.Run("stale replicas", func(t *testing.T) {
+		local := StateDigest{}
+		local.Set(GCounterNetworkMessage, "b", "2")
+		local.Set(GCounterNetworkMessage, "a", "1")
+		local.Set(GSetNetworkMessage, "a", "3")
+		remote := StateDigest{}
+		remote.Set(GCounterNetworkMessage, "a", "1")
+		remote.Set(GSetNetworkMessage, "a", "4")
+		remote.Set(ORSetNetworkMessage, "c", "5")
+
+		assert.Equal(t, []replicaKey{
+			{GCounterNetworkMessage, "b"},
+			{GSetNetworkMessage, "a"},
+		}, local.staleIn(remote))
+		assert.Equal(t, []replicaKey{
+			{GSetNetworkMessage, "a"},
+			{ORSetNetworkMessage, "c"},
+		}, remote.staleIn(local))
+		assert.Empty(t, local.staleIn(local))
+
+		hash, ok := remote.Get(ORSetNetworkMessage, "c")
+		assert.True(t, ok)
+		assert.Equal(t, "5", hash)
+		_, ok = remote.Get(ORSetNetworkMessage, "d")
+		assert.False(t, ok)
+	})
+}
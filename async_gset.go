@@ -0,0 +1,66 @@
+package percounter
+
+import (
+	"github.com/Arceliar/phony"
+)
+
+type AsyncGSet struct {
+	phony.Inbox
+	inner *GSet
+	sink  GSetStateSink
+}
+
+func NewAsyncGSet() *AsyncGSet {
+	return NewAsyncGSetWithSink(&noOpSetState{})
+}
+
+func NewAsyncGSetWithSink(sink GSetStateSink) *AsyncGSet {
+	return &AsyncGSet{
+		inner: NewGSet(),
+		sink:  sink,
+	}
+}
+
+func NewAsyncGSetWithSinkFromState(state GSetState, sink GSetStateSink) *AsyncGSet {
+	return &AsyncGSet{
+		inner: NewGSetFromState(state),
+		sink:  sink,
+	}
+}
+
+func (s *AsyncGSet) Add(element string) {
+	s.Act(s, func() {
+		s.inner.Add(element)
+		s.sink.SetGSetState(s.inner.GetState().Copy())
+	})
+}
+
+func (s *AsyncGSet) Contains(element string) bool {
+	var res bool
+	phony.Block(s, func() {
+		res = s.inner.Contains(element)
+	})
+	return res
+}
+
+func (s *AsyncGSet) Elements() []string {
+	var res []string
+	phony.Block(s, func() {
+		res = s.inner.Elements()
+	})
+	return res
+}
+
+func (s *AsyncGSet) GetState() GSetState {
+	var res GSetState
+	phony.Block(s, func() {
+		res = s.inner.GetState().Copy()
+	})
+	return res
+}
+
+func (s *AsyncGSet) MergeWith(other GSetStateSource) {
+	s.Act(s, func() {
+		s.inner.MergeWith(other)
+	})
+}
@@ -0,0 +1,30 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncGSet(t *testing.T) {
+	t.Run("merging with another set", func(t *testing.T) {
+		s := NewAsyncGSet()
+		s.Add("a")
+		s2 := NewAsyncGSet()
+		s2.Add("b")
+		s.MergeWith(s2)
+		assert.Equal(t, []string{"a", "b"}, s.Elements())
+		assert.True(t, s.Contains("b"))
+	})
+
+	t.Run("eventual consistency in-process", func(t *testing.T) {
+		s := NewAsyncGSet()
+		const goroutineCount = 32
+		for i := 0; i < goroutineCount; i++ {
+			go func() {
+				s.Add(string(rune('a' + i)))
+			}()
+		}
+		waitForSetLenOf(t, goroutineCount, s.Elements)
+	})
+}
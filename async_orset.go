@@ -0,0 +1,73 @@
+package percounter
+
+import (
+	"github.com/Arceliar/phony"
+)
+
+type AsyncORSet struct {
+	phony.Inbox
+	inner *ORSet
+	sink  ORSetStateSink
+}
+
+func NewAsyncORSet(identity string) *AsyncORSet {
+	return NewAsyncORSetWithSink(identity, &noOpSetState{})
+}
+
+func NewAsyncORSetWithSink(identity string, sink ORSetStateSink) *AsyncORSet {
+	return &AsyncORSet{
+		inner: NewORSet(identity),
+		sink:  sink,
+	}
+}
+
+func NewAsyncORSetWithSinkFromState(identity string, state ORSetState, sink ORSetStateSink) *AsyncORSet {
+	return &AsyncORSet{
+		inner: NewORSetFromState(identity, state),
+		sink:  sink,
+	}
+}
+
+func (s *AsyncORSet) Add(element string) {
+	s.Act(s, func() {
+		s.inner.Add(element)
+		s.sink.SetORSetState(s.inner.GetState().Copy())
+	})
+}
+
+func (s *AsyncORSet) Remove(element string) {
+	s.Act(s, func() {
+		s.inner.Remove(element)
+		s.sink.SetORSetState(s.inner.GetState().Copy())
+	})
+}
+
+func (s *AsyncORSet) Contains(element string) bool {
+	var res bool
+	phony.Block(s, func() {
+		res = s.inner.Contains(element)
+	})
+	return res
+}
+
+func (s *AsyncORSet) Elements() []string {
+	var res []string
+	phony.Block(s, func() {
+		res = s.inner.Elements()
+	})
+	return res
+}
+
+func (s *AsyncORSet) GetState() ORSetState {
+	var res ORSetState
+	phony.Block(s, func() {
+		res = s.inner.GetState().Copy()
+	})
+	return res
+}
+
+func (s *AsyncORSet) MergeWith(other ORSetStateSource) {
+	s.Act(s, func() {
+		s.inner.MergeWith(other)
+	})
+}
@@ -0,0 +1,23 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncORSet(t *testing.T) {
+	t.Run("adding, removing and merging", func(t *testing.T) {
+		s := NewAsyncORSet("1")
+		s.Add("a")
+		s.Add("b")
+		s.Remove("a")
+		assert.Equal(t, []string{"b"}, s.Elements())
+
+		s2 := NewAsyncORSet("2")
+		s2.Add("c")
+		s.MergeWith(s2)
+		assert.Equal(t, []string{"b", "c"}, s.Elements())
+		assert.False(t, s.Contains("a"))
+	})
+}
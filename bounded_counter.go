@@ -0,0 +1,175 @@
+package percounter
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+)
+
+var ErrBoundedCounterExhausted = errors.New("bounded counter: local share exhausted")
+var ErrBoundedCounterUninitialized = errors.New("bounded counter: bound not initialized")
+var ErrBoundedCounterExceeded = errors.New("bounded counter: bound exceeded")
+
+// BoundedCounterState is an escrow-style bounded counter:
+// the owner initially holds the rights to all Bound increments,
+// rights are spent by incrementing and can be transferred between peers
+type BoundedCounterState struct {
+	Name      string                      `json:"name"`
+	Bound     int64                       `json:"bound"`
+	Owner     string                      `json:"owner"`
+	Used      GCounterState               `json:"used"`
+	Transfers map[string]map[string]int64 `json:"transfers"`
+}
+
+func NewNamedBoundedCounterState(name string) BoundedCounterState {
+	return BoundedCounterState{
+		Name:      name,
+		Used:      NewNamedGcounterState(name),
+		Transfers: make(map[string]map[string]int64),
+	}
+}
+
+func (s BoundedCounterState) Copy() BoundedCounterState {
+	transfers := make(map[string]map[string]int64, len(s.Transfers))
+	for from, to := range s.Transfers {
+		transfers[from] = maps.Clone(to)
+	}
+	return BoundedCounterState{
+		Name:      s.Name,
+		Bound:     s.Bound,
+		Owner:     s.Owner,
+		Used:      s.Used.Copy(),
+		Transfers: transfers,
+	}
+}
+
+func (s BoundedCounterState) GetState() BoundedCounterState {
+	return s
+}
+
+type BoundedCounter struct {
+	identity string
+	state    BoundedCounterState
+	used     *GCounter
+}
+
+func NewBoundedCounter(identity string) *BoundedCounter {
+	return NewBoundedCounterFromState(identity, NewNamedBoundedCounterState("singleton"))
+}
+
+func NewBoundedCounterFromState(identity string, state BoundedCounterState) *BoundedCounter {
+	if state.Used.Peers == nil {
+		state.Used.Peers = make(map[string]int64)
+	}
+	if state.Transfers == nil {
+		state.Transfers = make(map[string]map[string]int64)
+	}
+	return &BoundedCounter{
+		identity: identity,
+		state:    state,
+		used:     NewGCounterFromState(identity, state.Used),
+	}
+}
+
+// Init makes this peer the owner of all rights. It should be called on one peer only:
+// concurrent initializations are resolved in favor of the lowest owner identity,
+// but the increments already spent under the rights of another owner are kept, see Exceeded
+func (c *BoundedCounter) Init(bound int64) {
+	if c.IsInitialized() {
+		return
+	}
+	c.state.Bound = bound
+	c.state.Owner = c.identity
+}
+
+func (c *BoundedCounter) IsInitialized() bool {
+	return c.state.Owner != ""
+}
+
+func (c *BoundedCounter) Bound() int64 {
+	return c.state.Bound
+}
+
+func (c *BoundedCounter) Value() int64 {
+	return c.used.Value()
+}
+
+// Exceeded tells whether the increments exceed the bound, only possible after concurrent initializations
+func (c *BoundedCounter) Exceeded() bool {
+	return c.IsInitialized() && c.Value() > c.state.Bound
+}
+
+func (c *BoundedCounter) TryIncrement() error {
+	if !c.IsInitialized() {
+		return ErrBoundedCounterUninitialized
+	}
+	if c.Exceeded() {
+		return ErrBoundedCounterExceeded
+	}
+	if c.LocalRights() < 1 {
+		return ErrBoundedCounterExhausted
+	}
+	c.used.Increment()
+	return nil
+}
+
+func (c *BoundedCounter) LocalRights() int64 {
+	return c.RightsOf(c.identity)
+}
+
+func (c *BoundedCounter) RightsOf(peer string) int64 {
+	var rights int64
+	if peer == c.state.Owner {
+		rights = c.state.Bound
+	}
+	for from, to := range c.state.Transfers {
+		if from == peer {
+			for _, amount := range to {
+				rights -= amount
+			}
+			continue
+		}
+		rights += to[peer]
+	}
+	return rights - c.used.valueOf(peer)
+}
+
+func (c *BoundedCounter) Transfer(to string, amount int64) error {
+	if amount < 1 || to == c.identity {
+		return fmt.Errorf("bounded counter: invalid transfer of %d to %s", amount, to)
+	}
+	if c.LocalRights() < amount {
+		return ErrBoundedCounterExhausted
+	}
+	transfers, ok := c.state.Transfers[c.identity]
+	if !ok {
+		transfers = make(map[string]int64)
+		c.state.Transfers[c.identity] = transfers
+	}
+	transfers[to] += amount
+	return nil
+}
+
+func (c *BoundedCounter) MergeWith(other BoundedCounterStateSource) {
+	otherState := other.GetState()
+	if otherState.Owner != "" && (c.state.Owner == "" || otherState.Owner < c.state.Owner) {
+		c.state.Owner = otherState.Owner
+		c.state.Bound = otherState.Bound
+	}
+	c.used.MergeWith(NewGCounterFromState("", otherState.Used))
+	for from, otherTransfers := range otherState.Transfers {
+		transfers, ok := c.state.Transfers[from]
+		if !ok {
+			transfers = make(map[string]int64)
+			c.state.Transfers[from] = transfers
+		}
+		for to, amount := range otherTransfers {
+			transfers[to] = max(transfers[to], amount)
+		}
+	}
+}
+
+func (c *BoundedCounter) GetState() BoundedCounterState {
+	c.state.Used = c.used.GetState()
+	return c.state
+}
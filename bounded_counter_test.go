@@ -0,0 +1,88 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedCounter(t *testing.T) {
+	t.Run("incrementing up to the bound", func(t *testing.T) {
+		c := NewBoundedCounter("1")
+		assert.ErrorIs(t, c.TryIncrement(), ErrBoundedCounterUninitialized)
+		c.Init(2)
+		assert.NoError(t, c.TryIncrement())
+		assert.NoError(t, c.TryIncrement())
+		assert.ErrorIs(t, c.TryIncrement(), ErrBoundedCounterExhausted)
+		assert.Equal(t, int64(2), c.Value())
+		assert.Equal(t, int64(0), c.LocalRights())
+	})
+
+	t.Run("other peers have no rights until transferred", func(t *testing.T) {
+		owner := NewBoundedCounter("1")
+		owner.Init(3)
+		other := NewBoundedCounter("2")
+		other.MergeWith(owner)
+		assert.Equal(t, int64(3), other.Bound())
+		assert.ErrorIs(t, other.TryIncrement(), ErrBoundedCounterExhausted)
+
+		assert.NoError(t, owner.Transfer("2", 2))
+		assert.ErrorIs(t, owner.Transfer("2", 2), ErrBoundedCounterExhausted)
+		assert.Error(t, owner.Transfer("2", 0))
+		other.MergeWith(owner)
+		assert.Equal(t, int64(2), other.LocalRights())
+		assert.NoError(t, other.TryIncrement())
+		assert.NoError(t, other.TryIncrement())
+		assert.ErrorIs(t, other.TryIncrement(), ErrBoundedCounterExhausted)
+		assert.NoError(t, owner.TryIncrement())
+
+		owner.MergeWith(other)
+		other.MergeWith(owner)
+		assert.Equal(t, int64(3), owner.Value())
+		assert.Equal(t, int64(3), other.Value())
+		assert.Equal(t, int64(0), owner.RightsOf("1")+owner.RightsOf("2"))
+	})
+
+	t.Run("rights can be passed on", func(t *testing.T) {
+		c1 := NewBoundedCounter("1")
+		c1.Init(4)
+		assert.NoError(t, c1.Transfer("2", 4))
+		c2 := NewBoundedCounter("2")
+		c2.MergeWith(c1)
+		assert.NoError(t, c2.Transfer("3", 1))
+		c3 := NewBoundedCounter("3")
+		c3.MergeWith(c2)
+		assert.Equal(t, int64(0), c3.RightsOf("1"))
+		assert.Equal(t, int64(3), c3.RightsOf("2"))
+		assert.Equal(t, int64(1), c3.LocalRights())
+	})
+
+	t.Run("merging is idempotent", func(t *testing.T) {
+		c1 := NewBoundedCounter("1")
+		c1.Init(10)
+		assert.NoError(t, c1.Transfer("2", 5))
+		c2 := NewBoundedCounter("2")
+		c2.MergeWith(c1)
+		c2.MergeWith(c1)
+		assert.Equal(t, int64(5), c2.LocalRights())
+	})
+
+	t.Run("concurrent initializations may exceed the bound", func(t *testing.T) {
+		c1 := NewBoundedCounter("1")
+		c1.Init(2)
+		c2 := NewBoundedCounter("2")
+		c2.Init(2)
+		assert.NoError(t, c2.TryIncrement())
+		assert.NoError(t, c2.TryIncrement())
+		assert.NoError(t, c1.TryIncrement())
+		assert.False(t, c1.Exceeded())
+
+		c1.MergeWith(c2)
+		c2.MergeWith(c1)
+		assert.Equal(t, int64(3), c1.Value())
+		assert.True(t, c1.Exceeded())
+		assert.True(t, c2.Exceeded())
+		assert.ErrorIs(t, c1.TryIncrement(), ErrBoundedCounterExceeded)
+		assert.ErrorIs(t, c2.TryIncrement(), ErrBoundedCounterExceeded)
+	})
+}
@@ -0,0 +1,150 @@
+package percounter
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+const DefaultCheckpointInterval = 10 * time.Second
+
+// Checkpointer periodically persists the instances registered in an EmergencyPersistence,
+// independently of the write-behind settings of the instances
+type Checkpointer struct {
+	phony.Inbox
+	registry       *EmergencyPersistence
+	interval       time.Duration
+	now            func() time.Time
+	started        time.Time
+	lastCheckpoint map[Persistent]time.Time
+	lastErr        map[Persistent]error
+	stop           chan struct{}
+}
+
+// CheckpointStatus describes how up to date the persisted state of an instance is
+type CheckpointStatus struct {
+	Persistent Persistent
+	// LastCheckpoint is the time of the last successful checkpoint, zero if there was none
+	LastCheckpoint time.Time
+	// Staleness is the time since the last successful checkpoint, or since the start if there was none
+	Staleness time.Duration
+	LastErr   error
+}
+
+func NewCheckpointer(registry *EmergencyPersistence, interval time.Duration) *Checkpointer {
+	return NewCheckpointerWithClock(registry, interval, time.Now)
+}
+
+func NewCheckpointerWithClock(registry *EmergencyPersistence, interval time.Duration, now func() time.Time) *Checkpointer {
+	return &Checkpointer{
+		registry:       registry,
+		interval:       interval,
+		now:            now,
+		started:        now(),
+		lastCheckpoint: map[Persistent]time.Time{},
+		lastErr:        map[Persistent]error{},
+	}
+}
+
+func (c *Checkpointer) Start() {
+	phony.Block(c, func() {
+		if c.stop != nil {
+			return
+		}
+		c.started = c.now()
+		c.stop = make(chan struct{})
+		go c.checkpointLoop(c.interval, c.stop)
+	})
+}
+
+func (c *Checkpointer) Stop() {
+	phony.Block(c, func() {
+		if c.stop == nil {
+			return
+		}
+		close(c.stop)
+		c.stop = nil
+	})
+}
+
+// Checkpoint persists all registered instances immediately
+func (c *Checkpointer) Checkpoint() PersistenceReport {
+	report := c.registry.Flush(context.Background())
+	phony.Block(c, func() {
+		c.recordSync(report)
+	})
+	return report
+}
+
+// Status lists the checkpoint status of the registered instances in the order of persistence
+func (c *Checkpointer) Status() []CheckpointStatus {
+	registered := c.registry.Registered()
+	res := []CheckpointStatus{}
+	phony.Block(c, func() {
+		now := c.now()
+		for _, p := range registered {
+			last := c.lastCheckpoint[p]
+			since := last
+			if since.IsZero() {
+				since = c.started
+			}
+			res = append(res, CheckpointStatus{
+				Persistent:     p,
+				LastCheckpoint: last,
+				Staleness:      now.Sub(since),
+				LastErr:        c.lastErr[p],
+			})
+		}
+	})
+	return res
+}
+
+// MaxStaleness is the staleness of the least recently checkpointed instance
+func (c *Checkpointer) MaxStaleness() time.Duration {
+	var res time.Duration
+	for _, status := range c.Status() {
+		res = max(res, status.Staleness)
+	}
+	return res
+}
+
+func (c *Checkpointer) checkpointLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.Checkpoint().Err(); err != nil {
+				log.Printf("checkpoint: %v", err)
+			}
+		}
+	}
+}
+
+func (c *Checkpointer) recordSync(report PersistenceReport) {
+	registered := map[Persistent]bool{}
+	for _, result := range report.Results {
+		registered[result.Persistent] = true
+		if result.Err != nil {
+			c.lastErr[result.Persistent] = result.Err
+			continue
+		}
+		delete(c.lastErr, result.Persistent)
+		c.lastCheckpoint[result.Persistent] = c.now()
+	}
+	// forget removed instances
+	for p := range c.lastCheckpoint {
+		if !registered[p] {
+			delete(c.lastCheckpoint, p)
+		}
+	}
+	for p := range c.lastErr {
+		if !registered[p] {
+			delete(c.lastErr, p)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package percounter
+
+import (
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointer(t *testing.T) {
+	t.Run("staleness is tracked per instance", func(t *testing.T) {
+		now := time.Unix(100, 0)
+		registry := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer registry.StopSignals()
+		c := NewCheckpointerWithClock(registry, time.Hour, func() time.Time { return now })
+		ok := &testPersistent{}
+		failing := NewPersistentGCounter("1", path.Join(t.TempDir(), "missing", "c.gcounter"))
+		registry.AddForPersistence(ok)
+		registry.AddForPersistence(failing)
+
+		now = now.Add(3 * time.Second)
+		status := c.Status()
+		require.Len(t, status, 2)
+		assert.True(t, status[0].LastCheckpoint.IsZero())
+		assert.Equal(t, 3*time.Second, status[0].Staleness)
+
+		report := c.Checkpoint()
+		assert.Len(t, report.Succeeded(), 1)
+		assert.Equal(t, 1, ok.Persisted())
+
+		now = now.Add(2 * time.Second)
+		status = c.Status()
+		assert.Equal(t, CheckpointStatus{ok, time.Unix(103, 0), 2 * time.Second, nil}, status[0])
+		assert.True(t, status[1].LastCheckpoint.IsZero())
+		assert.Equal(t, 5*time.Second, status[1].Staleness)
+		assert.Error(t, status[1].LastErr)
+		assert.Equal(t, 5*time.Second, c.MaxStaleness())
+
+		// removed instances are no longer tracked
+		registry.RemoveFromPersistence(failing)
+		c.Checkpoint()
+		assert.Equal(t, []Persistent{ok}, persistentsOfStatus(c.Status()))
+		assert.Equal(t, time.Duration(0), c.MaxStaleness())
+	})
+
+	t.Run("instances are checkpointed periodically", func(t *testing.T) {
+		registry := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer registry.StopSignals()
+		p := &testPersistent{}
+		registry.AddForPersistence(p)
+		c := NewCheckpointer(registry, 50*time.Millisecond)
+		c.Start()
+
+		waitFor(t, func() bool { return p.Persisted() >= 3 })
+		c.Stop()
+		assert.GreaterOrEqual(t, p.Persisted(), 3)
+		assert.False(t, c.Status()[0].LastCheckpoint.IsZero())
+	})
+}
+
+func persistentsOfStatus(status []CheckpointStatus) []Persistent {
+	res := []Persistent{}
+	for _, s := range status {
+		res = append(res, s.Persistent)
+	}
+	return res
+}
@@ -0,0 +1,131 @@
+// Package client talks to the HTTP API of a running counter node, see percounter.HTTPAPI
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/d-led/percounter"
+)
+
+const DefaultWatchInterval = 1 * time.Second
+
+// APIError is an error response of the node
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// New creates a client of the node at the base URL, e.g. http://localhost:8080
+func New(baseURL string) *Client {
+	return NewWithHTTPClient(baseURL, http.DefaultClient)
+}
+
+func NewWithHTTPClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    httpClient,
+	}
+}
+
+// Increment increments the counter, returning the value after the increment
+func (c *Client) Increment(ctx context.Context, name string) (percounter.CounterResponse, error) {
+	var res percounter.CounterResponse
+	err := c.do(ctx, http.MethodPost, "/counters/"+url.PathEscape(name)+"/increment", &res)
+	return res, err
+}
+
+// Counter gets the counter with its per-peer counts
+func (c *Client) Counter(ctx context.Context, name string) (percounter.CounterResponse, error) {
+	var res percounter.CounterResponse
+	err := c.do(ctx, http.MethodGet, "/counters/"+url.PathEscape(name), &res)
+	return res, err
+}
+
+func (c *Client) Counters(ctx context.Context) ([]percounter.CounterResponse, error) {
+	res := []percounter.CounterResponse{}
+	err := c.do(ctx, http.MethodGet, "/counters", &res)
+	return res, err
+}
+
+func (c *Client) Peers(ctx context.Context) (percounter.PeersResponse, error) {
+	var res percounter.PeersResponse
+	err := c.do(ctx, http.MethodGet, "/peers", &res)
+	return res, err
+}
+
+// Retire folds the counts of a dead member into the retired slot once the cluster agrees
+func (c *Client) Retire(ctx context.Context, identity string) (percounter.PeersResponse, error) {
+	var res percounter.PeersResponse
+	err := c.do(ctx, http.MethodPost, "/members/"+url.PathEscape(identity)+"/retire", &res)
+	return res, err
+}
+
+// Watch polls the counter until ctx is done, calling onChange with its first value and on each change.
+// A counter not existing yet is waited for
+func (c *Client) Watch(ctx context.Context, name string, interval time.Duration, onChange func(percounter.CounterResponse)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last *percounter.CounterResponse
+	for {
+		counter, err := c.Counter(ctx, name)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case IsNotFound(err):
+		case err != nil:
+			return err
+		case last == nil || last.Value != counter.Value:
+			onChange(counter)
+			last = &counter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var e percounter.ErrorResponse
+		if json.NewDecoder(res.Body).Decode(&e) != nil || e.Error == "" {
+			e.Error = "unexpected response"
+		}
+		return &APIError{StatusCode: res.StatusCode, Message: e.Error}
+	}
+	if err := json.NewDecoder(res.Body).Decode(body); err != nil {
+		return fmt.Errorf("decoding the response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/d-led/percounter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	newNodeAt := func(t *testing.T, port string, config percounter.MembershipConfig) (*percounter.ZmqMultiGcounter, *Client) {
+		c := percounter.NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port)
+		c.SetMembershipConfig(config)
+		require.NoError(t, c.Start())
+		t.Cleanup(c.Stop)
+		server := httptest.NewServer(percounter.NewHTTPAPI(c))
+		t.Cleanup(server.Close)
+		return c, New(server.URL + "/")
+	}
+	newNode := func(t *testing.T) (*percounter.ZmqMultiGcounter, *Client) {
+		return newNodeAt(t, freePort(t), percounter.DefaultMembershipConfig())
+	}
+	ctx := context.Background()
+
+	t.Run("counters are incremented and read", func(t *testing.T) {
+		_, client := newNode(t)
+
+		counter, err := client.Increment(ctx, "x")
+		require.NoError(t, err)
+		assert.Equal(t, percounter.CounterResponse{Name: "x", Value: 1}, counter)
+
+		counter, err = client.Counter(ctx, "x")
+		require.NoError(t, err)
+		assert.Equal(t, percounter.CounterResponse{Name: "x", Value: 1, Peers: map[string]int64{"1": 1}}, counter)
+
+		counters, err := client.Counters(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []percounter.CounterResponse{{Name: "x", Value: 1}}, counters)
+
+		peers, err := client.Peers(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "1", peers.Identity)
+	})
+
+	t.Run("error responses are returned as API errors", func(t *testing.T) {
+		_, client := newNode(t)
+
+		_, err := client.Counter(ctx, "unknown")
+		assert.True(t, IsNotFound(err))
+		assert.ErrorContains(t, err, "404 Not Found: counter 'unknown' not found")
+
+		_, err = client.Increment(ctx, "../x")
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		assert.False(t, IsNotFound(err))
+	})
+
+	t.Run("members are retired once dead", func(t *testing.T) {
+		config := percounter.MembershipConfig{
+			HeartbeatInterval: 50 * time.Millisecond,
+			SuspectTimeout:    150 * time.Millisecond,
+			DeadTimeout:       300 * time.Millisecond,
+		}
+		port := freePort(t)
+		c, client := newNodeAt(t, port, config)
+		gone := percounter.NewZmqMultiGcounter("gone", t.TempDir(), "tcp://:"+freePort(t))
+		gone.SetMembershipConfig(config)
+		require.NoError(t, gone.Start())
+		gone.Increment("x")
+		gone.UpdatePeers([]string{"tcp://127.0.0.1:" + port})
+		for w := 0; w < 15 && c.Value("x") < 1; w++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		_, err := client.Retire(ctx, "gone")
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+
+		gone.Stop()
+		isDead := func() bool {
+			peers, err := client.Peers(ctx)
+			return err == nil && slices.ContainsFunc(peers.Members, func(m percounter.Member) bool {
+				return m.Identity == "gone" && m.State == percounter.MemberDead
+			})
+		}
+		for w := 0; w < 15 && !isDead(); w++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		_, err = client.Retire(ctx, "gone")
+		require.NoError(t, err)
+		counter, err := client.Counter(ctx, "x")
+		require.NoError(t, err)
+		assert.Equal(t, percounter.CounterResponse{Name: "x", Value: 1, Retired: 1}, counter)
+
+		_, err = client.Retire(ctx, "1")
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	})
+
+	t.Run("counters are watched for changes", func(t *testing.T) {
+		c, client := newNode(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		var mutex sync.Mutex
+		values := []int64{}
+		done := make(chan error, 1)
+		go func() {
+			done <- client.Watch(ctx, "x", 10*time.Millisecond, func(counter percounter.CounterResponse) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				values = append(values, counter.Value)
+			})
+		}()
+		valuesSeen := func() []int64 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]int64{}, values...)
+		}
+		waitFor := func(expected []int64) {
+			for w := 0; w < 15 && !assert.ObjectsAreEqual(expected, valuesSeen()); w++ {
+				time.Sleep(100 * time.Millisecond)
+			}
+			assert.Equal(t, expected, valuesSeen())
+		}
+
+		// not existing yet
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, valuesSeen())
+		c.Increment("x")
+		waitFor([]int64{1})
+		c.Increment("x")
+		c.Increment("x")
+		for w := 0; w < 15 && slices.Max(valuesSeen()) < 3; w++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		// each change is reported once, intermediate values possibly skipped
+		seen := valuesSeen()
+		assert.Equal(t, int64(3), seen[len(seen)-1])
+		assert.True(t, slices.IsSorted(seen))
+		assert.Equal(t, seen, slices.Compact(slices.Clone(seen)))
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("unreachable nodes are reported", func(t *testing.T) {
+		client := New("http://127.0.0.1:" + freePort(t))
+		_, err := client.Counters(ctx)
+		assert.Error(t, err)
+		assert.Error(t, client.Watch(ctx, "x", time.Millisecond, func(percounter.CounterResponse) {}))
+	})
+}
+
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
@@ -0,0 +1,246 @@
+// percounter inspects and manipulates persisted G-Counter files and talks to running nodes
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/d-led/percounter"
+)
+
+const usage = `usage: percounter <command> [arguments]
+
+commands:
+  list <dir>                   list the counters in a directory with their totals
+  show <file|dir>...           show the totals and per-peer counts
+  merge <from> <into>          merge a file or directory into another one, CRDT-style
+  validate <file|dir>...       check the integrity of the counter files
+
+commands for a running node, see percounterd:
+  incr [flags] <name>          increment a counter
+  get [flags] [name]           get a counter with its per-peer counts, or all counters
+  watch [flags] <name>         print the value of a counter on each change
+  peers [flags]                list the peers and members of the node
+
+flags:
+  -addr <url>                  address of the node, defaults to $PERCOUNTER_ADDR or http://localhost:8080
+  -json                        print JSON
+  -interval <duration>         polling interval of watch
+`
+
+var gcounterExtension = percounter.GCounterCRDTType.Extension
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	command, args := args[0], args[1:]
+	var err error
+	switch {
+	case command == "list" && len(args) == 1:
+		err = list(args[0], stdout)
+	case command == "show" && len(args) > 0:
+		err = show(args, stdout)
+	case command == "merge" && len(args) == 2:
+		err = merge(args[0], args[1], stdout)
+	case command == "validate" && len(args) > 0:
+		err = validate(args, stdout)
+	case slices.Contains(remoteCommands, command):
+		return runRemote(ctx, command, args, stdout, stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func list(dir string, stdout io.Writer) error {
+	files, err := counterFilesIn(dir)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tPEERS")
+	var errs []error
+	for _, file := range files {
+		state, err := percounter.ReadGCounterFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\n", state.Name, valueOf(state), len(state.Peers))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+func show(paths []string, stdout io.Writer) error {
+	files, err := counterFilesOf(paths)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, file := range files {
+		state, err := percounter.ReadGCounterFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := printCounter(stdout, state.Name, valueOf(state), state.Retired.Total(), state.Peers); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// printCounter prints the total with the per-peer counts
+func printCounter(stdout io.Writer, name string, value, retired int64, peers map[string]int64) error {
+	fmt.Fprintf(stdout, "%s: %d\n", name, value)
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	if retired > 0 {
+		fmt.Fprintf(w, "  (retired)\t%d\n", retired)
+	}
+	for _, peer := range slices.Sorted(maps.Keys(peers)) {
+		fmt.Fprintf(w, "  %s\t%d\n", peer, peers[peer])
+	}
+	return w.Flush()
+}
+
+// merge merges a file into a file, or each counter of a directory into the same named one of another directory
+func merge(from, into string, stdout io.Writer) error {
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return mergeFile(from, into, stdout)
+	}
+	files, err := counterFilesIn(from)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(into, 0755); err != nil {
+		return err
+	}
+	var errs []error
+	for _, file := range files {
+		if err := mergeFile(file, filepath.Join(into, filepath.Base(file)), stdout); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func mergeFile(from, into string, stdout io.Writer) error {
+	other, err := percounter.ReadGCounterFile(from)
+	if err != nil {
+		return err
+	}
+	state, err := percounter.ReadGCounterFile(into)
+	if errors.Is(err, os.ErrNotExist) {
+		state = percounter.NewNamedGcounterState(other.Name)
+	} else if err != nil {
+		return err
+	}
+	counter := percounter.NewGCounterFromState("", state)
+	before := counter.Value()
+	counter.MergeWith(percounter.NewGCounterFromState("", other))
+	if err := percounter.WriteGCounterFile(into, counter.GetState()); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s: %d -> %d\n", into, before, counter.Value())
+	return nil
+}
+
+func validate(paths []string, stdout io.Writer) error {
+	files, err := counterFilesOf(paths)
+	if err != nil {
+		return err
+	}
+	invalid := 0
+	for _, file := range files {
+		if err := validateFile(file); err != nil {
+			invalid++
+			fmt.Fprintf(stdout, "invalid %s: %s\n", file, strings.ReplaceAll(err.Error(), "\n", "; "))
+			continue
+		}
+		fmt.Fprintf(stdout, "ok %s\n", file)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d files invalid", invalid, len(files))
+	}
+	return nil
+}
+
+func validateFile(file string) error {
+	state, err := percounter.ReadGCounterFile(file)
+	if err != nil {
+		return err
+	}
+	if expected := strings.TrimSuffix(filepath.Base(file), gcounterExtension); state.Name != expected {
+		return fmt.Errorf("name '%s' does not match the file name", state.Name)
+	}
+	return percounter.ValidateGCounterState(state)
+}
+
+// counterFilesOf expands directories to the counter files within
+func counterFilesOf(paths []string) ([]string, error) {
+	res := []string{}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			res = append(res, p)
+			continue
+		}
+		files, err := counterFilesIn(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, files...)
+	}
+	return res, nil
+}
+
+func counterFilesIn(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == gcounterExtension {
+			res = append(res, filepath.Join(dir, e.Name()))
+		}
+	}
+	return res, nil
+}
+
+func valueOf(state percounter.GCounterState) int64 {
+	return percounter.NewGCounterFromState("", state).Value()
+}
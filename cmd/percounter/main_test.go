@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/d-led/percounter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercounterCommand(t *testing.T) {
+	run := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(context.Background(), args, &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+	writeCounter := func(t *testing.T, dir, name string, peers map[string]int64) string {
+		filename := filepath.Join(dir, name+".gcounter")
+		require.NoError(t, percounter.WriteGCounterFile(filename, percounter.GCounterState{Name: name, Peers: peers}))
+		return filename
+	}
+
+	t.Run("counters in a directory are listed", func(t *testing.T) {
+		dir := t.TempDir()
+		writeCounter(t, dir, "a", map[string]int64{"1": 2, "2": 3})
+		writeCounter(t, dir, "b", map[string]int64{"1": 1})
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "c.gset"), []byte(`{}`), 0644))
+
+		code, stdout, _ := run("list", dir)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "NAME  VALUE  PEERS\na     5      2\nb     1      1\n", stdout)
+	})
+
+	t.Run("totals are shown with per-peer counts", func(t *testing.T) {
+		file := writeCounter(t, t.TempDir(), "a", map[string]int64{"2": 3, "1": 2})
+
+		code, stdout, _ := run("show", file)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "a: 5\n  1  2\n  2  3\n", stdout)
+	})
+
+	t.Run("files are merged CRDT-style", func(t *testing.T) {
+		dir := t.TempDir()
+		from := writeCounter(t, dir, "from", map[string]int64{"1": 5, "2": 1})
+		into := writeCounter(t, dir, "a", map[string]int64{"1": 2, "2": 3})
+
+		code, stdout, _ := run("merge", from, into)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, into+": 5 -> 8\n", stdout)
+		merged, err := percounter.ReadGCounterFile(into)
+		require.NoError(t, err)
+		assert.Equal(t, percounter.GCounterState{Name: "a", Peers: map[string]int64{"1": 5, "2": 3}}, merged)
+	})
+
+	t.Run("directories are merged per counter", func(t *testing.T) {
+		from := t.TempDir()
+		writeCounter(t, from, "a", map[string]int64{"1": 5})
+		writeCounter(t, from, "b", map[string]int64{"1": 1})
+		into := t.TempDir()
+		writeCounter(t, into, "a", map[string]int64{"2": 1})
+
+		code, _, _ := run("merge", from, into)
+		assert.Equal(t, 0, code)
+		a, err := percounter.ReadGCounterFile(filepath.Join(into, "a.gcounter"))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{"1": 5, "2": 1}, a.Peers)
+		b, err := percounter.ReadGCounterFile(filepath.Join(into, "b.gcounter"))
+		require.NoError(t, err)
+		assert.Equal(t, percounter.GCounterState{Name: "b", Peers: map[string]int64{"1": 1}}, b)
+	})
+
+	t.Run("invalid files are reported", func(t *testing.T) {
+		dir := t.TempDir()
+		ok := writeCounter(t, dir, "a", map[string]int64{"1": 1})
+		negative := writeCounter(t, dir, "b", map[string]int64{"1": -1})
+		renamed := filepath.Join(dir, "c.gcounter")
+		require.NoError(t, percounter.WriteGCounterFile(renamed, percounter.NewNamedGcounterState("other")))
+		broken := filepath.Join(dir, "d.gcounter")
+		require.NoError(t, os.WriteFile(broken, []byte(`{"peers":`), 0644))
+
+		code, stdout, stderr := run("validate", dir)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stdout, "ok "+ok+"\n")
+		assert.Contains(t, stdout, "invalid "+negative+": negative count -1 of peer '1'\n")
+		assert.Contains(t, stdout, "invalid "+renamed+": name 'other' does not match the file name\n")
+		assert.Contains(t, stdout, "invalid "+broken+": deserializing state")
+		assert.Equal(t, "3 of 4 files invalid\n", stderr)
+
+		code, _, _ = run("validate", ok)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		code, _, stderr := run()
+		assert.Equal(t, 2, code)
+		assert.Contains(t, stderr, "usage: percounter")
+
+		code, _, _ = run("merge", "only-one")
+		assert.Equal(t, 2, code)
+	})
+}
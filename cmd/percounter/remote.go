@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/d-led/percounter"
+	"github.com/d-led/percounter/client"
+)
+
+const defaultAddr = "http://localhost:8080"
+
+// addrEnv overrides the default address of the node
+const addrEnv = "PERCOUNTER_ADDR"
+
+var remoteCommands = []string{"incr", "get", "watch", "peers"}
+
+type remoteOptions struct {
+	addr     string
+	json     bool
+	interval time.Duration
+}
+
+func runRemote(ctx context.Context, command string, args []string, stdout, stderr io.Writer) int {
+	o := remoteOptions{}
+	addr := os.Getenv(addrEnv)
+	if addr == "" {
+		addr = defaultAddr
+	}
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&o.addr, "addr", addr, "address of the node")
+	flags.BoolVar(&o.json, "json", false, "print JSON")
+	flags.DurationVar(&o.interval, "interval", client.DefaultWatchInterval, "polling interval of watch")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	args = flags.Args()
+	c := client.New(o.addr)
+
+	var err error
+	switch {
+	case command == "incr" && len(args) == 1:
+		err = incr(ctx, c, args[0], o, stdout)
+	case command == "get" && len(args) == 0:
+		err = getAll(ctx, c, o, stdout)
+	case command == "get" && len(args) == 1:
+		err = get(ctx, c, args[0], o, stdout)
+	case command == "watch" && len(args) == 1:
+		err = watch(ctx, c, args[0], o, stdout)
+	case command == "peers" && len(args) == 0:
+		err = peers(ctx, c, o, stdout)
+	default:
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func incr(ctx context.Context, c *client.Client, name string, o remoteOptions, stdout io.Writer) error {
+	counter, err := c.Increment(ctx, name)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return json.NewEncoder(stdout).Encode(counter)
+	}
+	_, err = fmt.Fprintf(stdout, "%s: %d\n", counter.Name, counter.Value)
+	return err
+}
+
+func get(ctx context.Context, c *client.Client, name string, o remoteOptions, stdout io.Writer) error {
+	counter, err := c.Counter(ctx, name)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return json.NewEncoder(stdout).Encode(counter)
+	}
+	return printCounter(stdout, counter.Name, counter.Value, counter.Retired, counter.Peers)
+}
+
+func getAll(ctx context.Context, c *client.Client, o remoteOptions, stdout io.Writer) error {
+	counters, err := c.Counters(ctx)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return json.NewEncoder(stdout).Encode(counters)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE")
+	for _, counter := range counters {
+		fmt.Fprintf(w, "%s\t%d\n", counter.Name, counter.Value)
+	}
+	return w.Flush()
+}
+
+// watch runs until interrupted, i.e. ctx is done
+func watch(ctx context.Context, c *client.Client, name string, o remoteOptions, stdout io.Writer) error {
+	encoder := json.NewEncoder(stdout)
+	err := c.Watch(ctx, name, o.interval, func(counter percounter.CounterResponse) {
+		if o.json {
+			_ = encoder.Encode(counter)
+			return
+		}
+		fmt.Fprintf(stdout, "%s: %d\n", counter.Name, counter.Value)
+	})
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// interrupted
+		return nil
+	}
+	return err
+}
+
+func peers(ctx context.Context, c *client.Client, o remoteOptions, stdout io.Writer) error {
+	res, err := c.Peers(ctx)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return json.NewEncoder(stdout).Encode(res)
+	}
+	fmt.Fprintf(stdout, "identity: %s\n", res.Identity)
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "peers:")
+	for _, peer := range res.Peers {
+		protocol, known := res.Protocols[peer]
+		if !known {
+			fmt.Fprintf(w, "  %s\tunknown protocol\t\n", peer)
+			continue
+		}
+		fmt.Fprintf(w, "  %s\tv%d\t%s\n", peer, protocol.Version, strings.Join(protocol.Capabilities, ","))
+	}
+	fmt.Fprintln(w, "members:")
+	for _, m := range res.Members {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", m.Identity, m.State, m.Address)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/d-led/percounter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteCommands(t *testing.T) {
+	node := percounter.NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+freePort(t))
+	require.NoError(t, node.Start())
+	defer node.Stop()
+	server := httptest.NewServer(percounter.NewHTTPAPI(node))
+	defer server.Close()
+	run := func(ctx context.Context, args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(ctx, args, &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+	ctx := context.Background()
+
+	t.Run("counters are incremented and read", func(t *testing.T) {
+		code, stdout, _ := run(ctx, "incr", "-addr", server.URL, "x")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "x: 1\n", stdout)
+
+		code, stdout, _ = run(ctx, "incr", "-addr", server.URL, "-json", "x")
+		assert.Equal(t, 0, code)
+		assert.JSONEq(t, `{"name":"x","value":2}`, stdout)
+
+		code, stdout, _ = run(ctx, "get", "-addr", server.URL, "x")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "x: 2\n  1  2\n", stdout)
+
+		code, stdout, _ = run(ctx, "get", "-addr", server.URL)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "NAME  VALUE\nx     2\n", stdout)
+
+		code, stdout, _ = run(ctx, "get", "-addr", server.URL, "-json")
+		assert.Equal(t, 0, code)
+		assert.JSONEq(t, `[{"name":"x","value":2}]`, stdout)
+	})
+
+	t.Run("the address is taken from the environment", func(t *testing.T) {
+		t.Setenv(addrEnv, server.URL)
+		code, stdout, _ := run(ctx, "get", "x")
+		assert.Equal(t, 0, code)
+		assert.True(t, strings.HasPrefix(stdout, "x: "))
+	})
+
+	t.Run("peers are listed", func(t *testing.T) {
+		code, stdout, _ := run(ctx, "peers", "-addr", server.URL)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "identity: 1\npeers:\nmembers:\n", stdout)
+
+		code, stdout, _ = run(ctx, "peers", "-addr", server.URL, "-json")
+		assert.Equal(t, 0, code)
+		var peers percounter.PeersResponse
+		require.NoError(t, json.Unmarshal([]byte(stdout), &peers))
+		assert.Equal(t, "1", peers.Identity)
+	})
+
+	t.Run("changes are watched until interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			node.Increment("w")
+		}()
+
+		code, stdout, _ := run(ctx, "watch", "-addr", server.URL, "-interval", "10ms", "w")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "w: 1\n", stdout)
+	})
+
+	t.Run("errors are reported", func(t *testing.T) {
+		code, _, stderr := run(ctx, "get", "-addr", server.URL, "unknown")
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr, "counter 'unknown' not found")
+
+		code, _, _ = run(ctx, "incr", "-addr", server.URL)
+		assert.Equal(t, 2, code)
+		code, _, _ = run(ctx, "peers", "-unknown-flag")
+		assert.Equal(t, 2, code)
+	})
+}
+
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
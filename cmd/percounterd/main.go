@@ -0,0 +1,197 @@
+// percounterd runs a counter node, serving its counters via HTTP
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/d-led/percounter"
+)
+
+type options struct {
+	identity           string
+	autoIdentity       bool
+	dir                string
+	bindAddr           string
+	peers              string
+	config             string
+	httpAddr           string
+	myIP               string
+	checkpointInterval time.Duration
+	shutdownTimeout    time.Duration
+	identityCheck      time.Duration
+	heartbeatInterval  time.Duration
+	retireOnShutdown   bool
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stderr, nil); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// run serves until ctx is done, reporting the HTTP address once listening
+func run(ctx context.Context, args []string, stderr io.Writer, listening func(httpAddr string)) error {
+	o, err := parseOptions(args, stderr)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(o.dir, 0755); err != nil {
+		return err
+	}
+
+	if o.autoIdentity {
+		if o.identity, err = percounter.LoadOrCreateIdentity(o.dir); err != nil {
+			return err
+		}
+	}
+
+	c := percounter.NewZmqMultiGcounter(o.identity, o.dir, o.bindAddr)
+	if o.myIP != "" {
+		c.SetMyIP(o.myIP)
+	}
+	if o.heartbeatInterval > 0 {
+		config := percounter.DefaultMembershipConfig()
+		config.HeartbeatInterval = o.heartbeatInterval
+		c.SetMembershipConfig(config)
+	}
+	if err := c.LoadAllSync(); err != nil {
+		return err
+	}
+	// shutdown is triggered via ctx
+	registry := percounter.NewEmergencyPersistenceWithoutSignals()
+	c.PersistVia(registry)
+	checkpointer := percounter.NewCheckpointer(registry, o.checkpointInterval)
+	api := percounter.NewHTTPAPI(c)
+	api.SetCheckpointer(checkpointer)
+	c.SetClusterObserver(api.TrafficObserver())
+
+	listener, err := net.Listen("tcp", o.httpAddr)
+	if err != nil {
+		return err
+	}
+	if err := c.Start(); err != nil {
+		listener.Close()
+		return err
+	}
+	var watcher *percounter.PeerConfigWatcher
+	if o.config != "" {
+		watcher = percounter.NewPeerConfigWatcher(o.config, c)
+		if err := watcher.Start(); err != nil {
+			log.Printf("peer configuration: %v", err)
+		}
+	} else if o.peers != "" {
+		c.UpdatePeers(strings.Split(o.peers, ","))
+	}
+	if o.identityCheck > 0 && o.myIP != "" {
+		if err := c.VerifyIdentity(o.identityCheck); err != nil {
+			if watcher != nil {
+				watcher.Stop()
+			}
+			listener.Close()
+			return err
+		}
+	}
+	checkpointer.Start()
+
+	server := &http.Server{Handler: api}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+	log.Printf("%s: serving HTTP on %s, cluster on %s", o.identity, listener.Addr(), o.bindAddr)
+	if listening != nil {
+		listening(listener.Addr().String())
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-served:
+	}
+
+	log.Printf("%s: shutting down", o.identity)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), o.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown: %v", err)
+	}
+	if watcher != nil {
+		watcher.Stop()
+	}
+	checkpointer.Stop()
+	report := registry.Flush(shutdownCtx)
+	log.Printf("%s: persisted %d of %d counters", o.identity, len(report.Succeeded()), len(report.Results))
+	if o.retireOnShutdown {
+		// the counts of this node stay in its slot if the peers do not agree
+		if err := c.Leave(o.shutdownTimeout); err != nil {
+			log.Printf("%s: not retired: %v", o.identity, err)
+		}
+	} else {
+		c.Stop()
+	}
+	if errors.Is(serveErr, http.ErrServerClosed) {
+		serveErr = nil
+	}
+	return errors.Join(serveErr, report.Err())
+}
+
+// parseOptions takes the identity and bind address from the configuration file unless given as flags
+func parseOptions(args []string, stderr io.Writer) (options, error) {
+	o := options{}
+	hostname, _ := os.Hostname()
+	flags := flag.NewFlagSet("percounterd", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&o.identity, "identity", hostname, "unique identity of the node")
+	flags.BoolVar(&o.autoIdentity, "auto-identity", false, "generate the identity once and keep it in the counter directory")
+	flags.StringVar(&o.dir, "dir", ".", "directory of the counter files")
+	flags.StringVar(&o.bindAddr, "bind", "tcp://:5000", "cluster bind address")
+	flags.StringVar(&o.peers, "peers", "", "comma-separated peer addresses, e.g. tcp://[10.0.0.2]:5000")
+	flags.StringVar(&o.config, "config", "", "peer configuration file (JSON or YAML), watched for changes")
+	flags.StringVar(&o.httpAddr, "http", ":8080", "HTTP API address")
+	flags.StringVar(&o.myIP, "my-ip", "", "IP address advertised to the peers")
+	flags.DurationVar(&o.checkpointInterval, "checkpoint-interval", percounter.DefaultCheckpointInterval, "interval of persisting all counters")
+	flags.DurationVar(&o.shutdownTimeout, "shutdown-timeout", percounter.DefaultShutdownTimeout, "time to persist all counters on shutdown")
+	flags.DurationVar(&o.identityCheck, "identity-check-timeout", percounter.DefaultIdentityCheckTimeout, "time to wait for a node with the same identity to answer on start, requires -my-ip, 0 to skip")
+	flags.DurationVar(&o.heartbeatInterval, "heartbeat-interval", 0, "interval of the heartbeats detecting dead members, which can then be retired, 0 to disable")
+	flags.BoolVar(&o.retireOnShutdown, "retire-on-shutdown", false, "fold the counts of this node into the retired slot on shutdown, for nodes not coming back, requires -my-ip")
+	if err := flags.Parse(args); err != nil {
+		return o, err
+	}
+	if flags.NArg() > 0 {
+		return o, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if o.autoIdentity && set["identity"] {
+		return o, errors.New("-identity and -auto-identity are mutually exclusive")
+	}
+	if o.config == "" {
+		return o, nil
+	}
+	config, err := percounter.LoadPeerConfig(o.config)
+	if err != nil {
+		return o, err
+	}
+	if config.Identity != "" && !set["identity"] && !o.autoIdentity {
+		o.identity = config.Identity
+	}
+	if config.BindAddr != "" && !set["bind"] {
+		o.bindAddr = config.BindAddr
+	}
+	return o, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/d-led/percounter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercounterd(t *testing.T) {
+	t.Run("nodes serve and replicate counters, persisting them on shutdown", func(t *testing.T) {
+		port1 := freePort(t)
+		port2 := freePort(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		url1, done1 := startNode(t, ctx,
+			"-identity", "1", "-dir", t.TempDir(), "-bind", "tcp://:"+port1, "-my-ip", "127.0.0.1",
+			"-peers", "tcp://[127.0.0.1]:"+port2, "-identity-check-timeout", "100ms")
+		dir2 := t.TempDir()
+		url2, done2 := startNode(t, ctx,
+			"-identity", "2", "-dir", dir2, "-bind", "tcp://:"+port2, "-my-ip", "127.0.0.1",
+			"-peers", "tcp://[127.0.0.1]:"+port1, "-identity-check-timeout", "100ms")
+
+		var counter percounter.CounterResponse
+		post(t, url1+"/counters/x/increment", &counter)
+		post(t, url2+"/counters/x/increment", &counter)
+		waitForCounterValueOf(t, 2, url1, "x")
+		waitForCounterValueOf(t, 2, url2, "x")
+
+		res, err := http.Get(url2 + "/metrics")
+		require.NoError(t, err)
+		metrics, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Contains(t, string(metrics), "percounter_counter_value{name=\"x\"} 2\n")
+		assert.Contains(t, string(metrics), "percounter_checkpoint_max_staleness_seconds")
+
+		cancel()
+		require.NoError(t, <-done1)
+		require.NoError(t, <-done2)
+		state, err := percounter.ReadGCounterFile(filepath.Join(dir2, "x.gcounter"))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{"1": 1, "2": 1}, state.Peers)
+	})
+
+	t.Run("nodes refuse to start with an identity already in use", func(t *testing.T) {
+		port1 := freePort(t)
+		port2 := freePort(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, done1 := startNode(t, ctx,
+			"-identity", "1", "-dir", t.TempDir(), "-bind", "tcp://:"+port1, "-my-ip", "127.0.0.1", "-identity-check-timeout", "0")
+
+		err := run(ctx, []string{
+			"-identity", "1", "-dir", t.TempDir(), "-bind", "tcp://:" + port2, "-my-ip", "127.0.0.1",
+			"-peers", "tcp://[127.0.0.1]:" + port1, "-identity-check-timeout", "300ms", "-http", "127.0.0.1:0",
+		}, io.Discard, nil)
+		assert.ErrorIs(t, err, percounter.ErrIdentityCollision)
+
+		cancel()
+		// the running node has detected the collision as well but keeps running until shut down
+		assert.NoError(t, <-done1)
+	})
+
+	t.Run("nodes retire on shutdown if asked to", func(t *testing.T) {
+		port1 := freePort(t)
+		port2 := freePort(t)
+		ctx1, cancel1 := context.WithCancel(context.Background())
+		defer cancel1()
+		dir1 := t.TempDir()
+		url1, done1 := startNode(t, ctx1,
+			"-identity", "1", "-dir", dir1, "-bind", "tcp://:"+port1, "-my-ip", "127.0.0.1",
+			"-peers", "tcp://[127.0.0.1]:"+port2, "-identity-check-timeout", "100ms")
+		ctx2, cancel2 := context.WithCancel(context.Background())
+		url2, done2 := startNode(t, ctx2,
+			"-identity", "2", "-dir", t.TempDir(), "-bind", "tcp://:"+port2, "-my-ip", "127.0.0.1",
+			"-peers", "tcp://[127.0.0.1]:"+port1, "-identity-check-timeout", "100ms", "-retire-on-shutdown")
+
+		var counter percounter.CounterResponse
+		post(t, url1+"/counters/x/increment", &counter)
+		post(t, url2+"/counters/x/increment", &counter)
+		waitForCounterValueOf(t, 2, url2, "x")
+		waitForCounterValueOf(t, 2, url1, "x")
+
+		cancel2()
+		require.NoError(t, <-done2)
+		for w := 0; w < 15 && counterOf(url1, "x").Retired == 0; w++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		assert.Equal(t, percounter.CounterResponse{Name: "x", Value: 2, Peers: map[string]int64{"1": 1}, Retired: 1}, counterOf(url1, "x"))
+
+		cancel1()
+		require.NoError(t, <-done1)
+	})
+
+	t.Run("generated identities are kept in the counter directory", func(t *testing.T) {
+		dir := t.TempDir()
+		for restart := 1; restart <= 2; restart++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			url, done := startNode(t, ctx,
+				"-auto-identity", "-dir", dir, "-bind", "tcp://:"+freePort(t), "-identity-check-timeout", "0")
+			var counter percounter.CounterResponse
+			post(t, url+"/counters/x/increment", &counter)
+			cancel()
+			require.NoError(t, <-done)
+		}
+
+		identity, err := percounter.LoadOrCreateIdentity(dir)
+		require.NoError(t, err)
+		state, err := percounter.ReadGCounterFile(filepath.Join(dir, "x.gcounter"))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int64{identity: 2}, state.Peers)
+
+		_, err = parseOptions([]string{"-auto-identity", "-identity", "1"}, io.Discard)
+		assert.Error(t, err)
+	})
+
+	t.Run("identity and bind address are taken from the configuration file", func(t *testing.T) {
+		config := filepath.Join(t.TempDir(), "peers.yaml")
+		require.NoError(t, os.WriteFile(config, []byte("identity: from-config\nbind_addr: tcp://:1234\npeers: []\n"), 0644))
+
+		o, err := parseOptions([]string{"-config", config}, io.Discard)
+		require.NoError(t, err)
+		assert.Equal(t, "from-config", o.identity)
+		assert.Equal(t, "tcp://:1234", o.bindAddr)
+
+		o, err = parseOptions([]string{"-config", config, "-identity", "from-flag"}, io.Discard)
+		require.NoError(t, err)
+		assert.Equal(t, "from-flag", o.identity)
+
+		_, err = parseOptions([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, io.Discard)
+		assert.Error(t, err)
+		_, err = parseOptions([]string{"unexpected"}, io.Discard)
+		assert.Error(t, err)
+	})
+}
+
+func startNode(t *testing.T, ctx context.Context, args ...string) (string, chan error) {
+	addr := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, append(args, "-http", "127.0.0.1:0"), io.Discard, func(httpAddr string) {
+			addr <- httpAddr
+		})
+	}()
+	select {
+	case a := <-addr:
+		return "http://" + a, done
+	case err := <-done:
+		require.NoError(t, err)
+		t.FailNow()
+		return "", done
+	}
+}
+
+func post(t *testing.T, url string, body any) {
+	res, err := http.Post(url, "application/json", bytes.NewReader(nil))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(body))
+}
+
+func counterValueOf(url, name string) int64 {
+	return counterOf(url, name).Value
+}
+
+// counterOf has the value -1 if the counter cannot be read
+func counterOf(url, name string) percounter.CounterResponse {
+	res, err := http.Get(fmt.Sprintf("%s/counters/%s", url, name))
+	if err != nil {
+		return percounter.CounterResponse{Value: -1}
+	}
+	defer res.Body.Close()
+	var counter percounter.CounterResponse
+	if json.NewDecoder(res.Body).Decode(&counter) != nil {
+		return percounter.CounterResponse{Value: -1}
+	}
+	return counter
+}
+
+func waitForCounterValueOf(t *testing.T, expectedValue int64, url, name string) {
+	for w := 0; w < 15; w++ {
+		if counterValueOf(url, name) == expectedValue {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, expectedValue, counterValueOf(url, name))
+}
+
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
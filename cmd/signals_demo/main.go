@@ -2,21 +2,33 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/d-led/percounter"
 )
 
 func main() {
-	// this forces `PersistAndExitOnSignal` to wait even in the absence of added persistent counters
-	percounter.GlobalEmergencyPersistence().Init()
-	percounter.GlobalEmergencyPersistence().AddForPersistence(percounter.NewPersistentGCounter("a", "a.gcounter"))
-	percounter.GlobalEmergencyPersistence().AddForPersistence(percounter.NewPersistentGCounter("b", "b.gcounter"))
-	mc := percounter.NewZmqMultiGcounter("me", ".", ":5000")
-	mc.ShouldPersistOnSignal()
-	mc.Start()
+	if err := run(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	log.Println("exiting")
+}
+
+func run() error {
+	registry := percounter.NewEmergencyPersistence()
+	defer registry.StopSignals()
+
+	registry.AddForPersistence(percounter.NewPersistentGCounter("a", "a.gcounter"))
+	registry.AddForPersistence(percounter.NewPersistentGCounter("b", "b.gcounter"))
+	mc := percounter.NewZmqMultiGcounter("me", ".", "tcp://:5000")
+	mc.PersistVia(registry)
+	if err := mc.Start(); err != nil {
+		return err
+	}
 	defer mc.Stop()
 	mc.Increment("c")
 	mc.Increment("d")
 	log.Println("added 2 counters to persist in case of signals. Press Ctrl+C to persist and exit")
-	percounter.GlobalEmergencyPersistence().PersistAndExitOnSignal()
+	return registry.PersistOnSignal(percounter.DefaultShutdownTimeout).Err()
 }
@@ -2,24 +2,29 @@ package percounter
 
 import (
 	"fmt"
-	"log"
 	"math/rand/v2"
 	"os"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func waitForGcounterValueOf(t *testing.T, expectedValue int64, c ValueSource) {
+// waitFor polls cond for a while, returning whether it was met
+func waitFor(t *testing.T, cond func() bool) bool {
+	t.Helper()
 	for w := 0; w < 15; w++ {
-		if expectedValue == c.Value() {
-			// all ok
-			return
+		if cond() {
+			return true
 		}
-		log.Printf("waiting for the counter to arrive at the expected value of %d ...", expectedValue)
 		time.Sleep(100 * time.Millisecond)
 	}
+	return cond()
+}
+
+func waitForGcounterValueOf(t *testing.T, expectedValue int64, c ValueSource) {
+	waitFor(t, func() bool { return expectedValue == c.Value() })
 	assert.Equal(t, expectedValue, c.Value())
 }
 
@@ -45,3 +50,13 @@ func (sink *testGCounterStateSink) SetState(s GCounterState) {
 func randomPort() string {
 	return fmt.Sprint(5000 + rand.Int32N(2000))
 }
+
+func waitForSetLenOf(t *testing.T, expectedLen int, elements func() []string) {
+	waitFor(t, func() bool { return expectedLen == len(elements()) })
+	assert.Len(t, elements(), expectedLen)
+}
+
+func waitForSetElementsOf(t *testing.T, expected []string, elements func() []string) {
+	waitFor(t, func() bool { return slices.Equal(expected, elements()) })
+	assert.Equal(t, expected, elements())
+}
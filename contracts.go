@@ -3,8 +3,37 @@ package percounter
 const GCounterNetworkMessage = "g-counter.network.message"
 const PeerOhaiNetworkMessage = "peer.ohai.network.message"
 const PeerHelloNetworkMessage = "peer.hello.network.message"
+const GSetNetworkMessage = "g-set.network.message"
+const ORSetNetworkMessage = "or-set.network.message"
+const MaxRegisterNetworkMessage = "max-register.network.message"
+const MinRegisterNetworkMessage = "min-register.network.message"
+const LWWRegisterNetworkMessage = "lww-register.network.message"
+const BoundedCounterNetworkMessage = "bounded-counter.network.message"
+const BoundedCounterRightsRequestMessage = "bounded-counter.rights-request.network.message"
+const SwimPingNetworkMessage = "swim.ping.network.message"
+const SwimPingReqNetworkMessage = "swim.ping-req.network.message"
+const SwimAckNetworkMessage = "swim.ack.network.message"
+const AntiEntropyDigestMessage = "anti-entropy.digest.network.message"
+const MerkleSyncMessage = "merkle.sync.network.message"
+const BatchNetworkMessage = "batch.network.message"
+const RetirementPrepareMessage = "retirement.prepare.network.message"
+const RetirementAckMessage = "retirement.ack.network.message"
+const RetirementDoneMessage = "retirement.done.network.message"
 const MyIPKey = "my_ip"
 const MyTcpPortKey = "my_tcp_port"
+const MembersKey = "members"
+const SwimSeqKey = "swim_seq"
+const SwimTargetKey = "swim_target"
+const SwimTargetAddressKey = "swim_target_address"
+const AntiEntropyReplyKey = "reply"
+const AntiEntropyScopeKey = "scope"
+const ProtocolVersionKey = "protocol_version"
+const CapabilitiesKey = "capabilities"
+const InstanceKey = "instance"
+const RetirementSeqKey = "retirement_seq"
+const RetiringKey = "retiring"
+const RetirementRefusalKey = "refusal"
+const RetirementTimeoutKey = "retirement_timeout_ms"
 
 type GCounterStateSource interface {
 	GetState() GCounterState
@@ -14,6 +43,46 @@ type GCounterStateSink interface {
 	SetState(s GCounterState)
 }
 
+type GSetStateSource interface {
+	GetState() GSetState
+}
+
+type GSetStateSink interface {
+	SetGSetState(s GSetState)
+}
+
+type ORSetStateSource interface {
+	GetState() ORSetState
+}
+
+type ORSetStateSink interface {
+	SetORSetState(s ORSetState)
+}
+
+type RegisterStateSource interface {
+	GetState() RegisterState
+}
+
+type RegisterStateSink interface {
+	SetRegisterState(s RegisterState)
+}
+
+type LWWRegisterStateSource interface {
+	GetState() LWWRegisterState
+}
+
+type LWWRegisterStateSink interface {
+	SetLWWRegisterState(s LWWRegisterState)
+}
+
+type BoundedCounterStateSource interface {
+	GetState() BoundedCounterState
+}
+
+type CRDTStateSink interface {
+	SetCRDTState(typeTag, name string, snapshot CRDT)
+}
+
 type QueryableCounter interface {
 	Incrementable
 	ValueSource
@@ -23,6 +92,11 @@ type Persistent interface {
 	PersistSync()
 }
 
+// FalliblePersistent reports persistence errors instead of panicking
+type FalliblePersistent interface {
+	TryPersistSync() error
+}
+
 type ValueSource interface {
 	Value() int64
 }
@@ -32,6 +106,7 @@ type CountEvent struct {
 	Count int64
 }
 
+// ClusterObserver sees the messages as on the wire, i.e. possibly compressed
 type ClusterObserver interface {
 	AfterMessageSent(peer string, msg []byte)
 	AfterMessageReceived(peer string, msg []byte)
@@ -41,6 +116,47 @@ type CounterObserver interface {
 	OnNewCount(ev CountEvent)
 }
 
+type SetEvent struct {
+	Name     string
+	Elements []string
+}
+
+type SetObserver interface {
+	OnNewElements(ev SetEvent)
+}
+
+type ValueEvent struct {
+	Name  string
+	Value string
+}
+
+type ValueObserver interface {
+	OnNewValue(ev ValueEvent)
+}
+
+type CRDTEvent struct {
+	Type  string
+	Name  string
+	Value any
+}
+
+type CRDTObserver interface {
+	OnNewCRDTValue(ev CRDTEvent)
+}
+
+type PeerUpdater interface {
+	UpdatePeers(peers []string)
+}
+
+type PeerConfigObserver interface {
+	OnPeerConfig(c PeerConfig)
+	OnPeerConfigError(err error)
+}
+
+type IdentityCollisionObserver interface {
+	OnIdentityCollision(err *IdentityCollisionError)
+}
+
 type Incrementable interface {
 	Increment()
 }
@@ -53,3 +169,41 @@ func (n *noOpGcounterState) SetState(s GCounterState) {}
 type noOpCounterObserver struct{}
 
 func (n *noOpCounterObserver) OnNewCount(CountEvent) {}
+
+type noOpSetState struct{}
+
+func (n *noOpSetState) SetGSetState(s GSetState)   {}
+func (n *noOpSetState) SetORSetState(s ORSetState) {}
+
+type noOpSetObserver struct{}
+
+func (n *noOpSetObserver) OnNewElements(SetEvent) {}
+
+type noOpRegisterState struct{}
+
+func (n *noOpRegisterState) SetRegisterState(s RegisterState) {}
+
+type noOpLWWRegisterState struct{}
+
+func (n *noOpLWWRegisterState) SetLWWRegisterState(s LWWRegisterState) {}
+
+type noOpValueObserver struct{}
+
+func (n *noOpValueObserver) OnNewValue(ValueEvent) {}
+
+type noOpCRDTState struct{}
+
+func (n *noOpCRDTState) SetCRDTState(typeTag, name string, snapshot CRDT) {}
+
+type noOpCRDTObserver struct{}
+
+func (n *noOpCRDTObserver) OnNewCRDTValue(CRDTEvent) {}
+
+type noOpPeerConfigObserver struct{}
+
+func (n *noOpPeerConfigObserver) OnPeerConfig(PeerConfig) {}
+func (n *noOpPeerConfigObserver) OnPeerConfigError(error) {}
+
+type noOpIdentityCollisionObserver struct{}
+
+func (n *noOpIdentityCollisionObserver) OnIdentityCollision(*IdentityCollisionError) {}
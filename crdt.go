@@ -0,0 +1,86 @@
+package percounter
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// CRDT is a state-based replicated data type that can be hosted
+// by the generic persistence and replication plumbing
+type CRDT interface {
+	// Merge fails if the other replica is not of the same type
+	Merge(other CRDT) error
+	// Snapshot is a deep copy safe to use outside of the owning actor
+	Snapshot() CRDT
+	Marshal() ([]byte, error)
+	Unmarshal(b []byte) error
+	Value() any
+}
+
+// CRDTType describes a registered replicated type:
+// Tag is used in NetworkedGCounterState.Type and Extension for the persisted files
+type CRDTType struct {
+	Tag       string
+	Extension string
+	New       func(identity, name string) CRDT
+}
+
+var crdtRegistry = struct {
+	sync.RWMutex
+	types []CRDTType
+}{}
+
+func RegisterCRDTType(t CRDTType) error {
+	if t.Tag == "" || t.Extension == "" || t.New == nil {
+		return fmt.Errorf("incomplete CRDT type registration: %+v", t)
+	}
+	crdtRegistry.Lock()
+	defer crdtRegistry.Unlock()
+	for _, existing := range crdtRegistry.types {
+		if existing.Tag == t.Tag || existing.Extension == t.Extension {
+			return fmt.Errorf("CRDT type '%s' (%s) is already registered", t.Tag, t.Extension)
+		}
+	}
+	crdtRegistry.types = append(crdtRegistry.types, t)
+	return nil
+}
+
+func LookupCRDTType(tag string) (CRDTType, bool) {
+	crdtRegistry.RLock()
+	defer crdtRegistry.RUnlock()
+	for _, t := range crdtRegistry.types {
+		if t.Tag == tag {
+			return t, true
+		}
+	}
+	return CRDTType{}, false
+}
+
+func RegisteredCRDTTypes() []CRDTType {
+	crdtRegistry.RLock()
+	defer crdtRegistry.RUnlock()
+	return slices.Clone(crdtRegistry.types)
+}
+
+func lookupCRDTTypeByExtension(extension string) (CRDTType, bool) {
+	crdtRegistry.RLock()
+	defer crdtRegistry.RUnlock()
+	for _, t := range crdtRegistry.types {
+		if t.Extension == extension {
+			return t, true
+		}
+	}
+	return CRDTType{}, false
+}
+
+func mustRegisterCRDTType(t CRDTType) CRDTType {
+	if err := RegisterCRDTType(t); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func errIncompatibleCRDT(mine, other CRDT) error {
+	return fmt.Errorf("cannot merge %T into %T", other, mine)
+}
@@ -0,0 +1,293 @@
+package percounter
+
+import "encoding/json"
+
+// the built-in types, G-Counter being the first one
+var GCounterCRDTType = mustRegisterCRDTType(CRDTType{
+	Tag:       GCounterNetworkMessage,
+	Extension: ".gcounter",
+	New: func(identity, name string) CRDT {
+		return &gcounterCRDT{NewGCounterFromState(identity, NewNamedGcounterState(name))}
+	},
+})
+
+var GSetCRDTType = mustRegisterCRDTType(CRDTType{
+	Tag:       GSetNetworkMessage,
+	Extension: ".gset",
+	New: func(_, name string) CRDT {
+		return &gsetCRDT{NewGSetFromState(NewNamedGSetState(name))}
+	},
+})
+
+var ORSetCRDTType = mustRegisterCRDTType(CRDTType{
+	Tag:       ORSetNetworkMessage,
+	Extension: ".orset",
+	New: func(identity, name string) CRDT {
+		return &orsetCRDT{NewORSetFromState(identity, NewNamedORSetState(name))}
+	},
+})
+
+var MaxRegisterCRDTType = mustRegisterCRDTType(CRDTType{
+	Tag:       MaxRegisterNetworkMessage,
+	Extension: ".maxreg",
+	New: func(_, name string) CRDT {
+		return newRegisterCRDT(NewNamedRegisterState(name, MaxRegisterKind))
+	},
+})
+
+var MinRegisterCRDTType = mustRegisterCRDTType(CRDTType{
+	Tag:       MinRegisterNetworkMessage,
+	Extension: ".minreg",
+	New: func(_, name string) CRDT {
+		return newRegisterCRDT(NewNamedRegisterState(name, MinRegisterKind))
+	},
+})
+
+var LWWRegisterCRDTType = mustRegisterCRDTType(CRDTType{
+	Tag:       LWWRegisterNetworkMessage,
+	Extension: ".lwwreg",
+	New: func(identity, name string) CRDT {
+		return &lwwRegisterCRDT{NewLWWRegisterFromState(identity, NewNamedLWWRegisterState(name))}
+	},
+})
+
+var BoundedCounterCRDTType = mustRegisterCRDTType(CRDTType{
+	Tag:       BoundedCounterNetworkMessage,
+	Extension: ".bcounter",
+	New: func(identity, name string) CRDT {
+		return &boundedCounterCRDT{NewBoundedCounterFromState(identity, NewNamedBoundedCounterState(name))}
+	},
+})
+
+type gcounterCRDT struct {
+	*GCounter
+}
+
+func (c *gcounterCRDT) Merge(other CRDT) error {
+	o, ok := other.(*gcounterCRDT)
+	if !ok {
+		return errIncompatibleCRDT(c, other)
+	}
+	c.MergeWith(o)
+	return nil
+}
+
+func (c *gcounterCRDT) Snapshot() CRDT {
+	return &gcounterCRDT{NewGCounterFromState(c.identity, c.state.Copy())}
+}
+
+func (c *gcounterCRDT) Marshal() ([]byte, error) {
+	return json.Marshal(c.state)
+}
+
+func (c *gcounterCRDT) Unmarshal(b []byte) error {
+	state := NewNamedGcounterState(c.state.Name)
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	if state.Name == "" {
+		state.Name = c.state.Name
+	}
+	if state.Peers == nil {
+		state.Peers = make(map[string]int64)
+	}
+	c.state = state
+	return nil
+}
+
+func (c *gcounterCRDT) Value() any {
+	return c.GCounter.Value()
+}
+
+type gsetCRDT struct {
+	*GSet
+}
+
+func (s *gsetCRDT) Merge(other CRDT) error {
+	o, ok := other.(*gsetCRDT)
+	if !ok {
+		return errIncompatibleCRDT(s, other)
+	}
+	s.MergeWith(o)
+	return nil
+}
+
+func (s *gsetCRDT) Snapshot() CRDT {
+	return &gsetCRDT{NewGSetFromState(s.state.Copy())}
+}
+
+func (s *gsetCRDT) Marshal() ([]byte, error) {
+	return json.Marshal(s.state)
+}
+
+func (s *gsetCRDT) Unmarshal(b []byte) error {
+	state := NewNamedGSetState(s.state.Name)
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	if state.Name == "" {
+		state.Name = s.state.Name
+	}
+	*s.GSet = *NewGSetFromState(state)
+	return nil
+}
+
+func (s *gsetCRDT) Value() any {
+	return s.Elements()
+}
+
+type orsetCRDT struct {
+	*ORSet
+}
+
+func (s *orsetCRDT) Merge(other CRDT) error {
+	o, ok := other.(*orsetCRDT)
+	if !ok {
+		return errIncompatibleCRDT(s, other)
+	}
+	s.MergeWith(o)
+	return nil
+}
+
+func (s *orsetCRDT) Snapshot() CRDT {
+	return &orsetCRDT{NewORSetFromState(s.identity, s.state.Copy())}
+}
+
+func (s *orsetCRDT) Marshal() ([]byte, error) {
+	return json.Marshal(s.state)
+}
+
+func (s *orsetCRDT) Unmarshal(b []byte) error {
+	state := NewNamedORSetState(s.state.Name)
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	if state.Name == "" {
+		state.Name = s.state.Name
+	}
+	*s.ORSet = *NewORSetFromState(s.identity, state)
+	return nil
+}
+
+func (s *orsetCRDT) Value() any {
+	return s.Elements()
+}
+
+type registerCRDT struct {
+	*extremumRegister
+}
+
+func newRegisterCRDT(state RegisterState) *registerCRDT {
+	r := newExtremumRegister(state)
+	return &registerCRDT{&r}
+}
+
+func (r *registerCRDT) Merge(other CRDT) error {
+	o, ok := other.(*registerCRDT)
+	if !ok || o.state.Kind != r.state.Kind {
+		return errIncompatibleCRDT(r, other)
+	}
+	r.MergeWith(o)
+	return nil
+}
+
+func (r *registerCRDT) Snapshot() CRDT {
+	return newRegisterCRDT(r.state)
+}
+
+func (r *registerCRDT) Marshal() ([]byte, error) {
+	return json.Marshal(r.state)
+}
+
+func (r *registerCRDT) Unmarshal(b []byte) error {
+	state := r.state
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	if state.Name == "" {
+		state.Name = r.state.Name
+	}
+	// the kind is defined by the registered type
+	state.Kind = r.state.Kind
+	r.state = state
+	return nil
+}
+
+func (r *registerCRDT) Value() any {
+	return r.extremumRegister.Value()
+}
+
+type lwwRegisterCRDT struct {
+	*LWWRegister
+}
+
+func (r *lwwRegisterCRDT) Merge(other CRDT) error {
+	o, ok := other.(*lwwRegisterCRDT)
+	if !ok {
+		return errIncompatibleCRDT(r, other)
+	}
+	r.MergeWith(o)
+	return nil
+}
+
+func (r *lwwRegisterCRDT) Snapshot() CRDT {
+	return &lwwRegisterCRDT{NewLWWRegisterFromState(r.identity, r.state)}
+}
+
+func (r *lwwRegisterCRDT) Marshal() ([]byte, error) {
+	return json.Marshal(r.state)
+}
+
+func (r *lwwRegisterCRDT) Unmarshal(b []byte) error {
+	state := NewNamedLWWRegisterState(r.state.Name)
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	if state.Name == "" {
+		state.Name = r.state.Name
+	}
+	r.state = state
+	r.clock.Update(state.Timestamp)
+	return nil
+}
+
+func (r *lwwRegisterCRDT) Value() any {
+	return r.LWWRegister.Value()
+}
+
+type boundedCounterCRDT struct {
+	*BoundedCounter
+}
+
+func (c *boundedCounterCRDT) Merge(other CRDT) error {
+	o, ok := other.(*boundedCounterCRDT)
+	if !ok {
+		return errIncompatibleCRDT(c, other)
+	}
+	c.MergeWith(o)
+	return nil
+}
+
+func (c *boundedCounterCRDT) Snapshot() CRDT {
+	return &boundedCounterCRDT{NewBoundedCounterFromState(c.identity, c.GetState().Copy())}
+}
+
+func (c *boundedCounterCRDT) Marshal() ([]byte, error) {
+	return json.Marshal(c.GetState())
+}
+
+func (c *boundedCounterCRDT) Unmarshal(b []byte) error {
+	state := NewNamedBoundedCounterState(c.state.Name)
+	if err := json.Unmarshal(b, &state); err != nil {
+		return err
+	}
+	if state.Name == "" {
+		state.Name = c.state.Name
+	}
+	*c.BoundedCounter = *NewBoundedCounterFromState(c.identity, state)
+	return nil
+}
+
+func (c *boundedCounterCRDT) Value() any {
+	return c.BoundedCounter.Value()
+}
@@ -0,0 +1,100 @@
+package percounter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFlagNetworkMessage = "test-flag.network.message"
+
+// a flag that can only be raised, registered to test the generic plumbing
+var testFlagCRDTType = mustRegisterCRDTType(CRDTType{
+	Tag:       testFlagNetworkMessage,
+	Extension: ".testflag",
+	New: func(_, _ string) CRDT {
+		return &testFlag{}
+	},
+})
+
+type testFlag struct {
+	Raised bool `json:"raised"`
+}
+
+func (f *testFlag) Merge(other CRDT) error {
+	o, ok := other.(*testFlag)
+	if !ok {
+		return errIncompatibleCRDT(f, other)
+	}
+	f.Raised = f.Raised || o.Raised
+	return nil
+}
+
+func (f *testFlag) Snapshot() CRDT           { return &testFlag{f.Raised} }
+func (f *testFlag) Marshal() ([]byte, error) { return json.Marshal(f) }
+func (f *testFlag) Unmarshal(b []byte) error { return json.Unmarshal(b, f) }
+func (f *testFlag) Value() any               { return f.Raised }
+
+func raiseTestFlag(c CRDT) bool {
+	c.(*testFlag).Raised = true
+	return true
+}
+
+func TestCRDTRegistry(t *testing.T) {
+	t.Run("built-in types are registered, g-counter first", func(t *testing.T) {
+		types := RegisteredCRDTTypes()
+		require.NotEmpty(t, types)
+		assert.Equal(t, GCounterNetworkMessage, types[0].Tag)
+		for _, tag := range []string{
+			GSetNetworkMessage,
+			ORSetNetworkMessage,
+			MaxRegisterNetworkMessage,
+			MinRegisterNetworkMessage,
+			LWWRegisterNetworkMessage,
+		} {
+			_, ok := LookupCRDTType(tag)
+			assert.True(t, ok, tag)
+		}
+	})
+
+	t.Run("tags and extensions are unique", func(t *testing.T) {
+		assert.Error(t, RegisterCRDTType(CRDTType{
+			Tag:       GCounterNetworkMessage,
+			Extension: ".other",
+			New:       testFlagCRDTType.New,
+		}))
+		assert.Error(t, RegisterCRDTType(CRDTType{
+			Tag:       "other",
+			Extension: ".gcounter",
+			New:       testFlagCRDTType.New,
+		}))
+		assert.Error(t, RegisterCRDTType(CRDTType{Tag: "incomplete"}))
+	})
+
+	t.Run("merging different types fails", func(t *testing.T) {
+		counter := GCounterCRDTType.New("1", "c")
+		assert.Error(t, counter.Merge(GSetCRDTType.New("1", "s")))
+		assert.Error(t, MaxRegisterCRDTType.New("1", "r").Merge(MinRegisterCRDTType.New("1", "r")))
+	})
+
+	t.Run("snapshots are independent", func(t *testing.T) {
+		counter := GCounterCRDTType.New("1", "c").(*gcounterCRDT)
+		snapshot := counter.Snapshot()
+		counter.Increment()
+		assert.Equal(t, int64(1), counter.Value())
+		assert.Equal(t, int64(0), snapshot.Value())
+	})
+
+	t.Run("marshalling round trip", func(t *testing.T) {
+		for _, crdtType := range RegisteredCRDTTypes() {
+			original := crdtType.New("1", "name")
+			b, err := original.Marshal()
+			require.NoError(t, err)
+			restored := crdtType.New("1", "name")
+			require.NoError(t, restored.Unmarshal(b), crdtType.Tag)
+			assert.Equal(t, original.Value(), restored.Value(), crdtType.Tag)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package percounter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+// Resolver is satisfied by net.Resolver and can be replaced by a stub
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSDiscoveryConfig: with Service set, SRV records of _Service._Proto.Name are resolved,
+// otherwise the A/AAAA records of Name are combined with Port.
+// Self is an address of this node to leave out of the peers
+type DNSDiscoveryConfig struct {
+	Name     string
+	Port     string
+	Service  string
+	Proto    string
+	Self     string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+func DefaultDNSDiscoveryConfig(name, port string) DNSDiscoveryConfig {
+	return DNSDiscoveryConfig{
+		Name:     name,
+		Port:     port,
+		Interval: 10 * time.Second,
+		Timeout:  5 * time.Second,
+	}
+}
+
+// DNSDiscovery periodically resolves the peers and feeds the changes to the target.
+// Failed lookups are logged, leaving the peers as they were
+type DNSDiscovery struct {
+	phony.Inbox
+	config   DNSDiscoveryConfig
+	resolver Resolver
+	target   PeerUpdater
+	peers    []string
+	resolved bool
+	stop     chan struct{}
+}
+
+func NewDNSDiscovery(config DNSDiscoveryConfig, target PeerUpdater) *DNSDiscovery {
+	return NewDNSDiscoveryWithResolver(config, net.DefaultResolver, target)
+}
+
+func NewDNSDiscoveryWithResolver(config DNSDiscoveryConfig, resolver Resolver, target PeerUpdater) *DNSDiscovery {
+	return &DNSDiscovery{
+		config:   config,
+		resolver: resolver,
+		target:   target,
+		peers:    []string{},
+	}
+}
+
+// Start resolves the peers once, returning the error of the first lookup, and keeps polling
+func (d *DNSDiscovery) Start() error {
+	var err error
+	phony.Block(d, func() {
+		err = d.refreshSync()
+		if d.stop != nil || d.config.Interval <= 0 {
+			return
+		}
+		d.stop = make(chan struct{})
+		go d.pollLoop(d.config.Interval, d.stop)
+	})
+	return err
+}
+
+func (d *DNSDiscovery) Stop() {
+	phony.Block(d, func() {
+		if d.stop == nil {
+			return
+		}
+		close(d.stop)
+		d.stop = nil
+	})
+}
+
+func (d *DNSDiscovery) Refresh() error {
+	var err error
+	phony.Block(d, func() {
+		err = d.refreshSync()
+	})
+	return err
+}
+
+// Peers are the addresses of the last successful lookup
+func (d *DNSDiscovery) Peers() []string {
+	var res []string
+	phony.Block(d, func() {
+		res = slices.Clone(d.peers)
+	})
+	return res
+}
+
+func (d *DNSDiscovery) pollLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			d.Act(d, func() {
+				_ = d.refreshSync()
+			})
+		}
+	}
+}
+
+func (d *DNSDiscovery) refreshSync() error {
+	ctx := context.Background()
+	if d.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.config.Timeout)
+		defer cancel()
+	}
+	peers, err := d.resolveSync(ctx)
+	if err != nil {
+		log.Printf("dns discovery of %s failed, keeping %d peers: %v", d.config.Name, len(d.peers), err)
+		return err
+	}
+	peers = slices.DeleteFunc(peers, func(peer string) bool {
+		return peer == d.config.Self
+	})
+	if d.resolved && slices.Equal(peers, d.peers) {
+		return nil
+	}
+	d.peers = peers
+	d.resolved = true
+	log.Printf("dns discovery of %s: %v", d.config.Name, peers)
+	d.target.UpdatePeers(slices.Clone(peers))
+	return nil
+}
+
+func (d *DNSDiscovery) resolveSync(ctx context.Context) ([]string, error) {
+	if d.config.Service == "" {
+		return d.resolveHostSync(ctx, d.config.Name, d.config.Port)
+	}
+	_, records, err := d.resolver.LookupSRV(ctx, d.config.Service, d.config.Proto, d.config.Name)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, srv := range records {
+		addresses, err := d.resolveHostSync(ctx, srv.Target, strconv.Itoa(int(srv.Port)))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, addresses...)
+	}
+	slices.Sort(res)
+	return slices.Compact(res), nil
+}
+
+func (d *DNSDiscovery) resolveHostSync(ctx context.Context, host, port string) ([]string, error) {
+	if port == "" {
+		return nil, fmt.Errorf("no port configured for %s", host)
+	}
+	ips, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, ip := range ips {
+		res = append(res, zmqAddressOf(ip.IP.String(), port))
+	}
+	slices.Sort(res)
+	return slices.Compact(res), nil
+}
@@ -0,0 +1,160 @@
+package percounter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Arceliar/phony"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubResolver struct {
+	phony.Inbox
+	hosts map[string][]string
+	srv   map[string][]*net.SRV
+	err   error
+}
+
+func newStubResolver() *stubResolver {
+	return &stubResolver{
+		hosts: map[string][]string{},
+		srv:   map[string][]*net.SRV{},
+	}
+}
+
+func (r *stubResolver) SetHost(host string, ips ...string) {
+	phony.Block(r, func() {
+		r.hosts[host] = ips
+	})
+}
+
+func (r *stubResolver) SetError(err error) {
+	phony.Block(r, func() {
+		r.err = err
+	})
+}
+
+func (r *stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var res []net.IPAddr
+	var err error
+	phony.Block(r, func() {
+		if r.err != nil {
+			err = r.err
+			return
+		}
+		ips, ok := r.hosts[host]
+		if !ok {
+			err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+			return
+		}
+		for _, ip := range ips {
+			res = append(res, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+	})
+	return res, err
+}
+
+func (r *stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	var res []*net.SRV
+	var err error
+	cname := "_" + service + "._" + proto + "." + name
+	phony.Block(r, func() {
+		if r.err != nil {
+			err = r.err
+			return
+		}
+		res = r.srv[cname]
+	})
+	return cname, res, err
+}
+
+func TestDNSDiscovery(t *testing.T) {
+	t.Run("A/AAAA records", func(t *testing.T) {
+		resolver := newStubResolver()
+		resolver.SetHost("percounter.local", "10.0.0.2", "::1", "10.0.0.1")
+		target := &testPeerUpdater{}
+		d := NewDNSDiscoveryWithResolver(DNSDiscoveryConfig{Name: "percounter.local", Port: "5001"}, resolver, target)
+		require.NoError(t, d.Start())
+		defer d.Stop()
+
+		expected := []string{"tcp://[10.0.0.1]:5001", "tcp://[10.0.0.2]:5001", "tcp://[::1]:5001"}
+		assert.Equal(t, expected, d.Peers())
+		assert.Equal(t, [][]string{expected}, target.Seen())
+
+		// unchanged
+		assert.NoError(t, d.Refresh())
+		assert.Len(t, target.Seen(), 1)
+	})
+
+	t.Run("SRV records", func(t *testing.T) {
+		resolver := newStubResolver()
+		resolver.SetHost("a.percounter.local", "10.0.0.1")
+		resolver.SetHost("b.percounter.local", "10.0.0.2")
+		resolver.srv["_percounter._tcp.percounter.local"] = []*net.SRV{
+			{Target: "b.percounter.local", Port: 5002},
+			{Target: "a.percounter.local", Port: 5001},
+		}
+		target := &testPeerUpdater{}
+		config := DNSDiscoveryConfig{Name: "percounter.local", Service: "percounter", Proto: "tcp"}
+		d := NewDNSDiscoveryWithResolver(config, resolver, target)
+		require.NoError(t, d.Refresh())
+		assert.Equal(t, []string{"tcp://[10.0.0.1]:5001", "tcp://[10.0.0.2]:5002"}, d.Peers())
+	})
+
+	t.Run("leaving out self", func(t *testing.T) {
+		resolver := newStubResolver()
+		resolver.SetHost("percounter.local", "10.0.0.1", "10.0.0.2")
+		config := DNSDiscoveryConfig{Name: "percounter.local", Port: "5001", Self: "tcp://[10.0.0.1]:5001"}
+		d := NewDNSDiscoveryWithResolver(config, resolver, &testPeerUpdater{})
+		require.NoError(t, d.Refresh())
+		assert.Equal(t, []string{"tcp://[10.0.0.2]:5001"}, d.Peers())
+	})
+
+	t.Run("failed lookups keep the peers", func(t *testing.T) {
+		resolver := newStubResolver()
+		resolver.SetHost("percounter.local", "10.0.0.1")
+		target := &testPeerUpdater{}
+		config := DNSDiscoveryConfig{Name: "percounter.local", Port: "5001", Interval: 50 * time.Millisecond}
+		d := NewDNSDiscoveryWithResolver(config, resolver, target)
+		require.NoError(t, d.Start())
+		defer d.Stop()
+
+		resolver.SetError(errors.New("server misbehaving"))
+		assert.Error(t, d.Refresh())
+		assert.Equal(t, []string{"tcp://[10.0.0.1]:5001"}, d.Peers())
+
+		// picked up by polling
+		resolver.SetError(nil)
+		resolver.SetHost("percounter.local", "10.0.0.1", "10.0.0.3")
+		updates := target.WaitForSeen(t, 2)
+		assert.Equal(t, []string{"tcp://[10.0.0.1]:5001", "tcp://[10.0.0.3]:5001"}, updates[1])
+	})
+
+	t.Run("a port is required for A/AAAA records", func(t *testing.T) {
+		d := NewDNSDiscoveryWithResolver(DNSDiscoveryConfig{Name: "percounter.local"}, newStubResolver(), &testPeerUpdater{})
+		assert.Error(t, d.Refresh())
+	})
+
+	t.Run("feeding a cluster node", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		defer c1.Stop()
+		assert.NoError(t, c1.Start())
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		defer c2.Stop()
+		assert.NoError(t, c2.Start())
+
+		resolver := newStubResolver()
+		resolver.SetHost("c2.local", "127.0.0.1")
+		d := NewDNSDiscoveryWithResolver(DNSDiscoveryConfig{Name: "c2.local", Port: port2}, resolver, c1)
+		require.NoError(t, d.Refresh())
+
+		c1.Increment("x")
+		waitForMultiGcounterValueOf(t, 1, c2, "x")
+	})
+}
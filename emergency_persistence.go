@@ -1,22 +1,253 @@
 package percounter
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"slices"
 	"sync"
 	"syscall"
+	"time"
 )
 
+const DefaultShutdownTimeout = 5 * time.Second
+
+// DefaultPersistencePriority is the priority of instances added without one
+const DefaultPersistencePriority = 0
+
 var globalEmergencyPersistence EmergencyPersistence
 
+// EmergencyPersistence persists the registered instances on shutdown,
+// in the order of descending priority, then in the order of registration
 type EmergencyPersistence struct {
-	toPersist sync.Map
-	signals   chan os.Signal
-	done      chan bool
+	mutex         sync.Mutex
+	toPersist     map[Persistent]persistenceEntry
+	nextSeq       uint64
+	notifyOn      []os.Signal
+	noSignals     bool
+	signals       chan os.Signal
+	signalsHooked bool
+	abandoned     []chan struct{}
+}
+
+type persistenceEntry struct {
+	priority int
+	timeout  time.Duration
+	seq      uint64
+}
+
+// PersistenceOption configures how a registered instance is persisted
+type PersistenceOption func(*persistenceEntry)
+
+// PersistWithPriority persists the instance before those of a lower priority
+func PersistWithPriority(priority int) PersistenceOption {
+	return func(e *persistenceEntry) {
+		e.priority = priority
+	}
+}
+
+// PersistWithin limits the time to persist the instance, 0 meaning no limit
+func PersistWithin(timeout time.Duration) PersistenceOption {
+	return func(e *persistenceEntry) {
+		e.timeout = timeout
+	}
+}
+
+// PersistenceResult is the outcome of persisting one instance
+type PersistenceResult struct {
+	Persistent Persistent
+	Priority   int
+	Duration   time.Duration
+	Err        error
+}
+
+// PersistenceReport lists the results in the order of persistence
+type PersistenceReport struct {
+	Results []PersistenceResult
+}
+
+func (r PersistenceReport) Succeeded() []PersistenceResult {
+	return r.filter(func(res PersistenceResult) bool { return res.Err == nil })
+}
+
+func (r PersistenceReport) Failed() []PersistenceResult {
+	return r.filter(func(res PersistenceResult) bool { return res.Err != nil })
+}
+
+// Err joins the errors of the failed instances
+func (r PersistenceReport) Err() error {
+	var errs []error
+	for _, res := range r.Failed() {
+		errs = append(errs, res.Err)
+	}
+	return errors.Join(errs...)
+}
+
+func (r PersistenceReport) filter(f func(PersistenceResult) bool) []PersistenceResult {
+	res := []PersistenceResult{}
+	for _, result := range r.Results {
+		if f(result) {
+			res = append(res, result)
+		}
+	}
+	return res
+}
+
+// NewEmergencyPersistence creates a registry independent of the global one,
+// persisting on the given signals, or on HUP, INT, TERM and QUIT if none are given
+func NewEmergencyPersistence(signals ...os.Signal) *EmergencyPersistence {
+	return &EmergencyPersistence{
+		notifyOn: signals,
+	}
+}
+
+// NewEmergencyPersistenceWithoutSignals creates a registry not listening to any signals,
+// persisting only when flushed, e.g. via PersistOnContextDone
+func NewEmergencyPersistenceWithoutSignals() *EmergencyPersistence {
+	return &EmergencyPersistence{
+		noSignals: true,
+	}
 }
 
 func (s *EmergencyPersistence) Init() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.initSync()
+}
+
+// AddForPersistence registers an instance with the DefaultPersistencePriority and no timeout, unless configured otherwise.
+// Adding an instance again replaces its options
+func (s *EmergencyPersistence) AddForPersistence(p Persistent, options ...PersistenceOption) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.initSync()
+	existing, ok := s.toPersist[p]
+	entry := persistenceEntry{
+		priority: DefaultPersistencePriority,
+		seq:      existing.seq,
+	}
+	if !ok {
+		entry.seq = s.nextSeq
+		s.nextSeq++
+	}
+	for _, option := range options {
+		option(&entry)
+	}
+	s.toPersist[p] = entry
+}
+
+func (s *EmergencyPersistence) RemoveFromPersistence(p Persistent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.toPersist, p)
+}
+
+// Shutdown persists all registered instances, giving up once ctx is done.
+// Instances failing to persist are reported in the returned error
+func (s *EmergencyPersistence) Shutdown(ctx context.Context) error {
+	return s.Flush(ctx).Err()
+}
+
+// Flush persists all registered instances in order, reporting the outcome for each.
+// Once ctx is done, the remaining instances are reported as failed.
+// Instances timing out keep persisting in the background, see WaitForAbandoned
+func (s *EmergencyPersistence) Flush(ctx context.Context) PersistenceReport {
+	s.mutex.Lock()
+	items := s.orderedSync()
+	s.mutex.Unlock()
+
+	report := PersistenceReport{Results: []PersistenceResult{}}
+	for _, item := range items {
+		start := time.Now()
+		err := s.persistWithin(ctx, item.Persistent, item.timeout)
+		report.Results = append(report.Results, PersistenceResult{
+			Persistent: item.Persistent,
+			Priority:   item.Priority,
+			Duration:   time.Since(start),
+			Err:        err,
+		})
+	}
+	return report
+}
+
+// PersistOnContextDone blocks until ctx is done, e.g. via signal.NotifyContext,
+// then persists all registered instances within the timeout, leaving the exit to the caller
+func (s *EmergencyPersistence) PersistOnContextDone(ctx context.Context, timeout time.Duration) error {
+	<-ctx.Done()
+	log.Printf("%v, persisting", context.Cause(ctx))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// PersistOnSignal blocks until one of the signals is received,
+// then persists all registered instances within the timeout
+func (s *EmergencyPersistence) PersistOnSignal(timeout time.Duration) PersistenceReport {
+	s.Init()
+	sig := <-s.signals
+	log.Printf("Received signal: %v, persisting", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.Flush(ctx)
+}
+
+// PersistAndExitOnSignal persists all registered instances on a signal and exits the process
+func (s *EmergencyPersistence) PersistAndExitOnSignal() {
+	s.mutex.Lock()
+	initialized := s.signals != nil
+	s.mutex.Unlock()
+	if !initialized {
+		return
+	}
+	if err := s.PersistOnSignal(DefaultShutdownTimeout).Err(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	log.Println("exiting")
+	os.Exit(0)
+}
+
+// WaitForAbandoned waits for the instances Flush gave up on to finish persisting, e.g. before exiting the process
+func (s *EmergencyPersistence) WaitForAbandoned(ctx context.Context) error {
+	s.mutex.Lock()
+	abandoned := s.abandoned
+	s.mutex.Unlock()
+	for _, finished := range abandoned {
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.abandoned = slices.DeleteFunc(s.abandoned, func(finished chan struct{}) bool {
+		return slices.Contains(abandoned, finished)
+	})
+	return nil
+}
+
+// StopSignals stops listening to the signals, also if called before adding any instances
+func (s *EmergencyPersistence) StopSignals() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.signals == nil {
+		s.signals = make(chan os.Signal, 1)
+	}
+	if s.signalsHooked {
+		signal.Stop(s.signals)
+		s.signalsHooked = false
+	}
+}
+
+func (s *EmergencyPersistence) initSync() {
+	if s.toPersist == nil {
+		s.toPersist = map[Persistent]persistenceEntry{}
+	}
 	if s.signals != nil {
 		// already initialized
 		return
@@ -24,45 +255,98 @@ func (s *EmergencyPersistence) Init() {
 
 	// initialize on demand or upon first add
 	s.signals = make(chan os.Signal, 1)
-	s.done = make(chan bool, 1)
-	signal.Notify(s.signals,
-		syscall.SIGHUP,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGQUIT,
-	)
+	if s.noSignals {
+		return
+	}
+	notifyOn := s.notifyOn
+	if len(notifyOn) == 0 {
+		notifyOn = []os.Signal{
+			syscall.SIGHUP,
+			syscall.SIGINT,
+			syscall.SIGTERM,
+			syscall.SIGQUIT,
+		}
+	}
+	signal.Notify(s.signals, notifyOn...)
+	s.signalsHooked = true
 }
 
-func (s *EmergencyPersistence) AddForPersistence(p Persistent) {
-	s.Init()
-	s.toPersist.Store(p, true)
+// Registered lists the registered instances in the order of persistence
+func (s *EmergencyPersistence) Registered() []Persistent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res := []Persistent{}
+	for _, item := range s.orderedSync() {
+		res = append(res, item.Persistent)
+	}
+	return res
 }
 
-func (s *EmergencyPersistence) PersistAndExitOnSignal() {
-	if s.signals == nil {
-		return
+func (s *EmergencyPersistence) orderedSync() []orderedPersistent {
+	type item struct {
+		p     Persistent
+		entry persistenceEntry
 	}
-	go func() {
-		sig := <-s.signals
-		log.Printf("Received signal: %v, persisting", sig)
-		s.toPersist.Range(func(p, _ any) bool {
-			p.(Persistent).PersistSync()
-			log.Println(".")
-			return true
+	items := []item{}
+	for p, entry := range s.toPersist {
+		items = append(items, item{p, entry})
+	}
+	slices.SortFunc(items, func(a, b item) int {
+		return cmp.Or(
+			cmp.Compare(b.entry.priority, a.entry.priority),
+			cmp.Compare(a.entry.seq, b.entry.seq),
+		)
+	})
+	res := []orderedPersistent{}
+	for _, i := range items {
+		res = append(res, orderedPersistent{
+			PersistenceResult: PersistenceResult{Persistent: i.p, Priority: i.entry.priority},
+			timeout:           i.entry.timeout,
 		})
-		s.done <- true
-	}()
-	<-s.done
-	log.Println("exiting")
-	os.Exit(0)
+	}
+	return res
 }
 
-func GlobalEmergencyPersistence() *EmergencyPersistence {
-	return &globalEmergencyPersistence
+type orderedPersistent struct {
+	PersistenceResult
+	timeout time.Duration
+}
+
+// persistWithin gives up on p once the timeout elapses, tracking the persistence left running as abandoned
+func (s *EmergencyPersistence) persistWithin(ctx context.Context, p Persistent, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("persisting on shutdown: %w", err)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		done <- tryPersist(p)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		s.mutex.Lock()
+		s.abandoned = append(s.abandoned, finished)
+		s.mutex.Unlock()
+		return fmt.Errorf("persisting on shutdown: %w", ctx.Err())
+	}
 }
 
-func init() {
-	globalEmergencyPersistence = EmergencyPersistence{
-		toPersist: sync.Map{},
+func tryPersist(p Persistent) error {
+	if fallible, ok := p.(FalliblePersistent); ok {
+		return fallible.TryPersistSync()
 	}
+	p.PersistSync()
+	return nil
+}
+
+func GlobalEmergencyPersistence() *EmergencyPersistence {
+	return &globalEmergencyPersistence
 }
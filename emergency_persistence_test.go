@@ -0,0 +1,215 @@
+package percounter
+
+import (
+	"context"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Arceliar/phony"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmergencyPersistence(t *testing.T) {
+	t.Run("shutdown persists all instances", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		a := &testPersistent{}
+		b := &testPersistent{}
+		s.AddForPersistence(a)
+		s.AddForPersistence(b)
+
+		require.NoError(t, s.Shutdown(context.Background()))
+		assert.Equal(t, 1, a.Persisted())
+		assert.Equal(t, 1, b.Persisted())
+	})
+
+	t.Run("persistence errors are returned", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		filename := path.Join(t.TempDir(), "missing", "c.gcounter")
+		s.AddForPersistence(NewPersistentGCounter("1", filename))
+
+		assert.Error(t, s.Shutdown(context.Background()))
+	})
+
+	t.Run("shutdown gives up at the deadline", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		s.AddForPersistence(&testPersistent{delay: time.Second})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := s.Shutdown(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("instances are persisted once the context is done", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		filename := path.Join(t.TempDir(), "c.gcounter")
+		c := NewPersistentGCounter("1", filename)
+		s.AddForPersistence(c)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- s.PersistOnContextDone(ctx, time.Second)
+		}()
+		c.Increment()
+		cancel()
+		require.NoError(t, <-done)
+		assert.Equal(t, int64(1), NewPersistentGCounter("1", filename).Value())
+	})
+}
+
+func TestConfigurableEmergencyPersistence(t *testing.T) {
+	t.Run("instances are persisted by descending priority, then in the order added", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		low := &testPersistent{}
+		first := &testPersistent{}
+		second := &testPersistent{}
+		high := &testPersistent{}
+		s.AddForPersistence(low, PersistWithPriority(-1))
+		s.AddForPersistence(first)
+		s.AddForPersistence(second)
+		s.AddForPersistence(high, PersistWithPriority(10))
+
+		report := s.Flush(context.Background())
+		assert.Equal(t, []Persistent{high, first, second, low}, persistentsOf(report.Results))
+		assert.Equal(t, []int{10, 0, 0, -1}, prioritiesOf(report.Results))
+		assert.Len(t, report.Succeeded(), 4)
+		assert.Empty(t, report.Failed())
+		assert.NoError(t, report.Err())
+	})
+
+	t.Run("removed instances are not persisted", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		kept := &testPersistent{}
+		removed := &testPersistent{}
+		s.AddForPersistence(kept)
+		s.AddForPersistence(removed)
+		s.RemoveFromPersistence(removed)
+
+		require.NoError(t, s.Shutdown(context.Background()))
+		assert.Equal(t, 1, kept.Persisted())
+		assert.Equal(t, 0, removed.Persisted())
+	})
+
+	t.Run("slow instances time out individually", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		slow := &testPersistent{delay: 300 * time.Millisecond}
+		fast := &testPersistent{}
+		s.AddForPersistence(slow, PersistWithPriority(1), PersistWithin(50*time.Millisecond))
+		s.AddForPersistence(fast)
+
+		report := s.Flush(context.Background())
+		assert.Equal(t, []Persistent{fast}, persistentsOf(report.Succeeded()))
+		require.Len(t, report.Failed(), 1)
+		assert.Equal(t, slow, report.Failed()[0].Persistent)
+		assert.ErrorIs(t, report.Err(), context.DeadlineExceeded)
+		assert.Equal(t, 1, fast.Persisted())
+
+		// the slow instance keeps persisting in the background
+		assert.Equal(t, 0, slow.Persisted())
+		require.NoError(t, s.WaitForAbandoned(context.Background()))
+		assert.Equal(t, 1, slow.Persisted())
+		require.NoError(t, s.WaitForAbandoned(context.Background()))
+	})
+
+	t.Run("adding an instance again replaces its options", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		a := &testPersistent{}
+		b := &testPersistent{}
+		s.AddForPersistence(a, PersistWithPriority(1))
+		s.AddForPersistence(b)
+		s.AddForPersistence(a)
+
+		assert.Equal(t, []Persistent{a, b}, s.Registered())
+	})
+
+	t.Run("registries without signals persist when flushed", func(t *testing.T) {
+		s := NewEmergencyPersistenceWithoutSignals()
+		p := &testPersistent{}
+		s.AddForPersistence(p)
+		assert.False(t, s.signalsHooked)
+
+		require.NoError(t, s.Shutdown(context.Background()))
+		assert.Equal(t, 1, p.Persisted())
+	})
+
+	t.Run("instances are persisted on custom signals", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR1)
+		defer s.StopSignals()
+		p := &testPersistent{}
+		s.AddForPersistence(p)
+
+		done := make(chan PersistenceReport, 1)
+		go func() {
+			done <- s.PersistOnSignal(time.Second)
+		}()
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+		report := <-done
+		assert.Len(t, report.Succeeded(), 1)
+		assert.Equal(t, 1, p.Persisted())
+	})
+
+	t.Run("multi counters register their replicas in the given registry", func(t *testing.T) {
+		s := NewEmergencyPersistence(syscall.SIGUSR2)
+		defer s.StopSignals()
+		c := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+randomPort())
+		c.Increment("a")
+		c.PersistVia(s)
+		c.Increment("b")
+		waitForMultiGcounterValueOf(t, 1, c, "b")
+
+		report := s.Flush(context.Background())
+		assert.Len(t, report.Succeeded(), 2)
+	})
+}
+
+func persistentsOf(results []PersistenceResult) []Persistent {
+	res := []Persistent{}
+	for _, r := range results {
+		res = append(res, r.Persistent)
+	}
+	return res
+}
+
+func prioritiesOf(results []PersistenceResult) []int {
+	res := []int{}
+	for _, r := range results {
+		res = append(res, r.Priority)
+	}
+	return res
+}
+
+type testPersistent struct {
+	phony.Inbox
+	delay     time.Duration
+	persisted int
+}
+
+func (p *testPersistent) PersistSync() {
+	time.Sleep(p.delay)
+	phony.Block(p, func() {
+		p.persisted++
+	})
+}
+
+func (p *testPersistent) Persisted() int {
+	var res int
+	phony.Block(p, func() {
+		res = p.persisted
+	})
+	return res
+}
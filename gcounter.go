@@ -1,6 +1,11 @@
 package percounter
 
-import "math"
+import (
+	"errors"
+	"math"
+)
+
+var ErrIdentityRetired = errors.New("identity retired")
 
 type GCounter struct {
 	identity string
@@ -18,28 +23,89 @@ func NewGCounter(identity string) *GCounter {
 	return NewGCounterFromState(identity, NewGcounterState())
 }
 
+// Increment is ignored once the own identity is retired, see TryIncrement
 func (c *GCounter) Increment() {
+	_ = c.TryIncrement()
+}
+
+// TryIncrement fails once the own identity is retired, its further increments would be lost
+func (c *GCounter) TryIncrement() error {
+	if c.state.Retired.folded(c.identity) {
+		return ErrIdentityRetired
+	}
 	val := c.valueOf(c.identity)
 	val++
 	c.setValueOf(c.identity, val)
+	return nil
 }
 
 func (c *GCounter) Value() int64 {
-	var res int64
+	res := c.state.Retired.Total()
 	for _, value := range c.state.Peers {
 		res += value
 	}
 	return res
 }
 
+// MergeWith takes the maximum of each slot, folding the slots of retired identities into the retired aggregate.
+// Replicas more than retiredEpochWindow epochs apart cannot tell the identities retired in between,
+// so only the slots known to the newer replica are kept, the live ones to be pulled again from the peers
 func (c *GCounter) MergeWith(other GCounterStateSource) {
-	for peer, value := range other.GetState().Peers {
+	state := other.GetState()
+	myEpoch, otherEpoch := c.state.Retired.EpochOrZero(), state.Retired.EpochOrZero()
+	if c.farBehind(state) {
+		for peer := range c.state.Peers {
+			if _, known := state.Peers[peer]; !known && peer != c.identity {
+				delete(c.state.Peers, peer)
+			}
+		}
+	}
+	if state.Retired != nil {
+		c.state.Retired = c.state.Retired.mergedWith(state.Retired)
+		for peer, value := range c.state.Peers {
+			if c.state.Retired.folded(peer) {
+				c.state.Retired.raise(peer, value)
+				delete(c.state.Peers, peer)
+			}
+		}
+	}
+	staleOther := myEpoch > otherEpoch+retiredEpochWindow
+	for peer, value := range state.Peers {
+		if c.state.Retired.folded(peer) {
+			c.state.Retired.raise(peer, value)
+			continue
+		}
+		if _, known := c.state.Peers[peer]; staleOther && !known && peer != c.identity {
+			continue
+		}
 		myValue := c.valueOf(peer)
 		newValue := int64(math.Max(float64(value), float64(myValue)))
 		c.setValueOf(peer, newValue)
 	}
 }
 
+// Retire folds the slots of the identities into the retired aggregate of the next epoch, keeping the value.
+// Returns false if none of the identities has a slot
+func (c *GCounter) Retire(identities ...string) bool {
+	folded := map[string]int64{}
+	for _, identity := range identities {
+		if count, ok := c.state.Peers[identity]; ok {
+			folded[identity] = count
+			delete(c.state.Peers, identity)
+		}
+	}
+	if len(folded) == 0 {
+		return false
+	}
+	c.state.Retired = c.state.Retired.next(folded)
+	return true
+}
+
+// farBehind tells whether merging the state drops the slots unknown to it
+func (c *GCounter) farBehind(other GCounterState) bool {
+	return other.Retired.EpochOrZero() > c.state.Retired.EpochOrZero()+retiredEpochWindow
+}
+
 func (c *GCounter) GetState() GCounterState {
 	return c.state
 }
@@ -0,0 +1,71 @@
+package percounter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ReadGCounterFile reads a persisted G-Counter state, named after the file if the state has no name
+func ReadGCounterFile(filename string) (GCounterState, error) {
+	res := NewNamedGcounterState(getFilenameWithoutExtension(filename))
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return res, err
+	}
+	if len(contents) == 0 {
+		return res, fmt.Errorf("%s is empty", filename)
+	}
+	state := GCounterState{}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return res, fmt.Errorf("deserializing state from %s: %w", filename, err)
+	}
+	if state.Name == "" {
+		state.Name = res.Name
+	}
+	if state.Peers == nil {
+		state.Peers = map[string]int64{}
+	}
+	return state, nil
+}
+
+func WriteGCounterFile(filename string, state GCounterState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
+
+// ValidateGCounterState checks the integrity of a state: per-peer counts can only grow from zero
+func ValidateGCounterState(state GCounterState) error {
+	var errs []error
+	for peer, count := range state.Peers {
+		if peer == "" {
+			errs = append(errs, errors.New("empty peer identity"))
+		}
+		if count < 0 {
+			errs = append(errs, fmt.Errorf("negative count %d of peer '%s'", count, peer))
+		}
+	}
+	if r := state.Retired; r != nil {
+		if r.Base < 0 {
+			errs = append(errs, fmt.Errorf("negative retired count %d", r.Base))
+		}
+		for _, e := range r.Epochs {
+			if e.Epoch > r.Epoch || e.Epoch+retiredEpochWindow <= r.Epoch {
+				errs = append(errs, fmt.Errorf("retired epoch %d outside of the window of epoch %d", e.Epoch, r.Epoch))
+			}
+			for peer, count := range e.Folded {
+				if count < 0 {
+					errs = append(errs, fmt.Errorf("negative count %d of retired peer '%s'", count, peer))
+				}
+				if _, ok := state.Peers[peer]; ok {
+					errs = append(errs, fmt.Errorf("peer '%s' is both retired and counting", peer))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
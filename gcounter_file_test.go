@@ -0,0 +1,55 @@
+package percounter
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCounterFile(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "a.gcounter")
+		state := GCounterState{Name: "a", Peers: map[string]int64{"1": 2, "2": 3}}
+		require.NoError(t, WriteGCounterFile(filename, state))
+
+		read, err := ReadGCounterFile(filename)
+		require.NoError(t, err)
+		assert.Equal(t, state, read)
+	})
+
+	t.Run("unnamed states are named after the file", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "b.gcounter")
+		require.NoError(t, os.WriteFile(filename, []byte(`{}`), 0644))
+
+		read, err := ReadGCounterFile(filename)
+		require.NoError(t, err)
+		assert.Equal(t, NewNamedGcounterState("b"), read)
+	})
+
+	t.Run("unreadable files are reported", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := ReadGCounterFile(path.Join(dir, "missing.gcounter"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		for _, content := range []string{"", "not json"} {
+			filename := path.Join(dir, "c.gcounter")
+			require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+			_, err = ReadGCounterFile(filename)
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		assert.NoError(t, ValidateGCounterState(GCounterState{Name: "a", Peers: map[string]int64{"1": 0, "2": 3}}))
+		assert.Error(t, ValidateGCounterState(GCounterState{Name: "a", Peers: map[string]int64{"1": -1}}))
+		assert.Error(t, ValidateGCounterState(GCounterState{Name: "a", Peers: map[string]int64{"": 1}}))
+		retired := &RetiredSlot{Epoch: 1, Base: 2, Epochs: []RetiredEpoch{{Epoch: 1, Folded: map[string]int64{"2": 3}}}}
+		assert.NoError(t, ValidateGCounterState(GCounterState{Name: "a", Peers: map[string]int64{"1": 1}, Retired: retired}))
+		assert.Error(t, ValidateGCounterState(GCounterState{Name: "a", Peers: map[string]int64{"2": 1}, Retired: retired}))
+		assert.Error(t, ValidateGCounterState(GCounterState{Name: "a", Peers: map[string]int64{}, Retired: &RetiredSlot{Base: -1}}))
+		assert.Error(t, ValidateGCounterState(GCounterState{Name: "a", Peers: map[string]int64{}, Retired: &RetiredSlot{Epoch: 1, Epochs: []RetiredEpoch{{Epoch: 2}}}}))
+	})
+}
@@ -1,10 +1,34 @@
 package percounter
 
-import "maps"
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+)
 
 type GCounterState struct {
 	Name  string           `json:"name"`
 	Peers map[string]int64 `json:"peers"`
+	// Retired holds the counts of the identities retired from Peers, if any
+	Retired *RetiredSlot `json:"retired,omitempty"`
+}
+
+// retiredEpochWindow is the number of latest epochs keeping the identities they retired.
+// Replicas further behind cannot tell which of their slots were retired in between
+const retiredEpochWindow = 8
+
+// RetiredSlot aggregates the counts of retired identities. The epoch advances with each retirement,
+// the epochs of the window keep the identities they retired for the replicas behind to drop their slots
+type RetiredSlot struct {
+	Epoch uint64 `json:"epoch"`
+	// Base is the sum of the counts retired in the epochs before the window
+	Base   int64          `json:"base"`
+	Epochs []RetiredEpoch `json:"epochs"`
+}
+
+type RetiredEpoch struct {
+	Epoch  uint64           `json:"epoch"`
+	Folded map[string]int64 `json:"folded"`
 }
 
 type NetworkedGCounterState struct {
@@ -13,6 +37,7 @@ type NetworkedGCounterState struct {
 	Name       string                 `json:"name"`
 	Peers      map[string]int64       `json:"peers"`
 	Metadata   map[string]interface{} `json:"metadata"`
+	State      json.RawMessage        `json:"state,omitempty"`
 }
 
 func NewGcounterState() GCounterState {
@@ -28,7 +53,148 @@ func NewNamedGcounterState(name string) GCounterState {
 
 func (s GCounterState) Copy() GCounterState {
 	return GCounterState{
-		Name:  s.Name,
-		Peers: maps.Clone(s.Peers),
+		Name:    s.Name,
+		Peers:   maps.Clone(s.Peers),
+		Retired: s.Retired.Copy(),
+	}
+}
+
+func (r *RetiredSlot) Copy() *RetiredSlot {
+	if r == nil {
+		return nil
+	}
+	res := &RetiredSlot{
+		Epoch:  r.Epoch,
+		Base:   r.Base,
+		Epochs: []RetiredEpoch{},
+	}
+	for _, e := range r.Epochs {
+		res.Epochs = append(res.Epochs, RetiredEpoch{Epoch: e.Epoch, Folded: maps.Clone(e.Folded)})
+	}
+	return res
+}
+
+func (r *RetiredSlot) EpochOrZero() uint64 {
+	if r == nil {
+		return 0
+	}
+	return r.Epoch
+}
+
+// Total is the sum of the counts of all retired identities
+func (r *RetiredSlot) Total() int64 {
+	if r == nil {
+		return 0
+	}
+	res := r.Base
+	for _, e := range r.Epochs {
+		res += e.total()
+	}
+	return res
+}
+
+// next retires the identities in a new epoch, moving the epochs leaving the window into the base
+func (r *RetiredSlot) next(folded map[string]int64) *RetiredSlot {
+	res := &RetiredSlot{
+		Epoch:  r.EpochOrZero() + 1,
+		Epochs: []RetiredEpoch{},
+	}
+	if r != nil {
+		res.Base = r.Base
+		for _, e := range r.Copy().Epochs {
+			if e.Epoch+retiredEpochWindow <= res.Epoch {
+				res.Base += e.total()
+				continue
+			}
+			res.Epochs = append(res.Epochs, e)
+		}
+	}
+	res.Epochs = append(res.Epochs, RetiredEpoch{Epoch: res.Epoch, Folded: folded})
+	return res
+}
+
+// mergedWith joins the epochs of both windows. The base of the newer slot covers the epochs before its window
+func (r *RetiredSlot) mergedWith(other *RetiredSlot) *RetiredSlot {
+	if r == nil {
+		return other.Copy()
+	}
+	if other == nil {
+		return r.Copy()
+	}
+	res := &RetiredSlot{
+		Epoch:  max(r.Epoch, other.Epoch),
+		Epochs: []RetiredEpoch{},
+	}
+	switch {
+	case r.Epoch > other.Epoch:
+		res.Base = r.Base
+	case other.Epoch > r.Epoch:
+		res.Base = other.Base
+	default:
+		res.Base = max(r.Base, other.Base)
+	}
+	byEpoch := map[uint64]map[string]int64{}
+	for _, e := range slices.Concat(r.Epochs, other.Epochs) {
+		if e.Epoch+retiredEpochWindow <= res.Epoch {
+			continue
+		}
+		if byEpoch[e.Epoch] == nil {
+			byEpoch[e.Epoch] = map[string]int64{}
+		}
+		for identity, count := range e.Folded {
+			byEpoch[e.Epoch][identity] = max(byEpoch[e.Epoch][identity], count)
+		}
+	}
+	// an identity retired concurrently in different epochs is only counted in the first one
+	counts := map[string]int64{}
+	first := map[string]uint64{}
+	epochs := slices.Sorted(maps.Keys(byEpoch))
+	for _, epoch := range epochs {
+		for identity, count := range byEpoch[epoch] {
+			counts[identity] = max(counts[identity], count)
+			if _, ok := first[identity]; !ok {
+				first[identity] = epoch
+			}
+		}
+	}
+	for _, epoch := range epochs {
+		folded := map[string]int64{}
+		for identity := range byEpoch[epoch] {
+			if first[identity] == epoch {
+				folded[identity] = counts[identity]
+			}
+		}
+		res.Epochs = append(res.Epochs, RetiredEpoch{Epoch: epoch, Folded: folded})
+	}
+	return res
+}
+
+func (r *RetiredSlot) folded(identity string) bool {
+	if r == nil {
+		return false
+	}
+	for _, e := range r.Epochs {
+		if _, ok := e.Folded[identity]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// raise keeps the latest count of a retired identity, its last increments possibly unknown to the coordinator
+func (r *RetiredSlot) raise(identity string, count int64) {
+	for _, e := range r.Epochs {
+		if folded, ok := e.Folded[identity]; ok {
+			e.Folded[identity] = max(folded, count)
+			return
+		}
+	}
+}
+
+func (e RetiredEpoch) total() int64 {
+	var res int64
+	for _, count := range e.Folded {
+		res += count
 	}
+	return res
 }
@@ -1,6 +1,7 @@
 package percounter
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -43,4 +44,139 @@ func TestGCounter(t *testing.T) {
 		c.MergeWith(c2)
 		assert.Equal(t, int64(5), c.Value())
 	})
+
+	t.Run("retiring identities keeps the value", func(t *testing.T) {
+		c := NewGCounterFromState("1", GCounterState{Peers: map[string]int64{"1": 1, "2": 2, "3": 3}})
+		assert.True(t, c.Retire("2", "3", "unknown"))
+		assert.Equal(t, int64(6), c.Value())
+		assert.Equal(t, map[string]int64{"1": 1}, c.GetState().Peers)
+		assert.Equal(t, &RetiredSlot{Epoch: 1, Base: 0, Epochs: []RetiredEpoch{{Epoch: 1, Folded: map[string]int64{"2": 2, "3": 3}}}}, c.GetState().Retired)
+
+		assert.False(t, c.Retire("2"))
+		c.Increment()
+		assert.Equal(t, int64(7), c.Value())
+	})
+
+	t.Run("retired identities cannot increment anymore", func(t *testing.T) {
+		c := NewGCounterFromState("1", GCounterState{Peers: map[string]int64{"1": 1, "2": 2}})
+		other := NewGCounterFromState("2", c.GetState().Copy())
+		c.Retire("2")
+		other.MergeWith(c)
+
+		assert.ErrorIs(t, other.TryIncrement(), ErrIdentityRetired)
+		other.Increment()
+		assert.Equal(t, int64(3), other.Value())
+		assert.NoError(t, c.TryIncrement())
+	})
+
+	t.Run("increments of a retired identity unknown to the coordinator are kept", func(t *testing.T) {
+		coordinator := NewGCounterFromState("1", GCounterState{Peers: map[string]int64{"1": 1, "2": 3}})
+		retired := NewGCounterFromState("2", GCounterState{Peers: map[string]int64{"1": 1, "2": 5}})
+		coordinator.Retire("2")
+
+		retired.MergeWith(coordinator)
+		assert.Equal(t, int64(6), retired.Value())
+		assert.Equal(t, map[string]int64{"1": 1}, retired.GetState().Peers)
+		coordinator.MergeWith(retired)
+		assert.Equal(t, int64(6), coordinator.Value())
+		assert.Equal(t, coordinator.GetState(), retired.GetState())
+
+		// the retired slot catches up with a late state of the retired identity
+		late := NewGCounterFromState("2", GCounterState{Peers: map[string]int64{"2": 7}})
+		coordinator.MergeWith(late)
+		assert.Equal(t, int64(8), coordinator.Value())
+	})
+
+	t.Run("replicas behind drop the retired slots", func(t *testing.T) {
+		coordinator := NewGCounterFromState("1", GCounterState{Peers: map[string]int64{"1": 1, "2": 2}})
+		other := NewGCounterFromState("3", GCounterState{Peers: map[string]int64{"1": 1, "2": 2, "3": 3}})
+		coordinator.Retire("2")
+
+		other.MergeWith(coordinator)
+		assert.Equal(t, int64(6), other.Value())
+		assert.Equal(t, map[string]int64{"1": 1, "3": 3}, other.GetState().Peers)
+
+		// a stale replica does not bring the retired slot back
+		stale := NewGCounterFromState("4", GCounterState{Peers: map[string]int64{"2": 2, "4": 4}})
+		coordinator.MergeWith(stale)
+		assert.Equal(t, int64(7), coordinator.Value())
+		stale.MergeWith(coordinator)
+		assert.Equal(t, coordinator.GetState(), stale.GetState())
+	})
+
+	t.Run("chained retirements keep the live slots unknown to the newer replica", func(t *testing.T) {
+		c := NewGCounterFromState("1", GCounterState{Peers: map[string]int64{"1": 1, "2": 2, "3": 3}})
+		stale := NewGCounterFromState("4", c.GetState().Copy())
+		c.Retire("2")
+		c.Increment()
+		c.Retire("3")
+		assert.Equal(t, int64(7), c.Value())
+		// increments of a node the newer replica has not heard of yet
+		stale.MergeWith(NewGCounterFromState("5", GCounterState{Peers: map[string]int64{"5": 5}}))
+
+		stale.MergeWith(c)
+		assert.Equal(t, int64(12), stale.Value())
+		assert.Equal(t, map[string]int64{"1": 2, "5": 5}, stale.GetState().Peers)
+		c.MergeWith(stale)
+		assert.Equal(t, int64(12), c.Value())
+		assert.Equal(t, c.GetState(), stale.GetState())
+	})
+
+	t.Run("epochs leaving the window are summed up in the base", func(t *testing.T) {
+		state := GCounterState{Peers: map[string]int64{"1": 1}}
+		for i := range retiredEpochWindow + 2 {
+			state.Peers[fmt.Sprint("gone-", i)] = 1
+		}
+		c := NewGCounterFromState("1", state.Copy())
+		within := NewGCounterFromState("1", state.Copy())
+		for i := range retiredEpochWindow + 2 {
+			c.Retire(fmt.Sprint("gone-", i))
+			if i == 2 {
+				within = NewGCounterFromState("1", c.GetState().Copy())
+			}
+		}
+		assert.Equal(t, int64(retiredEpochWindow+3), c.Value())
+		assert.Equal(t, int64(2), c.GetState().Retired.Base)
+		assert.Len(t, c.GetState().Retired.Epochs, retiredEpochWindow)
+
+		within.MergeWith(c)
+		assert.Equal(t, c.GetState(), within.GetState())
+
+		// too far behind to tell the retired slots apart from the live ones
+		stale := NewGCounterFromState("2", state.Copy())
+		stale.MergeWith(NewGCounterFromState("", GCounterState{Peers: map[string]int64{"2": 1}}))
+		stale.MergeWith(c)
+		assert.Equal(t, map[string]int64{"1": 1, "2": 1}, stale.GetState().Peers)
+		assert.Equal(t, int64(retiredEpochWindow+4), stale.Value())
+		c.MergeWith(stale)
+		assert.Equal(t, c.GetState(), stale.GetState())
+	})
+
+	t.Run("concurrent retirements of the same epoch are combined", func(t *testing.T) {
+		state := GCounterState{Peers: map[string]int64{"1": 1, "2": 2, "3": 3}}
+		c1 := NewGCounterFromState("1", state.Copy())
+		c2 := NewGCounterFromState("2", state.Copy())
+		c1.Retire("2")
+		c2.Retire("3")
+
+		c1.MergeWith(c2)
+		c2.MergeWith(c1)
+		assert.Equal(t, int64(6), c1.Value())
+		assert.Equal(t, c1.GetState(), c2.GetState())
+		assert.Equal(t, map[string]int64{"1": 1}, c1.GetState().Peers)
+	})
+
+	t.Run("identities retired concurrently in different epochs are counted once", func(t *testing.T) {
+		state := GCounterState{Peers: map[string]int64{"1": 1, "2": 2, "3": 3}}
+		c1 := NewGCounterFromState("1", state.Copy())
+		c2 := NewGCounterFromState("1", state.Copy())
+		c1.Retire("2")
+		c2.Retire("3")
+		c2.Retire("2")
+
+		c1.MergeWith(c2)
+		c2.MergeWith(c1)
+		assert.Equal(t, int64(6), c1.Value())
+		assert.Equal(t, c1.GetState(), c2.GetState())
+	})
 }
@@ -0,0 +1,77 @@
+package percounter
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// GossipConfig configures the SWIM-style failure detection and membership dissemination:
+// every ProbeInterval a random member is pinged, if it does not ack within ProbeTimeout,
+// IndirectProbes other members are asked to ping it. Unreachable members are suspected
+// and declared dead after SuspicionTimeout unless they refute the suspicion
+type GossipConfig struct {
+	ProbeInterval         time.Duration
+	ProbeTimeout          time.Duration
+	IndirectProbes        int
+	SuspicionTimeout      time.Duration
+	MaxPiggybackedUpdates int
+	RetransmitMultiplier  int
+}
+
+func DefaultGossipConfig() GossipConfig {
+	return GossipConfig{
+		ProbeInterval:         1 * time.Second,
+		ProbeTimeout:          300 * time.Millisecond,
+		IndirectProbes:        3,
+		SuspicionTimeout:      5 * time.Second,
+		MaxPiggybackedUpdates: 8,
+		RetransmitMultiplier:  3,
+	}
+}
+
+// disseminationQueue holds the recent membership updates to be piggybacked on outgoing messages.
+// Each update is retransmitted a limited number of times, the least transmitted ones first
+type disseminationQueue struct {
+	entries []*disseminationEntry
+}
+
+type disseminationEntry struct {
+	update        MemberUpdate
+	transmissions int
+}
+
+// enqueue replaces older news of the same member
+func (q *disseminationQueue) enqueue(u MemberUpdate) {
+	q.entries = slices.DeleteFunc(q.entries, func(e *disseminationEntry) bool {
+		return e.update.Identity == u.Identity
+	})
+	q.entries = append(q.entries, &disseminationEntry{update: u})
+}
+
+func (q *disseminationQueue) next(maxUpdates, retransmitLimit int) []MemberUpdate {
+	slices.SortStableFunc(q.entries, func(a, b *disseminationEntry) int {
+		return a.transmissions - b.transmissions
+	})
+	res := []MemberUpdate{}
+	for _, e := range q.entries {
+		if len(res) >= maxUpdates {
+			break
+		}
+		res = append(res, e.update)
+		e.transmissions++
+	}
+	q.entries = slices.DeleteFunc(q.entries, func(e *disseminationEntry) bool {
+		return e.transmissions >= retransmitLimit
+	})
+	return res
+}
+
+func (q *disseminationQueue) len() int {
+	return len(q.entries)
+}
+
+// retransmitLimitFor scales the retransmissions logarithmically with the cluster size
+func retransmitLimitFor(multiplier, clusterSize int) int {
+	return multiplier * int(math.Ceil(math.Log2(float64(clusterSize+1))))
+}
@@ -0,0 +1,35 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisseminationQueue(t *testing.T) {
+	t.Run("newer news of a member replace older ones", func(t *testing.T) {
+		q := disseminationQueue{}
+		q.enqueue(MemberUpdate{"1", "", MemberAlive, 0})
+		q.enqueue(MemberUpdate{"1", "", MemberSuspect, 0})
+		assert.Equal(t, []MemberUpdate{{"1", "", MemberSuspect, 0}}, q.next(10, 3))
+	})
+
+	t.Run("least transmitted updates go first and retire after the limit", func(t *testing.T) {
+		q := disseminationQueue{}
+		q.enqueue(MemberUpdate{"1", "", MemberAlive, 0})
+		q.enqueue(MemberUpdate{"2", "", MemberAlive, 0})
+		assert.Equal(t, []MemberUpdate{{"1", "", MemberAlive, 0}}, q.next(1, 2))
+		q.enqueue(MemberUpdate{"3", "", MemberAlive, 0})
+		assert.Equal(t, []MemberUpdate{{"2", "", MemberAlive, 0}, {"3", "", MemberAlive, 0}}, q.next(2, 2))
+		assert.Equal(t, 3, q.len())
+		q.next(3, 2)
+		assert.Equal(t, 0, q.len())
+		assert.Empty(t, q.next(3, 2))
+	})
+
+	t.Run("retransmissions grow logarithmically with the cluster", func(t *testing.T) {
+		assert.Equal(t, 3, retransmitLimitFor(3, 1))
+		assert.Equal(t, 6, retransmitLimitFor(3, 3))
+		assert.Equal(t, 21, retransmitLimitFor(3, 100))
+	})
+}
@@ -0,0 +1,72 @@
+package percounter
+
+import (
+	"maps"
+	"slices"
+)
+
+type GSetState struct {
+	Name     string          `json:"name"`
+	Elements map[string]bool `json:"elements"`
+}
+
+func NewGSetState() GSetState {
+	return NewNamedGSetState("singleton")
+}
+
+func NewNamedGSetState(name string) GSetState {
+	return GSetState{
+		Name:     name,
+		Elements: make(map[string]bool),
+	}
+}
+
+func (s GSetState) Copy() GSetState {
+	return GSetState{
+		Name:     s.Name,
+		Elements: maps.Clone(s.Elements),
+	}
+}
+
+type GSet struct {
+	state GSetState
+}
+
+func NewGSetFromState(state GSetState) *GSet {
+	if state.Elements == nil {
+		state.Elements = make(map[string]bool)
+	}
+	return &GSet{
+		state: state,
+	}
+}
+
+func NewGSet() *GSet {
+	return NewGSetFromState(NewGSetState())
+}
+
+func (s *GSet) Add(element string) {
+	s.state.Elements[element] = true
+}
+
+func (s *GSet) Contains(element string) bool {
+	return s.state.Elements[element]
+}
+
+func (s *GSet) Elements() []string {
+	return slices.Sorted(maps.Keys(s.state.Elements))
+}
+
+func (s *GSet) Len() int {
+	return len(s.state.Elements)
+}
+
+func (s *GSet) MergeWith(other GSetStateSource) {
+	for element := range other.GetState().Elements {
+		s.Add(element)
+	}
+}
+
+func (s *GSet) GetState() GSetState {
+	return s.state
+}
@@ -0,0 +1,38 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGSet(t *testing.T) {
+	t.Run("adding elements", func(t *testing.T) {
+		s := NewGSet()
+		s.Add("a")
+		s.Add("b")
+		s.Add("a")
+		assert.Equal(t, 2, s.Len())
+		assert.True(t, s.Contains("a"))
+		assert.False(t, s.Contains("c"))
+		assert.Equal(t, []string{"a", "b"}, s.Elements())
+	})
+
+	t.Run("merging with another set", func(t *testing.T) {
+		s := NewGSet()
+		s.Add("a")
+		s2 := NewGSet()
+		s2.Add("b")
+		s2.Add("a")
+		s.MergeWith(s2)
+		assert.Equal(t, []string{"a", "b"}, s.Elements())
+		// the other set is unchanged
+		assert.Equal(t, []string{"a", "b"}, s2.Elements())
+	})
+
+	t.Run("restoring from a state without elements", func(t *testing.T) {
+		s := NewGSetFromState(GSetState{Name: "empty"})
+		s.Add("a")
+		assert.Equal(t, []string{"a"}, s.Elements())
+	})
+}
@@ -0,0 +1,60 @@
+package percounter
+
+import "time"
+
+// HLCTimestamp is a hybrid logical clock timestamp: wall clock nanoseconds
+// and a logical counter ordering events within the same wall clock reading
+type HLCTimestamp struct {
+	WallTime int64 `json:"wall_time"`
+	Logical  int64 `json:"logical"`
+}
+
+func (t HLCTimestamp) Before(other HLCTimestamp) bool {
+	if t.WallTime != other.WallTime {
+		return t.WallTime < other.WallTime
+	}
+	return t.Logical < other.Logical
+}
+
+// HybridLogicalClock is not thread-safe, it is meant to be owned by an actor
+type HybridLogicalClock struct {
+	now  func() time.Time
+	last HLCTimestamp
+}
+
+func NewHybridLogicalClock() *HybridLogicalClock {
+	return NewHybridLogicalClockWithTimeSource(time.Now)
+}
+
+func NewHybridLogicalClockWithTimeSource(now func() time.Time) *HybridLogicalClock {
+	return &HybridLogicalClock{
+		now: now,
+	}
+}
+
+// Now returns a timestamp for a local event, greater than all timestamps seen so far
+func (c *HybridLogicalClock) Now() HLCTimestamp {
+	wallTime := c.now().UnixNano()
+	if wallTime > c.last.WallTime {
+		c.last = HLCTimestamp{WallTime: wallTime}
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Update moves the clock past a timestamp received from another peer
+func (c *HybridLogicalClock) Update(remote HLCTimestamp) HLCTimestamp {
+	wallTime := c.now().UnixNano()
+	switch {
+	case wallTime > c.last.WallTime && wallTime > remote.WallTime:
+		c.last = HLCTimestamp{WallTime: wallTime}
+	case remote.WallTime > c.last.WallTime:
+		c.last = HLCTimestamp{WallTime: remote.WallTime, Logical: remote.Logical + 1}
+	case c.last.WallTime > remote.WallTime:
+		c.last.Logical++
+	default:
+		c.last.Logical = max(c.last.Logical, remote.Logical) + 1
+	}
+	return c.last
+}
@@ -0,0 +1,38 @@
+package percounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHybridLogicalClock(t *testing.T) {
+	t.Run("timestamps are monotonic even if the wall clock is not", func(t *testing.T) {
+		wallTime := time.Unix(100, 0)
+		c := NewHybridLogicalClockWithTimeSource(func() time.Time { return wallTime })
+		t1 := c.Now()
+		t2 := c.Now()
+		wallTime = time.Unix(99, 0)
+		t3 := c.Now()
+		assert.True(t, t1.Before(t2))
+		assert.True(t, t2.Before(t3))
+		assert.Equal(t, time.Unix(100, 0).UnixNano(), t3.WallTime)
+	})
+
+	t.Run("remote timestamps from the future move the clock forward", func(t *testing.T) {
+		c := NewHybridLogicalClockWithTimeSource(func() time.Time { return time.Unix(100, 0) })
+		remote := HLCTimestamp{WallTime: time.Unix(200, 0).UnixNano(), Logical: 3}
+		updated := c.Update(remote)
+		assert.True(t, remote.Before(updated))
+		assert.True(t, remote.Before(c.Now()))
+	})
+
+	t.Run("the wall clock wins once it passes the remote timestamps", func(t *testing.T) {
+		wallTime := time.Unix(100, 0)
+		c := NewHybridLogicalClockWithTimeSource(func() time.Time { return wallTime })
+		c.Update(HLCTimestamp{WallTime: time.Unix(150, 0).UnixNano(), Logical: 3})
+		wallTime = time.Unix(300, 0)
+		assert.Equal(t, HLCTimestamp{WallTime: wallTime.UnixNano()}, c.Now())
+	})
+}
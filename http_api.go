@@ -0,0 +1,211 @@
+package percounter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// CounterResponse is the HTTP API view of a G-Counter
+type CounterResponse struct {
+	Name  string           `json:"name"`
+	Value int64            `json:"value"`
+	Peers map[string]int64 `json:"peers,omitempty"`
+	// Retired is the sum of the counts of retired identities
+	Retired int64 `json:"retired,omitempty"`
+}
+
+// PeersResponse is the HTTP API view of the cluster as seen by the node
+type PeersResponse struct {
+	Identity  string                  `json:"identity"`
+	Peers     []string                `json:"peers"`
+	Members   []Member                `json:"members"`
+	Protocols map[string]PeerProtocol `json:"protocols"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// HTTPAPI exposes the G-Counters of a node over HTTP:
+//
+//	GET  /counters                  all counters with their values
+//	GET  /counters/{name}           a counter with its per-peer counts
+//	POST /counters/{name}/increment increments a counter, refused once the node's identity is retired
+//	GET  /peers                     the peers and members
+//	POST /members/{identity}/retire folds the counts of a dead member into the retired slot
+//	GET  /metrics                   metrics in the Prometheus text format
+//	GET  /healthz                   liveness
+type HTTPAPI struct {
+	counter      *ZmqMultiGcounter
+	checkpointer *Checkpointer
+	traffic      *TrafficMetrics
+	mux          *http.ServeMux
+}
+
+func NewHTTPAPI(counter *ZmqMultiGcounter) *HTTPAPI {
+	a := &HTTPAPI{
+		counter: counter,
+		traffic: &TrafficMetrics{},
+		mux:     http.NewServeMux(),
+	}
+	a.mux.HandleFunc("GET /counters", a.getCounters)
+	a.mux.HandleFunc("GET /counters/{name}", a.getCounter)
+	a.mux.HandleFunc("POST /counters/{name}/increment", a.increment)
+	a.mux.HandleFunc("GET /peers", a.getPeers)
+	a.mux.HandleFunc("POST /members/{identity}/retire", a.retire)
+	a.mux.HandleFunc("GET /metrics", a.getMetrics)
+	a.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	return a
+}
+
+// SetCheckpointer adds the checkpoint staleness to the metrics, should be called before serving
+func (a *HTTPAPI) SetCheckpointer(c *Checkpointer) {
+	a.checkpointer = c
+}
+
+// TrafficObserver counts the cluster traffic for the metrics, see ZmqMultiGcounter.SetClusterObserver
+func (a *HTTPAPI) TrafficObserver() ClusterObserver {
+	return a.traffic
+}
+
+func (a *HTTPAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *HTTPAPI) getCounters(w http.ResponseWriter, r *http.Request) {
+	res := []CounterResponse{}
+	for _, name := range a.counter.CounterNames() {
+		res = append(res, CounterResponse{Name: name, Value: a.counter.Value(name)})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (a *HTTPAPI) getCounter(w http.ResponseWriter, r *http.Request) {
+	name, ok := counterNameOf(w, r)
+	if !ok {
+		return
+	}
+	if !slices.Contains(a.counter.CounterNames(), name) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{fmt.Sprintf("counter '%s' not found", name)})
+		return
+	}
+	state := a.counter.GetCounter(name).GetState()
+	writeJSON(w, http.StatusOK, CounterResponse{Name: name, Value: a.counter.Value(name), Peers: state.Peers, Retired: state.Retired.Total()})
+}
+
+func (a *HTTPAPI) increment(w http.ResponseWriter, r *http.Request) {
+	name, ok := counterNameOf(w, r)
+	if !ok {
+		return
+	}
+	if err := a.counter.TryIncrement(name); err != nil {
+		writeJSON(w, http.StatusConflict, ErrorResponse{err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, CounterResponse{Name: name, Value: a.counter.Value(name)})
+}
+
+func (a *HTTPAPI) getPeers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, PeersResponse{
+		Identity:  a.counter.Identity(),
+		Peers:     a.counter.Peers(),
+		Members:   a.counter.Members(),
+		Protocols: a.counter.PeerProtocols(),
+	})
+}
+
+// retire answers with the peers once the retirement is agreed
+func (a *HTTPAPI) retire(w http.ResponseWriter, r *http.Request) {
+	identity := r.PathValue("identity")
+	if err := a.counter.Retire(DefaultRetirementTimeout, identity); err != nil {
+		writeJSON(w, http.StatusConflict, ErrorResponse{err.Error()})
+		return
+	}
+	a.getPeers(w, r)
+}
+
+func (a *HTTPAPI) getMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	names := a.counter.CounterNames()
+	fmt.Fprintln(w, "# TYPE percounter_counter_value gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "percounter_counter_value{name=\"%s\"} %d\n", prometheusLabelEscaper.Replace(name), a.counter.Value(name))
+	}
+	fmt.Fprintln(w, "# TYPE percounter_counters gauge")
+	fmt.Fprintf(w, "percounter_counters %d\n", len(names))
+	fmt.Fprintln(w, "# TYPE percounter_peers gauge")
+	fmt.Fprintf(w, "percounter_peers %d\n", len(a.counter.Peers()))
+	members := map[MemberState]int{}
+	for _, m := range a.counter.Members() {
+		members[m.State]++
+	}
+	fmt.Fprintln(w, "# TYPE percounter_members gauge")
+	for _, state := range []MemberState{MemberAlive, MemberSuspect, MemberDead} {
+		fmt.Fprintf(w, "percounter_members{state=\"%s\"} %d\n", state, members[state])
+	}
+	a.traffic.write(w)
+	if a.checkpointer != nil {
+		fmt.Fprintln(w, "# TYPE percounter_checkpoint_max_staleness_seconds gauge")
+		fmt.Fprintf(w, "percounter_checkpoint_max_staleness_seconds %g\n", a.checkpointer.MaxStaleness().Seconds())
+	}
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// counterNameOf rejects names that are not usable as file names
+func counterNameOf(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{fmt.Sprintf("invalid counter name '%s'", name)})
+		return "", false
+	}
+	return name, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("error writing the response: %v", err)
+	}
+}
+
+// TrafficMetrics counts the messages and bytes on the wire
+type TrafficMetrics struct {
+	messagesSent     atomic.Int64
+	bytesSent        atomic.Int64
+	messagesReceived atomic.Int64
+	bytesReceived    atomic.Int64
+}
+
+func (m *TrafficMetrics) AfterMessageSent(peer string, msg []byte) {
+	m.messagesSent.Add(1)
+	m.bytesSent.Add(int64(len(msg)))
+}
+
+func (m *TrafficMetrics) AfterMessageReceived(peer string, msg []byte) {
+	m.messagesReceived.Add(1)
+	m.bytesReceived.Add(int64(len(msg)))
+}
+
+func (m *TrafficMetrics) write(w io.Writer) {
+	for _, metric := range []struct {
+		name  string
+		value int64
+	}{
+		{"percounter_messages_sent_total", m.messagesSent.Load()},
+		{"percounter_bytes_sent_total", m.bytesSent.Load()},
+		{"percounter_messages_received_total", m.messagesReceived.Load()},
+		{"percounter_bytes_received_total", m.bytesReceived.Load()},
+	} {
+		fmt.Fprintf(w, "# TYPE %s counter\n%s %d\n", metric.name, metric.name, metric.value)
+	}
+}
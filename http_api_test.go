@@ -0,0 +1,210 @@
+package percounter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPAPI(t *testing.T) {
+	newServer := func(t *testing.T) (*ZmqMultiGcounter, *httptest.Server) {
+		c := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+randomPort())
+		require.NoError(t, c.Start())
+		t.Cleanup(c.Stop)
+		api := NewHTTPAPI(c)
+		c.SetClusterObserver(api.TrafficObserver())
+		server := httptest.NewServer(api)
+		t.Cleanup(server.Close)
+		return c, server
+	}
+
+	t.Run("counters are incremented and read", func(t *testing.T) {
+		_, server := newServer(t)
+
+		var counter CounterResponse
+		assert.Equal(t, http.StatusOK, requestJSON(t, http.MethodPost, server.URL+"/counters/x/increment", &counter))
+		assert.Equal(t, CounterResponse{Name: "x", Value: 1}, counter)
+		requestJSON(t, http.MethodPost, server.URL+"/counters/x/increment", &counter)
+		assert.Equal(t, int64(2), counter.Value)
+		requestJSON(t, http.MethodPost, server.URL+"/counters/y/increment", &counter)
+
+		assert.Equal(t, http.StatusOK, requestJSON(t, http.MethodGet, server.URL+"/counters/x", &counter))
+		assert.Equal(t, CounterResponse{Name: "x", Value: 2, Peers: map[string]int64{"1": 2}}, counter)
+
+		var counters []CounterResponse
+		assert.Equal(t, http.StatusOK, requestJSON(t, http.MethodGet, server.URL+"/counters", &counters))
+		assert.Equal(t, []CounterResponse{{Name: "x", Value: 2}, {Name: "y", Value: 1}}, counters)
+	})
+
+	t.Run("increments are refused once the identity is retired", func(t *testing.T) {
+		c, server := newServer(t)
+		c.Increment("x")
+		require.NoError(t, c.Leave(time.Second))
+
+		var e ErrorResponse
+		assert.Equal(t, http.StatusConflict, requestJSON(t, http.MethodPost, server.URL+"/counters/x/increment", &e))
+		assert.Contains(t, e.Error, ErrIdentityRetired.Error())
+		assert.Equal(t, int64(1), c.Value("x"))
+	})
+
+	t.Run("unknown and invalid counters are reported", func(t *testing.T) {
+		c, server := newServer(t)
+
+		var e ErrorResponse
+		assert.Equal(t, http.StatusNotFound, requestJSON(t, http.MethodGet, server.URL+"/counters/unknown", &e))
+		assert.Contains(t, e.Error, "unknown")
+		assert.Empty(t, c.CounterNames())
+
+		assert.Equal(t, http.StatusBadRequest, requestJSON(t, http.MethodPost, server.URL+"/counters/..%2Fx/increment", &e))
+		assert.Equal(t, http.StatusBadRequest, requestJSON(t, http.MethodPost, server.URL+"/counters/%2E%2E/increment", &e))
+		assert.Empty(t, c.CounterNames())
+	})
+
+	t.Run("peers and members are listed", func(t *testing.T) {
+		c1, server := newServer(t)
+		c1.SetMyIP("127.0.0.1")
+		port2 := randomPort()
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		c2.SetMyIP("127.0.0.1")
+		require.NoError(t, c2.Start())
+		defer c2.Stop()
+		c1.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port2)})
+		waitForMemberStateOf(t, MemberAlive, c1, "2")
+		waitForPeerProtocolOf(t, c1, zmqAddressOf("127.0.0.1", port2))
+
+		var peers PeersResponse
+		assert.Equal(t, http.StatusOK, requestJSON(t, http.MethodGet, server.URL+"/peers", &peers))
+		assert.Equal(t, "1", peers.Identity)
+		assert.Equal(t, []string{zmqAddressOf("127.0.0.1", port2)}, peers.Peers)
+		require.Len(t, peers.Members, 1)
+		assert.Equal(t, "2", peers.Members[0].Identity)
+		assert.Equal(t, ProtocolVersion, peers.Protocols[zmqAddressOf("127.0.0.1", port2)].Version)
+	})
+
+	t.Run("members are retired", func(t *testing.T) {
+		c, server := newServer(t)
+		c.MergeWith(NewGCounterFromState("", GCounterState{Name: "x", Peers: map[string]int64{"1": 1, "gone": 2}}))
+		waitForMultiGcounterValueOf(t, 3, c, "x")
+		var e ErrorResponse
+		assert.Equal(t, http.StatusConflict, requestJSON(t, http.MethodPost, server.URL+"/members/gone/retire", &e))
+		assert.Contains(t, e.Error, "not a known member")
+		declareDead(c, "gone")
+
+		var peers PeersResponse
+		assert.Equal(t, http.StatusOK, requestJSON(t, http.MethodPost, server.URL+"/members/gone/retire", &peers))
+		assert.Equal(t, "1", peers.Identity)
+		var counter CounterResponse
+		requestJSON(t, http.MethodGet, server.URL+"/counters/x", &counter)
+		assert.Equal(t, CounterResponse{Name: "x", Value: 3, Peers: map[string]int64{"1": 1}, Retired: 2}, counter)
+
+		assert.Equal(t, http.StatusConflict, requestJSON(t, http.MethodPost, server.URL+"/members/1/retire", &e))
+		assert.Contains(t, e.Error, "identity of this node")
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		c, server := newServer(t)
+		c.Increment(`a"b`)
+		waitForMultiGcounterValueOf(t, 1, c, `a"b`)
+
+		res, err := http.Get(server.URL + "/metrics")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "percounter_counter_value{name=\"a\\\"b\"} 1\n")
+		assert.Contains(t, string(body), "percounter_counters 1\n")
+		assert.Contains(t, string(body), "percounter_members{state=\"alive\"} 0\n")
+		// no peers to talk to
+		assert.Contains(t, string(body), "percounter_messages_sent_total 0\n")
+		assert.Contains(t, string(body), "percounter_bytes_received_total 0\n")
+		assert.NotContains(t, string(body), "percounter_checkpoint_max_staleness_seconds")
+	})
+
+	t.Run("the traffic is counted once per message on the wire", func(t *testing.T) {
+		c, server := newServer(t)
+		port := randomPort()
+		peer := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port)
+		observer := newTestClusterObserver()
+		peer.SetClusterObserver(observer)
+		require.NoError(t, peer.Start())
+		defer peer.Stop()
+		c.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port)})
+		c.Increment("x")
+		c.Increment("x")
+		waitForMultiGcounterValueOf(t, 2, peer, "x")
+
+		received := func() (messages, bytes int64) {
+			for _, m := range observer.MessagesReceived() {
+				messages++
+				bytes += int64(len(m.msg))
+			}
+			return messages, bytes
+		}
+		sent := func() (messages, bytes int64) {
+			metrics := metricsOf(t, server.URL)
+			return metrics["percounter_messages_sent_total"], metrics["percounter_bytes_sent_total"]
+		}
+		waitFor(t, func() bool {
+			messages, bytes := sent()
+			expectedMessages, expectedBytes := received()
+			return messages == expectedMessages && bytes == expectedBytes
+		})
+		messages, bytes := sent()
+		expectedMessages, expectedBytes := received()
+		assert.Equal(t, expectedMessages, messages)
+		assert.Equal(t, expectedBytes, bytes)
+		assert.Positive(t, bytes)
+	})
+
+	t.Run("checkpoint staleness is part of the metrics", func(t *testing.T) {
+		c, _ := newServer(t)
+		now := time.Unix(100, 0)
+		registry := NewEmergencyPersistenceWithoutSignals()
+		registry.AddForPersistence(&testPersistent{})
+		api := NewHTTPAPI(c)
+		api.SetCheckpointer(NewCheckpointerWithClock(registry, time.Hour, func() time.Time { return now }))
+		now = now.Add(1500 * time.Millisecond)
+
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Contains(t, recorder.Body.String(), "percounter_checkpoint_max_staleness_seconds 1.5\n")
+	})
+}
+
+// metricsOf are the integer metrics without labels
+func metricsOf(t *testing.T, url string) map[string]int64 {
+	res, err := http.Get(url + "/metrics")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	metrics := map[string]int64{}
+	for _, line := range strings.Split(string(body), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if value, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			metrics[fields[0]] = value
+		}
+	}
+	return metrics
+}
+
+func requestJSON(t *testing.T, method, url string, body any) int {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.NoError(t, json.NewDecoder(res.Body).Decode(body))
+	return res.StatusCode
+}
@@ -0,0 +1,38 @@
+package percounter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var ErrIdentityCollision = errors.New("identity collision")
+
+// IdentityCollisionError reports another node using the identity of this one,
+// in which case both write into the same slot of the counters and counts are lost
+type IdentityCollisionError struct {
+	Identity string
+	// Address of the other node, if known
+	Address string
+	Reason  string
+}
+
+func (e *IdentityCollisionError) Error() string {
+	by := "another node"
+	if e.Address != "" {
+		by += " at " + e.Address
+	}
+	return fmt.Sprintf("identity '%s' is also used by %s: %s", e.Identity, by, e.Reason)
+}
+
+func (e *IdentityCollisionError) Is(target error) bool {
+	return target == ErrIdentityCollision
+}
+
+// newInstanceID tells apart the processes using the same identity
+func newInstanceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
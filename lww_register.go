@@ -0,0 +1,75 @@
+package percounter
+
+type LWWRegisterState struct {
+	Name      string       `json:"name"`
+	Value     string       `json:"value"`
+	Timestamp HLCTimestamp `json:"timestamp"`
+	Peer      string       `json:"peer"`
+}
+
+func NewNamedLWWRegisterState(name string) LWWRegisterState {
+	return LWWRegisterState{
+		Name: name,
+	}
+}
+
+func (s LWWRegisterState) GetState() LWWRegisterState {
+	return s
+}
+
+// wins is true if the state was written after the other one, ties broken by the peer identity
+func (s LWWRegisterState) wins(other LWWRegisterState) bool {
+	if s.Timestamp != other.Timestamp {
+		return other.Timestamp.Before(s.Timestamp)
+	}
+	return s.Peer > other.Peer
+}
+
+// LWWRegister is a last-writer-wins register for small values
+type LWWRegister struct {
+	identity string
+	clock    *HybridLogicalClock
+	state    LWWRegisterState
+}
+
+func NewLWWRegister(identity string) *LWWRegister {
+	return NewLWWRegisterFromState(identity, NewNamedLWWRegisterState("singleton"))
+}
+
+func NewLWWRegisterFromState(identity string, state LWWRegisterState) *LWWRegister {
+	return NewLWWRegisterWithClock(identity, state, NewHybridLogicalClock())
+}
+
+func NewLWWRegisterWithClock(identity string, state LWWRegisterState, clock *HybridLogicalClock) *LWWRegister {
+	// never write with a timestamp older than the restored one
+	clock.Update(state.Timestamp)
+	return &LWWRegister{
+		identity: identity,
+		clock:    clock,
+		state:    state,
+	}
+}
+
+func (r *LWWRegister) Set(value string) {
+	r.state.Value = value
+	r.state.Timestamp = r.clock.Now()
+	r.state.Peer = r.identity
+}
+
+func (r *LWWRegister) Value() string {
+	return r.state.Value
+}
+
+func (r *LWWRegister) MergeWith(other LWWRegisterStateSource) {
+	otherState := other.GetState()
+	r.clock.Update(otherState.Timestamp)
+	if otherState.wins(r.state) {
+		r.state.Value = otherState.Value
+		r.state.Timestamp = otherState.Timestamp
+		r.state.Peer = otherState.Peer
+	}
+}
+
+func (r *LWWRegister) GetState() LWWRegisterState {
+	return r.state
+}
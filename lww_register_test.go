@@ -0,0 +1,45 @@
+package percounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLWWRegister(t *testing.T) {
+	t.Run("the last write wins", func(t *testing.T) {
+		r1 := NewLWWRegister("1")
+		r2 := NewLWWRegister("2")
+		r1.Set("a")
+		r2.MergeWith(r1)
+		r2.Set("b")
+		r1.MergeWith(r2)
+		assert.Equal(t, "b", r1.Value())
+		assert.Equal(t, "b", r2.Value())
+	})
+
+	t.Run("a write after a merge wins even with a lagging wall clock", func(t *testing.T) {
+		ahead := NewLWWRegisterWithClock("1", NewNamedLWWRegisterState("r"),
+			NewHybridLogicalClockWithTimeSource(func() time.Time { return time.Unix(200, 0) }))
+		behind := NewLWWRegisterWithClock("2", NewNamedLWWRegisterState("r"),
+			NewHybridLogicalClockWithTimeSource(func() time.Time { return time.Unix(100, 0) }))
+		ahead.Set("from the future")
+		behind.MergeWith(ahead)
+		behind.Set("later")
+		ahead.MergeWith(behind)
+		assert.Equal(t, "later", ahead.Value())
+	})
+
+	t.Run("concurrent writes are resolved by the peer identity", func(t *testing.T) {
+		clock := func() time.Time { return time.Unix(100, 0) }
+		r1 := NewLWWRegisterWithClock("1", NewNamedLWWRegisterState("r"), NewHybridLogicalClockWithTimeSource(clock))
+		r2 := NewLWWRegisterWithClock("2", NewNamedLWWRegisterState("r"), NewHybridLogicalClockWithTimeSource(clock))
+		r1.Set("one")
+		r2.Set("two")
+		r1.MergeWith(r2)
+		r2.MergeWith(r1)
+		assert.Equal(t, "two", r1.Value())
+		assert.Equal(t, "two", r2.Value())
+	})
+}
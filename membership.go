@@ -0,0 +1,254 @@
+package percounter
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+type MemberState string
+
+const (
+	MemberAlive   MemberState = "alive"
+	MemberSuspect MemberState = "suspect"
+	MemberDead    MemberState = "dead"
+)
+
+type Member struct {
+	Identity    string      `json:"identity"`
+	Address     string      `json:"address,omitempty"`
+	State       MemberState `json:"state"`
+	LastSeen    time.Time   `json:"last_seen"`
+	Incarnation uint64      `json:"incarnation"`
+}
+
+// MemberUpdate is the gossiped view of a member, see Membership.Apply
+type MemberUpdate struct {
+	Identity    string      `json:"identity"`
+	Address     string      `json:"address,omitempty"`
+	State       MemberState `json:"state"`
+	Incarnation uint64      `json:"incarnation"`
+}
+
+func (m Member) Update() MemberUpdate {
+	return MemberUpdate{
+		Identity:    m.Identity,
+		Address:     m.Address,
+		State:       m.State,
+		Incarnation: m.Incarnation,
+	}
+}
+
+type MembershipChange struct {
+	Member   Member
+	Previous MemberState
+}
+
+type MembershipObserver interface {
+	OnMembershipChange(ch MembershipChange)
+}
+
+// MembershipConfig: a member not heard of for SuspectTimeout is suspected, after DeadTimeout it is considered dead.
+// A zero HeartbeatInterval disables periodic heartbeats, and with them the timeouts: silence is no evidence of failure then
+type MembershipConfig struct {
+	HeartbeatInterval time.Duration
+	SuspectTimeout    time.Duration
+	DeadTimeout       time.Duration
+}
+
+func DefaultMembershipConfig() MembershipConfig {
+	return MembershipConfig{
+		SuspectTimeout: 5 * time.Second,
+		DeadTimeout:    30 * time.Second,
+	}
+}
+
+type Membership struct {
+	phony.Inbox
+	config    MembershipConfig
+	now       func() time.Time
+	members   map[string]*Member
+	observers []MembershipObserver
+}
+
+func NewMembership(config MembershipConfig) *Membership {
+	return NewMembershipWithClock(config, time.Now)
+}
+
+func NewMembershipWithClock(config MembershipConfig, now func() time.Time) *Membership {
+	return &Membership{
+		config:    config,
+		now:       now,
+		members:   make(map[string]*Member),
+		observers: []MembershipObserver{},
+	}
+}
+
+func (m *Membership) SetConfig(config MembershipConfig) {
+	phony.Block(m, func() {
+		m.config = config
+	})
+}
+
+func (m *Membership) Config() MembershipConfig {
+	var res MembershipConfig
+	phony.Block(m, func() {
+		res = m.config
+	})
+	return res
+}
+
+func (m *Membership) AddObserver(o MembershipObserver) {
+	phony.Block(m, func() {
+		m.observers = append(m.observers, o)
+	})
+}
+
+// Seen records a sign of life of a member, the address is only updated if known
+func (m *Membership) Seen(identity, address string) {
+	m.Act(m, func() {
+		m.seenSync(identity, address)
+	})
+}
+
+// Tick re-evaluates the member states, notifying the observers of changes
+func (m *Membership) Tick() {
+	m.Act(m, func() {
+		m.evaluateSync()
+	})
+}
+
+func (m *Membership) Members() []Member {
+	var res []Member
+	phony.Block(m, func() {
+		m.evaluateSync()
+		for _, member := range m.members {
+			res = append(res, *member)
+		}
+	})
+	slices.SortFunc(res, func(a, b Member) int {
+		return strings.Compare(a.Identity, b.Identity)
+	})
+	return res
+}
+
+// Apply merges a gossiped member update following the SWIM precedence rules:
+// a higher incarnation refutes suspicion, suspicion overrides 'alive' of the same incarnation,
+// and 'dead' overrides everything but a higher incarnation. Returns true if the update was news
+func (m *Membership) Apply(u MemberUpdate) bool {
+	var res bool
+	phony.Block(m, func() {
+		res = m.applySync(u)
+	})
+	return res
+}
+
+func (m *Membership) Member(identity string) (Member, bool) {
+	var res Member
+	var ok bool
+	phony.Block(m, func() {
+		var member *Member
+		member, ok = m.members[identity]
+		if ok {
+			res = *member
+		}
+	})
+	return res, ok
+}
+
+func (m *Membership) AliveMembers() []Member {
+	return slices.DeleteFunc(m.Members(), func(member Member) bool {
+		return member.State != MemberAlive
+	})
+}
+
+func (m *Membership) seenSync(identity, address string) {
+	if identity == "" {
+		return
+	}
+	member, ok := m.members[identity]
+	if !ok {
+		member = &Member{Identity: identity}
+		m.members[identity] = member
+	}
+	if address != "" {
+		member.Address = address
+	}
+	member.LastSeen = m.now()
+	m.setStateSync(member, MemberAlive)
+}
+
+func (m *Membership) applySync(u MemberUpdate) bool {
+	if u.Identity == "" {
+		return false
+	}
+	member, ok := m.members[u.Identity]
+	if !ok {
+		m.members[u.Identity] = &Member{
+			Identity:    u.Identity,
+			Address:     u.Address,
+			LastSeen:    m.now(),
+			Incarnation: u.Incarnation,
+		}
+		m.setStateSync(m.members[u.Identity], u.State)
+		return true
+	}
+	if !supersedes(u, member.Update()) {
+		return false
+	}
+	if u.Address != "" {
+		member.Address = u.Address
+	}
+	if u.State == MemberAlive {
+		member.LastSeen = m.now()
+	}
+	member.Incarnation = u.Incarnation
+	m.setStateSync(member, u.State)
+	return true
+}
+
+func supersedes(u, current MemberUpdate) bool {
+	switch u.State {
+	case MemberAlive:
+		return u.Incarnation > current.Incarnation
+	case MemberSuspect:
+		if current.State == MemberAlive {
+			return u.Incarnation >= current.Incarnation
+		}
+		return u.Incarnation > current.Incarnation
+	case MemberDead:
+		return current.State != MemberDead && u.Incarnation >= current.Incarnation
+	}
+	return false
+}
+
+func (m *Membership) evaluateSync() {
+	if m.config.HeartbeatInterval <= 0 {
+		return
+	}
+	now := m.now()
+	for _, identity := range slices.Sorted(maps.Keys(m.members)) {
+		member := m.members[identity]
+		silence := now.Sub(member.LastSeen)
+		switch {
+		case m.config.DeadTimeout > 0 && silence >= m.config.DeadTimeout:
+			m.setStateSync(member, MemberDead)
+		case m.config.SuspectTimeout > 0 && silence >= m.config.SuspectTimeout:
+			m.setStateSync(member, MemberSuspect)
+		}
+	}
+}
+
+func (m *Membership) setStateSync(member *Member, state MemberState) {
+	previous := member.State
+	if previous == state {
+		return
+	}
+	member.State = state
+	for _, o := range m.observers {
+		o.OnMembershipChange(MembershipChange{*member, previous})
+	}
+}
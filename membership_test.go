@@ -0,0 +1,104 @@
+package percounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMembership(t *testing.T) {
+	t.Run("members become suspect and dead when not heard of", func(t *testing.T) {
+		now := time.Unix(100, 0)
+		m := NewMembershipWithClock(MembershipConfig{
+			HeartbeatInterval: time.Second,
+			SuspectTimeout:    2 * time.Second,
+			DeadTimeout:       5 * time.Second,
+		}, func() time.Time { return now })
+		observer := &testMembershipObserver{}
+		m.AddObserver(observer)
+
+		m.Seen("1", "tcp://[::1]:5000")
+		m.Seen("2", "")
+		members := m.Members()
+		require.Len(t, members, 2)
+		assert.Equal(t, Member{"1", "tcp://[::1]:5000", MemberAlive, now, 0}, members[0])
+		assert.Equal(t, MemberAlive, members[1].State)
+
+		now = now.Add(3 * time.Second)
+		m.Seen("1", "")
+		assert.Equal(t, []MemberState{MemberAlive, MemberSuspect}, statesOf(m.Members()))
+
+		now = now.Add(3 * time.Second)
+		assert.Equal(t, []MemberState{MemberSuspect, MemberDead}, statesOf(m.Members()))
+		assert.Len(t, m.AliveMembers(), 0)
+
+		// coming back
+		m.Seen("2", "")
+		assert.Equal(t, []MemberState{MemberSuspect, MemberAlive}, statesOf(m.Members()))
+		// the address is kept
+		assert.Equal(t, "tcp://[::1]:5000", m.Members()[0].Address)
+
+		assert.Equal(t, []MembershipChange{
+			{Member{"1", "tcp://[::1]:5000", MemberAlive, time.Unix(100, 0), 0}, ""},
+			{Member{"2", "", MemberAlive, time.Unix(100, 0), 0}, ""},
+			{Member{"2", "", MemberSuspect, time.Unix(100, 0), 0}, MemberAlive},
+			{Member{"1", "tcp://[::1]:5000", MemberSuspect, time.Unix(103, 0), 0}, MemberAlive},
+			{Member{"2", "", MemberDead, time.Unix(100, 0), 0}, MemberSuspect},
+			{Member{"2", "", MemberAlive, time.Unix(106, 0), 0}, MemberDead},
+		}, observer.Seen())
+	})
+
+	t.Run("zero timeouts disable failure detection", func(t *testing.T) {
+		now := time.Unix(100, 0)
+		m := NewMembershipWithClock(MembershipConfig{}, func() time.Time { return now })
+		m.Seen("1", "")
+		assert.Len(t, m.Members(), 1)
+		now = now.Add(time.Hour)
+		assert.Equal(t, []MemberState{MemberAlive}, statesOf(m.Members()))
+	})
+
+	t.Run("silence is no evidence of failure without heartbeats", func(t *testing.T) {
+		now := time.Unix(100, 0)
+		m := NewMembershipWithClock(DefaultMembershipConfig(), func() time.Time { return now })
+		m.Seen("1", "")
+		assert.Len(t, m.Members(), 1)
+		now = now.Add(time.Hour)
+		assert.Equal(t, []MemberState{MemberAlive}, statesOf(m.Members()))
+	})
+
+	t.Run("gossiped updates follow the incarnation precedence", func(t *testing.T) {
+		m := NewMembership(MembershipConfig{})
+		assert.True(t, m.Apply(MemberUpdate{"1", "tcp://[::1]:5000", MemberAlive, 0}))
+		assert.False(t, m.Apply(MemberUpdate{"1", "", MemberAlive, 0}))
+
+		// suspicion overrides an alive member of the same incarnation
+		assert.True(t, m.Apply(MemberUpdate{"1", "", MemberSuspect, 0}))
+		assert.False(t, m.Apply(MemberUpdate{"1", "", MemberSuspect, 0}))
+
+		// refuted by a fresher incarnation
+		assert.True(t, m.Apply(MemberUpdate{"1", "", MemberAlive, 1}))
+		assert.False(t, m.Apply(MemberUpdate{"1", "", MemberSuspect, 0}))
+		member, ok := m.Member("1")
+		require.True(t, ok)
+		assert.Equal(t, MemberUpdate{"1", "tcp://[::1]:5000", MemberAlive, 1}, member.Update())
+
+		// death is final for the incarnation
+		assert.True(t, m.Apply(MemberUpdate{"1", "", MemberDead, 1}))
+		assert.False(t, m.Apply(MemberUpdate{"1", "", MemberAlive, 1}))
+		assert.False(t, m.Apply(MemberUpdate{"1", "", MemberDead, 2}))
+		assert.True(t, m.Apply(MemberUpdate{"1", "", MemberAlive, 2}))
+
+		_, ok = m.Member("2")
+		assert.False(t, ok)
+	})
+}
+
+func statesOf(members []Member) []MemberState {
+	res := []MemberState{}
+	for _, m := range members {
+		res = append(res, m.State)
+	}
+	return res
+}
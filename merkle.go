@@ -0,0 +1,152 @@
+package percounter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// merkleDepth hex digits of the key hash select the leaf bucket of a replica: 4096 buckets
+const merkleDepth = 3
+
+const merkleFanout = "0123456789abcdef"
+
+// MerkleTree summarizes a StateDigest by buckets of replica key hashes. A node is addressed
+// by its hex prefix, the root being "". Peers descend only into the subtrees whose hashes differ
+type MerkleTree struct {
+	nodes   map[string]string
+	buckets map[string]StateDigest
+}
+
+func NewMerkleTree(d StateDigest) *MerkleTree {
+	t := &MerkleTree{
+		nodes:   map[string]string{},
+		buckets: map[string]StateDigest{},
+	}
+	for typeTag, names := range d {
+		for name, hash := range names {
+			bucket := merkleBucketOf(typeTag, name)
+			if _, ok := t.buckets[bucket]; !ok {
+				t.buckets[bucket] = StateDigest{}
+			}
+			t.buckets[bucket].Set(typeTag, name, hash)
+		}
+	}
+	for bucket, digest := range t.buckets {
+		t.nodes[bucket] = merkleLeafHashOf(digest)
+	}
+	for level := merkleDepth - 1; level >= 0; level-- {
+		for _, prefix := range t.prefixesAt(level + 1) {
+			parent := prefix[:level]
+			if _, ok := t.nodes[parent]; ok {
+				continue
+			}
+			t.nodes[parent] = t.innerHashOf(parent)
+		}
+	}
+	return t
+}
+
+func (t *MerkleTree) Root() string {
+	return t.Hash("")
+}
+
+// Hash of the subtree at the prefix, empty if there are no replicas in it
+func (t *MerkleTree) Hash(prefix string) string {
+	return t.nodes[prefix]
+}
+
+// Children of an inner node, including the empty ones
+func (t *MerkleTree) Children(prefix string) map[string]string {
+	res := map[string]string{}
+	for _, digit := range merkleFanout {
+		child := prefix + string(digit)
+		res[child] = t.Hash(child)
+	}
+	return res
+}
+
+func (t *MerkleTree) IsLeaf(prefix string) bool {
+	return len(prefix) >= merkleDepth
+}
+
+// Bucket is the digest of the replicas under the prefix
+func (t *MerkleTree) Bucket(prefix string) StateDigest {
+	res := StateDigest{}
+	for bucket, digest := range t.buckets {
+		if !strings.HasPrefix(bucket, prefix) {
+			continue
+		}
+		for typeTag, names := range digest {
+			for name, hash := range names {
+				res.Set(typeTag, name, hash)
+			}
+		}
+	}
+	return res
+}
+
+// Diff are the nodes of the other side whose hashes differ from this tree
+func (t *MerkleTree) Diff(nodes map[string]string) []string {
+	res := []string{}
+	for _, prefix := range slices.Sorted(maps.Keys(nodes)) {
+		if t.Hash(prefix) != nodes[prefix] {
+			res = append(res, prefix)
+		}
+	}
+	return res
+}
+
+func (t *MerkleTree) prefixesAt(level int) []string {
+	res := []string{}
+	for prefix := range t.nodes {
+		if len(prefix) == level {
+			res = append(res, prefix)
+		}
+	}
+	return res
+}
+
+func (t *MerkleTree) innerHashOf(prefix string) string {
+	h := sha256.New()
+	for _, digit := range merkleFanout {
+		child := prefix + string(digit)
+		if hash := t.nodes[child]; hash != "" {
+			h.Write([]byte(child + "=" + hash + "\n"))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func merkleLeafHashOf(d StateDigest) string {
+	h := sha256.New()
+	for _, typeTag := range slices.Sorted(maps.Keys(d)) {
+		for _, name := range slices.Sorted(maps.Keys(d[typeTag])) {
+			h.Write([]byte(typeTag + "\x00" + name + "\x00" + d[typeTag][name] + "\n"))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func merkleBucketOf(typeTag, name string) string {
+	sum := sha256.Sum256([]byte(typeTag + "\x00" + name))
+	return hex.EncodeToString(sum[:])[:merkleDepth]
+}
+
+// within restricts the digest to the replicas in the Merkle subtrees of the prefixes
+func (d StateDigest) within(prefixes []string) StateDigest {
+	res := StateDigest{}
+	for typeTag, names := range d {
+		for name, hash := range names {
+			bucket := merkleBucketOf(typeTag, name)
+			if slices.ContainsFunc(prefixes, func(prefix string) bool {
+				return strings.HasPrefix(bucket, prefix)
+			}) {
+				res.Set(typeTag, name, hash)
+			}
+		}
+	}
+	return res
+}
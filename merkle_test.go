@@ -0,0 +1,66 @@
+package percounter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerkleTree(t *testing.T) {
+	digestOfCounters := func(n int) StateDigest {
+		res := StateDigest{}
+		for i := range n {
+			res.Set(GCounterNetworkMessage, fmt.Sprintf("counter-%d", i), fmt.Sprintf("%d", i))
+		}
+		return res
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		tree := NewMerkleTree(StateDigest{})
+		assert.Equal(t, "", tree.Root())
+		assert.Empty(t, tree.Diff(map[string]string{"": ""}))
+		assert.Len(t, tree.Children(""), 16)
+	})
+
+	t.Run("equal digests have equal roots", func(t *testing.T) {
+		a := NewMerkleTree(digestOfCounters(1000))
+		b := NewMerkleTree(digestOfCounters(1000))
+		assert.NotEmpty(t, a.Root())
+		assert.Equal(t, a.Root(), b.Root())
+		assert.Empty(t, a.Diff(b.Children("")))
+	})
+
+	t.Run("descending to the divergent bucket", func(t *testing.T) {
+		da := digestOfCounters(1000)
+		db := digestOfCounters(1000)
+		db.Set(GCounterNetworkMessage, "counter-42", "changed")
+		a := NewMerkleTree(da)
+		b := NewMerkleTree(db)
+
+		diff := a.Diff(map[string]string{"": b.Root()})
+		roundTrips := 0
+		for !a.IsLeaf(diff[0]) {
+			roundTrips++
+			assert.Len(t, diff, 1)
+			diff = a.Diff(b.Children(diff[0]))
+		}
+		assert.Equal(t, merkleDepth, roundTrips)
+		assert.Equal(t, []string{merkleBucketOf(GCounterNetworkMessage, "counter-42")}, diff)
+
+		bucket := b.Bucket(diff[0])
+		hash, ok := bucket.Get(GCounterNetworkMessage, "counter-42")
+		assert.True(t, ok)
+		assert.Equal(t, "changed", hash)
+		assert.Equal(t, bucket, db.within(diff))
+		assert.Equal(t, []replicaKey{{GCounterNetworkMessage, "counter-42"}}, bucket.staleIn(a.Bucket(diff[0])))
+	})
+
+	t.Run("missing subtrees differ", func(t *testing.T) {
+		d := StateDigest{}
+		d.Set(GSetNetworkMessage, "a", "1")
+		tree := NewMerkleTree(d)
+		bucket := merkleBucketOf(GSetNetworkMessage, "a")
+		assert.Equal(t, []string{bucket[:1]}, tree.Diff(NewMerkleTree(StateDigest{}).Children("")))
+	})
+}
@@ -0,0 +1,122 @@
+package percounter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IdentityFilename is the file in the counter directory holding the generated identity of the node
+const IdentityFilename = "identity"
+
+// LoadOrCreateIdentity returns the identity stored in dirname, generating and storing a new one if there is none.
+// A wiped directory thus results in a new identity instead of reusing the slot of the lost counts
+func LoadOrCreateIdentity(dirname string) (string, error) {
+	filename := filepath.Join(dirname, IdentityFilename)
+	contents, err := os.ReadFile(filename)
+	if err == nil {
+		identity := strings.TrimSpace(string(contents))
+		if identity == "" || strings.ContainsAny(identity, " \t\r\n") {
+			return "", fmt.Errorf("%s does not contain a valid identity", filename)
+		}
+		return identity, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dirname, 0755); err != nil {
+		return "", err
+	}
+	identity, err := newNodeIdentity()
+	if err != nil {
+		return "", err
+	}
+	// written aside and renamed not to leave a partial identity behind
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, []byte(identity+"\n"), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return "", err
+	}
+	return identity, nil
+}
+
+// NewZmqMultiGcounterWithStoredIdentity uses the identity stored in dirname, see LoadOrCreateIdentity,
+// refusing it if it is retired in any of the counters
+func NewZmqMultiGcounterWithStoredIdentity(dirname, bindAddr string) (*ZmqMultiGcounter, error) {
+	identity, err := LoadOrCreateIdentity(dirname)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := filepath.Glob(filepath.Join(dirname, "*"+GCounterCRDTType.Extension))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNotRetiredIn(identity, counters...); err != nil {
+		return nil, err
+	}
+	return NewZmqMultiGcounter(identity, dirname, bindAddr), nil
+}
+
+// NewPersistentGCounterWithStoredIdentity uses the identity stored next to filename, see LoadOrCreateIdentity,
+// refusing it if it is retired in the counter
+func NewPersistentGCounterWithStoredIdentity(filename string) (*PersistentGCounter, error) {
+	identity, err := LoadOrCreateIdentity(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNotRetiredIn(identity, filename); err != nil {
+		return nil, err
+	}
+	return NewPersistentGCounter(identity, filename), nil
+}
+
+// RemoveStoredIdentity removes the identity stored in dirname if it is the given one,
+// for the next LoadOrCreateIdentity to generate a new one
+func RemoveStoredIdentity(dirname, identity string) error {
+	filename := filepath.Join(dirname, IdentityFilename)
+	contents, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(contents)) != identity {
+		return nil
+	}
+	return os.Remove(filename)
+}
+
+// checkNotRetiredIn skips missing or unreadable counters, which are reported when loaded
+func checkNotRetiredIn(identity string, filenames ...string) error {
+	for _, filename := range filenames {
+		state, err := ReadGCounterFile(filename)
+		if err != nil {
+			continue
+		}
+		if state.Retired.folded(identity) {
+			return fmt.Errorf("%w: '%s' in %s", ErrIdentityRetired, identity, filename)
+		}
+	}
+	return nil
+}
+
+// newNodeIdentity is random, prefixed with the hostname for readability
+func newNodeIdentity() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	identity := hex.EncodeToString(b)
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && !strings.ContainsAny(hostname, " \t\r\n") {
+		identity = hostname + "-" + identity
+	}
+	return identity, nil
+}
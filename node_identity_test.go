@@ -0,0 +1,78 @@
+package percounter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoredIdentity(t *testing.T) {
+	t.Run("the identity is generated once and reused", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "counters")
+		identity, err := LoadOrCreateIdentity(dir)
+		require.NoError(t, err)
+		assert.NotEmpty(t, identity)
+		assert.FileExists(t, filepath.Join(dir, IdentityFilename))
+
+		again, err := LoadOrCreateIdentity(dir)
+		require.NoError(t, err)
+		assert.Equal(t, identity, again)
+
+		other, err := LoadOrCreateIdentity(t.TempDir())
+		require.NoError(t, err)
+		assert.NotEqual(t, identity, other)
+	})
+
+	t.Run("a wiped directory results in a new identity", func(t *testing.T) {
+		dir := t.TempDir()
+		identity, err := LoadOrCreateIdentity(dir)
+		require.NoError(t, err)
+
+		require.NoError(t, os.RemoveAll(dir))
+		fresh, err := LoadOrCreateIdentity(dir)
+		require.NoError(t, err)
+		assert.NotEqual(t, identity, fresh)
+	})
+
+	t.Run("invalid identity files are reported", func(t *testing.T) {
+		for _, content := range []string{"", "\n", "two words"} {
+			dir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(dir, IdentityFilename), []byte(content), 0644))
+			_, err := LoadOrCreateIdentity(dir)
+			assert.Error(t, err, content)
+		}
+	})
+
+	t.Run("counters count in the slot of the stored identity across restarts", func(t *testing.T) {
+		// not in the working directory, where the identity file would be left behind
+		filename := filepath.Join(t.TempDir(), "a.gcounter")
+		{
+			c, err := NewPersistentGCounterWithStoredIdentity(filename)
+			require.NoError(t, err)
+			c.Increment()
+			waitForGcounterValueOf(t, 1, c)
+			c.PersistSync()
+		}
+
+		c, err := NewPersistentGCounterWithStoredIdentity(filename)
+		require.NoError(t, err)
+		c.Increment()
+		waitForGcounterValueOf(t, 2, c)
+		assert.Len(t, c.GetState().Peers, 1)
+	})
+
+	t.Run("multi counters use the stored identity", func(t *testing.T) {
+		dir := t.TempDir()
+		identity, err := LoadOrCreateIdentity(dir)
+		require.NoError(t, err)
+
+		c, err := NewZmqMultiGcounterWithStoredIdentity(dir, "tcp://:"+randomPort())
+		require.NoError(t, err)
+		assert.Equal(t, identity, c.Identity())
+		require.NoError(t, c.LoadAllSync())
+		assert.Empty(t, c.CounterNames())
+	})
+}
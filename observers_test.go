@@ -14,6 +14,33 @@ type testMessageEvent struct {
 	msg  string
 }
 
+// testRecorder records the events seen by the observers embedding it
+type testRecorder[T any] struct {
+	phony.Inbox
+	seen []T
+}
+
+func (r *testRecorder[T]) record(ev T) {
+	r.Act(r, func() {
+		r.seen = append(r.seen, ev)
+	})
+}
+
+func (r *testRecorder[T]) Seen() []T {
+	var res []T
+	phony.Block(r, func() {
+		res = append(res, r.seen...)
+	})
+	return res
+}
+
+func (r *testRecorder[T]) WaitForSeen(t *testing.T, expectedCount int) []T {
+	waitFor(t, func() bool { return expectedCount == len(r.Seen()) })
+	res := r.Seen()
+	assert.Len(t, res, expectedCount)
+	return res
+}
+
 type testCounterObserver struct {
 	phony.Inbox
 	valuesSeen []CountEvent
@@ -93,3 +120,56 @@ func (o *testClusterObserver) MessagesSent() []testMessageEvent {
 	})
 	return res
 }
+
+type testSetObserver struct {
+	testRecorder[SetEvent]
+}
+
+func (o *testSetObserver) OnNewElements(ev SetEvent) {
+	o.record(ev)
+}
+
+type testValueObserver struct {
+	testRecorder[ValueEvent]
+}
+
+func (o *testValueObserver) OnNewValue(ev ValueEvent) {
+	o.record(ev)
+}
+
+type testMembershipObserver struct {
+	testRecorder[MembershipChange]
+}
+
+func (o *testMembershipObserver) OnMembershipChange(ch MembershipChange) {
+	o.record(ch)
+}
+
+type testPeerUpdater struct {
+	testRecorder[[]string]
+}
+
+func (o *testPeerUpdater) UpdatePeers(peers []string) {
+	o.record(peers)
+}
+
+type testPeerConfigObserver struct {
+	configs testRecorder[PeerConfig]
+	errors  testRecorder[error]
+}
+
+func (o *testPeerConfigObserver) OnPeerConfig(c PeerConfig) {
+	o.configs.record(c)
+}
+
+func (o *testPeerConfigObserver) OnPeerConfigError(err error) {
+	o.errors.record(err)
+}
+
+type testIdentityCollisionObserver struct {
+	testRecorder[*IdentityCollisionError]
+}
+
+func (o *testIdentityCollisionObserver) OnIdentityCollision(err *IdentityCollisionError) {
+	o.record(err)
+}
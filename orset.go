@@ -0,0 +1,137 @@
+package percounter
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ORSetState is an add-wins observed-remove set:
+// each add is tagged uniquely, a remove only tombstones the tags it has observed
+type ORSetState struct {
+	Name    string                     `json:"name"`
+	Clock   map[string]int64           `json:"clock"`
+	Adds    map[string]map[string]bool `json:"adds"`
+	Removes map[string]map[string]bool `json:"removes"`
+}
+
+func NewORSetState() ORSetState {
+	return NewNamedORSetState("singleton")
+}
+
+func NewNamedORSetState(name string) ORSetState {
+	return ORSetState{
+		Name:    name,
+		Clock:   make(map[string]int64),
+		Adds:    make(map[string]map[string]bool),
+		Removes: make(map[string]map[string]bool),
+	}
+}
+
+func (s ORSetState) Copy() ORSetState {
+	return ORSetState{
+		Name:    s.Name,
+		Clock:   maps.Clone(s.Clock),
+		Adds:    cloneTagSets(s.Adds),
+		Removes: cloneTagSets(s.Removes),
+	}
+}
+
+type ORSet struct {
+	identity string
+	state    ORSetState
+}
+
+func NewORSetFromState(identity string, state ORSetState) *ORSet {
+	if state.Clock == nil {
+		state.Clock = make(map[string]int64)
+	}
+	if state.Adds == nil {
+		state.Adds = make(map[string]map[string]bool)
+	}
+	if state.Removes == nil {
+		state.Removes = make(map[string]map[string]bool)
+	}
+	return &ORSet{
+		identity: identity,
+		state:    state,
+	}
+}
+
+func NewORSet(identity string) *ORSet {
+	return NewORSetFromState(identity, NewORSetState())
+}
+
+func (s *ORSet) Add(element string) {
+	s.state.Clock[s.identity]++
+	tag := fmt.Sprintf("%s:%d", s.identity, s.state.Clock[s.identity])
+	addTag(s.state.Adds, element, tag)
+}
+
+func (s *ORSet) Remove(element string) {
+	for tag := range s.state.Adds[element] {
+		addTag(s.state.Removes, element, tag)
+	}
+}
+
+func (s *ORSet) Contains(element string) bool {
+	for tag := range s.state.Adds[element] {
+		if !s.state.Removes[element][tag] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ORSet) Elements() []string {
+	res := []string{}
+	for element := range s.state.Adds {
+		if s.Contains(element) {
+			res = append(res, element)
+		}
+	}
+	slices.Sort(res)
+	return res
+}
+
+func (s *ORSet) Len() int {
+	return len(s.Elements())
+}
+
+func (s *ORSet) MergeWith(other ORSetStateSource) {
+	otherState := other.GetState()
+	for peer, value := range otherState.Clock {
+		s.state.Clock[peer] = max(s.state.Clock[peer], value)
+	}
+	for element, tags := range otherState.Adds {
+		for tag := range tags {
+			addTag(s.state.Adds, element, tag)
+		}
+	}
+	for element, tags := range otherState.Removes {
+		for tag := range tags {
+			addTag(s.state.Removes, element, tag)
+		}
+	}
+}
+
+func (s *ORSet) GetState() ORSetState {
+	return s.state
+}
+
+func addTag(tagSets map[string]map[string]bool, element, tag string) {
+	tags, ok := tagSets[element]
+	if !ok {
+		tags = make(map[string]bool)
+		tagSets[element] = tags
+	}
+	tags[tag] = true
+}
+
+func cloneTagSets(tagSets map[string]map[string]bool) map[string]map[string]bool {
+	res := make(map[string]map[string]bool, len(tagSets))
+	for element, tags := range tagSets {
+		res[element] = maps.Clone(tags)
+	}
+	return res
+}
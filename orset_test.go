@@ -0,0 +1,59 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestORSet(t *testing.T) {
+	t.Run("adding and removing elements", func(t *testing.T) {
+		s := NewORSet("1")
+		s.Add("a")
+		s.Add("b")
+		s.Remove("a")
+		assert.False(t, s.Contains("a"))
+		assert.Equal(t, []string{"b"}, s.Elements())
+
+		// re-adding is possible
+		s.Add("a")
+		assert.Equal(t, []string{"a", "b"}, s.Elements())
+	})
+
+	t.Run("merging removes that were observed", func(t *testing.T) {
+		s1 := NewORSet("1")
+		s1.Add("a")
+		s2 := NewORSet("2")
+		s2.MergeWith(s1)
+		s2.Remove("a")
+		s1.MergeWith(s2)
+		assert.Empty(t, s1.Elements())
+		assert.Empty(t, s2.Elements())
+	})
+
+	t.Run("concurrent add wins over remove", func(t *testing.T) {
+		s1 := NewORSet("1")
+		s1.Add("a")
+		s2 := NewORSet("2")
+		s2.MergeWith(s1)
+
+		// concurrently: s1 removes, s2 adds again
+		s1.Remove("a")
+		s2.Add("a")
+
+		s1.MergeWith(s2)
+		s2.MergeWith(s1)
+		assert.Equal(t, []string{"a"}, s1.Elements())
+		assert.Equal(t, []string{"a"}, s2.Elements())
+	})
+
+	t.Run("tags stay unique after restoring from state", func(t *testing.T) {
+		s1 := NewORSet("1")
+		s1.Add("a")
+		s1.Remove("a")
+
+		restored := NewORSetFromState("1", s1.GetState().Copy())
+		restored.Add("a")
+		assert.True(t, restored.Contains("a"))
+	})
+}
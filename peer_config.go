@@ -0,0 +1,186 @@
+package percounter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Arceliar/phony"
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultPeerConfigPollInterval = 1 * time.Second
+
+// PeerConfig is the content of a peer configuration file, JSON or YAML depending on the extension.
+// Identity and BindAddr are only relevant at startup
+type PeerConfig struct {
+	Identity string   `json:"identity,omitempty" yaml:"identity,omitempty"`
+	BindAddr string   `json:"bind_addr,omitempty" yaml:"bind_addr,omitempty"`
+	Peers    []string `json:"peers" yaml:"peers"`
+}
+
+func LoadPeerConfig(filename string) (PeerConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return PeerConfig{}, err
+	}
+	return parsePeerConfig(filename, data)
+}
+
+func parsePeerConfig(filename string, data []byte) (PeerConfig, error) {
+	res := PeerConfig{}
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &res)
+	default:
+		err = json.Unmarshal(data, &res)
+	}
+	if err != nil {
+		return PeerConfig{}, fmt.Errorf("could not parse peer configuration %s: %w", filename, err)
+	}
+	if res.Peers == nil {
+		res.Peers = []string{}
+	}
+	return res, nil
+}
+
+// PeerConfigWatcher polls a peer configuration file and updates the peers of the target on change.
+// A file that cannot be read or parsed is reported, the last good peer set stays in place
+type PeerConfigWatcher struct {
+	phony.Inbox
+	filename     string
+	target       PeerUpdater
+	observer     PeerConfigObserver
+	pollInterval time.Duration
+	lastContent  []byte
+	lastErr      error
+	config       PeerConfig
+	loaded       bool
+	stop         chan struct{}
+}
+
+func NewPeerConfigWatcher(filename string, target PeerUpdater) *PeerConfigWatcher {
+	return NewObservablePeerConfigWatcher(filename, target, &noOpPeerConfigObserver{})
+}
+
+func NewObservablePeerConfigWatcher(filename string, target PeerUpdater, observer PeerConfigObserver) *PeerConfigWatcher {
+	return &PeerConfigWatcher{
+		filename:     filename,
+		target:       target,
+		observer:     observer,
+		pollInterval: DefaultPeerConfigPollInterval,
+	}
+}
+
+// SetPollInterval should be called before Start
+func (w *PeerConfigWatcher) SetPollInterval(interval time.Duration) {
+	phony.Block(w, func() {
+		w.pollInterval = interval
+	})
+}
+
+// Start loads the configuration and keeps watching it. The error of the initial load is returned,
+// the watcher is started nevertheless to pick up a fixed file
+func (w *PeerConfigWatcher) Start() error {
+	var err error
+	phony.Block(w, func() {
+		err = w.reloadSync()
+		if w.stop != nil {
+			return
+		}
+		w.stop = make(chan struct{})
+		go w.pollLoop(w.pollInterval, w.stop)
+	})
+	return err
+}
+
+func (w *PeerConfigWatcher) Stop() {
+	phony.Block(w, func() {
+		if w.stop == nil {
+			return
+		}
+		close(w.stop)
+		w.stop = nil
+	})
+}
+
+// Reload checks the file for changes immediately
+func (w *PeerConfigWatcher) Reload() error {
+	var err error
+	phony.Block(w, func() {
+		err = w.reloadSync()
+	})
+	return err
+}
+
+// Config is the last successfully loaded configuration
+func (w *PeerConfigWatcher) Config() (PeerConfig, bool) {
+	var res PeerConfig
+	var loaded bool
+	phony.Block(w, func() {
+		res = w.config
+		res.Peers = slices.Clone(w.config.Peers)
+		loaded = w.loaded
+	})
+	return res, loaded
+}
+
+func (w *PeerConfigWatcher) pollLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.Act(w, func() {
+				_ = w.reloadSync()
+			})
+		}
+	}
+}
+
+func (w *PeerConfigWatcher) reloadSync() error {
+	data, err := os.ReadFile(w.filename)
+	if err != nil {
+		// re-read the content once the file is back
+		w.lastContent = nil
+		return w.reportErrorSync(err)
+	}
+	if w.lastContent != nil && bytes.Equal(data, w.lastContent) {
+		return w.lastErr
+	}
+	w.lastContent = data
+	config, err := parsePeerConfig(w.filename, data)
+	if err != nil {
+		return w.reportErrorSync(err)
+	}
+	w.lastErr = nil
+	peersChanged := !w.loaded || !slices.Equal(config.Peers, w.config.Peers)
+	w.config = config
+	w.loaded = true
+	if peersChanged {
+		log.Printf("peer configuration %s: %v", w.filename, config.Peers)
+		w.target.UpdatePeers(slices.Clone(config.Peers))
+	}
+	w.observer.OnPeerConfig(config)
+	return nil
+}
+
+// reportErrorSync reports each distinct error once
+func (w *PeerConfigWatcher) reportErrorSync(err error) error {
+	if w.lastErr != nil && w.lastErr.Error() == err.Error() {
+		return err
+	}
+	w.lastErr = err
+	log.Printf("peer configuration %s: %v", w.filename, err)
+	w.observer.OnPeerConfigError(err)
+	return err
+}
@@ -0,0 +1,107 @@
+package percounter
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPeerConfig(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "peers.json")
+		writePeerConfigFile(t, filename, `{"identity":"a","bind_addr":"tcp://:5001","peers":["tcp://b:5001"]}`)
+		config, err := LoadPeerConfig(filename)
+		require.NoError(t, err)
+		assert.Equal(t, PeerConfig{"a", "tcp://:5001", []string{"tcp://b:5001"}}, config)
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "peers.yml")
+		writePeerConfigFile(t, filename, "identity: a\nbind_addr: tcp://:5001\npeers:\n  - tcp://b:5001\n  - tcp://c:5001\n")
+		config, err := LoadPeerConfig(filename)
+		require.NoError(t, err)
+		assert.Equal(t, PeerConfig{"a", "tcp://:5001", []string{"tcp://b:5001", "tcp://c:5001"}}, config)
+	})
+
+	t.Run("no peers", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "peers.yaml")
+		writePeerConfigFile(t, filename, "identity: a\n")
+		config, err := LoadPeerConfig(filename)
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, config.Peers)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "peers.json")
+		writePeerConfigFile(t, filename, `{"peers":`)
+		_, err := LoadPeerConfig(filename)
+		assert.Error(t, err)
+	})
+}
+
+func TestPeerConfigWatcher(t *testing.T) {
+	t.Run("peers are updated on change and kept on errors", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "peers.json")
+		writePeerConfigFile(t, filename, `{"peers":["tcp://b:5001"]}`)
+		target := &testPeerUpdater{}
+		observer := &testPeerConfigObserver{}
+		w := NewObservablePeerConfigWatcher(filename, target, observer)
+		w.SetPollInterval(50 * time.Millisecond)
+		require.NoError(t, w.Start())
+		defer w.Stop()
+		target.WaitForSeen(t, 1)
+
+		writePeerConfigFile(t, filename, `{"peers":["tcp://b:5001","tcp://c:5001"]}`)
+		updates := target.WaitForSeen(t, 2)
+		assert.Equal(t, []string{"tcp://b:5001", "tcp://c:5001"}, updates[1])
+
+		writePeerConfigFile(t, filename, `{"peers":[`)
+		assert.Error(t, w.Reload())
+		// reported once
+		time.Sleep(200 * time.Millisecond)
+		assert.Len(t, observer.errors.Seen(), 1)
+		config, loaded := w.Config()
+		assert.True(t, loaded)
+		assert.Equal(t, []string{"tcp://b:5001", "tcp://c:5001"}, config.Peers)
+		assert.Len(t, target.Seen(), 2)
+
+		writePeerConfigFile(t, filename, `{"peers":["tcp://c:5001"]}`)
+		updates = target.WaitForSeen(t, 3)
+		assert.Equal(t, []string{"tcp://c:5001"}, updates[2])
+	})
+
+	t.Run("unchanged peers are not updated", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "peers.yaml")
+		writePeerConfigFile(t, filename, "peers: [tcp://b:5001]\n")
+		target := &testPeerUpdater{}
+		w := NewPeerConfigWatcher(filename, target)
+		require.NoError(t, w.Start())
+		defer w.Stop()
+
+		writePeerConfigFile(t, filename, "# reformatted\npeers:\n  - tcp://b:5001\n")
+		assert.NoError(t, w.Reload())
+		assert.Len(t, target.Seen(), 1)
+	})
+
+	t.Run("a missing file is reported but watched", func(t *testing.T) {
+		filename := path.Join(t.TempDir(), "peers.json")
+		target := &testPeerUpdater{}
+		w := NewPeerConfigWatcher(filename, target)
+		assert.Error(t, w.Start())
+		defer w.Stop()
+		_, loaded := w.Config()
+		assert.False(t, loaded)
+
+		writePeerConfigFile(t, filename, `{"peers":["tcp://b:5001"]}`)
+		assert.NoError(t, w.Reload())
+		assert.Equal(t, [][]string{{"tcp://b:5001"}}, target.Seen())
+	})
+}
+
+func writePeerConfigFile(t *testing.T, filename, content string) {
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0644))
+}
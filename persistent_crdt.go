@@ -0,0 +1,191 @@
+package percounter
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/Arceliar/phony"
+)
+
+// PersistentCRDT hosts any registered CRDT type: it loads and persists the state,
+// notifies the observer of value changes and the sink of local changes
+type PersistentCRDT struct {
+	phony.Inbox
+	crdtType          CRDTType
+	name              string
+	filename          string
+	inner             CRDT
+	sink              CRDTStateSink
+	observer          CRDTObserver
+	lastObservedValue any
+	// digest of the state, empty until computed or after a change
+	digest string
+}
+
+func NewPersistentCRDT(crdtType CRDTType, identity, filename string) *PersistentCRDT {
+	return NewPersistentCRDTWithSinkAndObserver(crdtType, identity, filename, &noOpCRDTState{}, &noOpCRDTObserver{})
+}
+
+func NewPersistentCRDTWithSinkAndObserver(crdtType CRDTType, identity, filename string, sink CRDTStateSink, observer CRDTObserver) *PersistentCRDT {
+	return newNamedPersistentCRDT(crdtType, identity, getFilenameWithoutExtension(filename), filename, sink, observer)
+}
+
+func newNamedPersistentCRDT(crdtType CRDTType, identity, name, filename string, sink CRDTStateSink, observer CRDTObserver) *PersistentCRDT {
+	res := &PersistentCRDT{
+		crdtType: crdtType,
+		name:     name,
+		filename: filename,
+		inner:    getCRDTFrom(crdtType, identity, name, filename),
+		sink:     sink,
+		observer: observer,
+	}
+	res.lastObservedValue = res.inner.Value()
+	observer.OnNewCRDTValue(CRDTEvent{crdtType.Tag, name, res.lastObservedValue})
+	return res
+}
+
+func (p *PersistentCRDT) Type() CRDTType {
+	return p.crdtType
+}
+
+func (p *PersistentCRDT) Name() string {
+	return p.name
+}
+
+// Update applies a local change. The mutation reports whether it changed the state,
+// and only changes are published to the sink and persisted
+func (p *PersistentCRDT) Update(mutate func(CRDT) bool) {
+	p.UpdateFromActor(p, mutate)
+}
+
+func (p *PersistentCRDT) UpdateFromActor(anotherActor phony.Actor, mutate func(CRDT) bool) {
+	p.Act(anotherActor, func() {
+		if !mutate(p.inner) {
+			return
+		}
+		p.afterLocalChangeSync()
+	})
+}
+
+// TryUpdate applies a local change synchronously, a failed mutation must leave the state unchanged
+func (p *PersistentCRDT) TryUpdate(mutate func(CRDT) error) error {
+	var err error
+	phony.Block(p, func() {
+		err = mutate(p.inner)
+		if err != nil {
+			return
+		}
+		p.afterLocalChangeSync()
+	})
+	return err
+}
+
+func (p *PersistentCRDT) Value() any {
+	var res any
+	phony.Block(p, func() {
+		res = p.inner.Value()
+	})
+	return res
+}
+
+func (p *PersistentCRDT) Snapshot() CRDT {
+	var res CRDT
+	phony.Block(p, func() {
+		res = p.inner.Snapshot()
+	})
+	return res
+}
+
+func (p *PersistentCRDT) MergeWith(other CRDT) {
+	p.Act(p, func() {
+		if err := p.inner.Merge(other); err != nil {
+			log.Printf("%s: %v", p.name, err)
+			return
+		}
+		p.digest = ""
+		p.publishValueIfChangedSync()
+		p.persistSync()
+	})
+}
+
+func (p *PersistentCRDT) PersistSync() {
+	phony.Block(p, func() {
+		p.persistSync()
+	})
+}
+
+func (p *PersistentCRDT) TryPersistSync() error {
+	var err error
+	phony.Block(p, func() {
+		err = p.tryPersistSync()
+	})
+	return err
+}
+
+// read runs a function with the hosted CRDT inside the actor
+func (p *PersistentCRDT) read(f func(CRDT)) {
+	phony.Block(p, func() {
+		f(p.inner)
+	})
+}
+
+// stateDigest is computed once per state change
+func (p *PersistentCRDT) stateDigest() (string, error) {
+	var res string
+	var err error
+	phony.Block(p, func() {
+		if p.digest == "" {
+			p.digest, err = digestOf(p.inner)
+		}
+		res = p.digest
+	})
+	return res, err
+}
+
+func (p *PersistentCRDT) afterLocalChangeSync() {
+	p.digest = ""
+	p.publishValueIfChangedSync()
+	p.sink.SetCRDTState(p.crdtType.Tag, p.name, p.inner.Snapshot())
+	p.persistSync()
+}
+
+func (p *PersistentCRDT) publishValueIfChangedSync() {
+	newValue := p.inner.Value()
+	if reflect.DeepEqual(newValue, p.lastObservedValue) {
+		return
+	}
+	p.observer.OnNewCRDTValue(CRDTEvent{p.crdtType.Tag, p.name, newValue})
+	p.lastObservedValue = newValue
+}
+
+func (p *PersistentCRDT) persistSync() {
+	if err := p.tryPersistSync(); err != nil {
+		// something is not right with the setup
+		panic(err)
+	}
+}
+
+func (p *PersistentCRDT) tryPersistSync() error {
+	b, err := p.inner.Marshal()
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.name, err)
+	}
+	return os.WriteFile(p.filename, b, 0644)
+}
+
+func getCRDTFrom(crdtType CRDTType, identity, name, filename string) CRDT {
+	res := crdtType.New(identity, name)
+	contents, err := os.ReadFile(filename)
+	if err != nil || len(contents) == 0 {
+		log.Printf("error reading %s: %v", filename, err)
+		return res
+	}
+	err = res.Unmarshal(contents)
+	if err != nil {
+		log.Printf("error deserializing state from %s: %v", filename, err)
+		return crdtType.New(identity, name)
+	}
+	return res
+}
@@ -0,0 +1,80 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistentCRDT(t *testing.T) {
+	t.Run("hosting a custom type", func(t *testing.T) {
+		filename := newTempFilename(t)
+		{
+			p := NewPersistentCRDT(testFlagCRDTType, "1", filename)
+			assert.Equal(t, false, p.Value())
+			p.Update(raiseTestFlag)
+			p.PersistSync()
+			assert.Equal(t, true, p.Value())
+		}
+
+		p := NewPersistentCRDT(testFlagCRDTType, "1", filename)
+		assert.Equal(t, true, p.Value())
+		assert.Equal(t, getFilenameWithoutExtension(filename), p.Name())
+	})
+
+	t.Run("only changes are published", func(t *testing.T) {
+		filename := newTempFilename(t)
+		testsink := &testCRDTStateSink{}
+		p := NewPersistentCRDTWithSinkAndObserver(GCounterCRDTType, "1", filename, testsink, &noOpCRDTObserver{})
+		p.Update(func(CRDT) bool { return false })
+		p.PersistSync()
+		assert.Nil(t, testsink.lastSnapshot)
+
+		p.Update(func(c CRDT) bool {
+			c.(*gcounterCRDT).Increment()
+			return true
+		})
+		p.PersistSync()
+		assert.Equal(t, GCounterNetworkMessage, testsink.lastTypeTag)
+		assert.Equal(t, int64(1), testsink.lastSnapshot.Value())
+	})
+
+	t.Run("incompatible merges are ignored", func(t *testing.T) {
+		filename := newTempFilename(t)
+		p := NewPersistentCRDT(GCounterCRDTType, "1", filename)
+		p.MergeWith(&testFlag{Raised: true})
+		p.PersistSync()
+		assert.Equal(t, int64(0), p.Value())
+	})
+
+	t.Run("the digest follows local changes and merges", func(t *testing.T) {
+		p := NewPersistentCRDT(GCounterCRDTType, "1", newTempFilename(t))
+		initial, err := p.stateDigest()
+		assert.NoError(t, err)
+		again, _ := p.stateDigest()
+		assert.Equal(t, initial, again)
+
+		p.Update(func(c CRDT) bool {
+			c.(*gcounterCRDT).Increment()
+			return true
+		})
+		incremented, _ := p.stateDigest()
+		assert.NotEqual(t, initial, incremented)
+
+		p.MergeWith(&gcounterCRDT{NewGCounterFromState("2", GCounterState{Name: p.Name(), Peers: map[string]int64{"2": 1}})})
+		merged, _ := p.stateDigest()
+		assert.NotEqual(t, incremented, merged)
+		expected, _ := digestOf(p.Snapshot())
+		assert.Equal(t, expected, merged)
+	})
+}
+
+type testCRDTStateSink struct {
+	lastTypeTag  string
+	lastSnapshot CRDT
+}
+
+func (sink *testCRDTStateSink) SetCRDTState(typeTag, _ string, snapshot CRDT) {
+	sink.lastTypeTag = typeTag
+	sink.lastSnapshot = snapshot
+}
@@ -1,22 +1,17 @@
 package percounter
 
 import (
-	"encoding/json"
 	"log"
-	"os"
 	"path"
 	"strings"
 
 	"github.com/Arceliar/phony"
 )
 
+// PersistentGCounter is the G-Counter view of a PersistentCRDT
 type PersistentGCounter struct {
-	phony.Inbox
-	filename          string
-	inner             *GCounter
-	sink              GCounterStateSink
-	observer          CounterObserver
-	lastObservedCount int64
+	*PersistentCRDT
+	inner *GCounter
 }
 
 func NewPersistentGCounter(identity, filename string) *PersistentGCounter {
@@ -24,25 +19,24 @@ func NewPersistentGCounter(identity, filename string) *PersistentGCounter {
 }
 
 func NewPersistentGCounterWithSink(identity, filename string, sink GCounterStateSink) *PersistentGCounter {
-	res := &PersistentGCounter{
-		inner:    NewGCounterFromState(identity, getStateFrom(filename)),
-		filename: filename,
-		sink:     sink,
-		observer: &noOpCounterObserver{},
-	}
-	res.lastObservedCount = res.inner.Value()
-	return res
+	return NewPersistentGCounterWithSinkAndObserver(identity, filename, sink, &noOpCounterObserver{})
 }
 
 func NewPersistentGCounterWithSinkAndObserver(identity, filename string, sink GCounterStateSink, observer CounterObserver) *PersistentGCounter {
-	res := &PersistentGCounter{
-		inner:    NewGCounterFromState(identity, getStateFrom(filename)),
-		filename: filename,
-		sink:     sink,
-		observer: observer,
-	}
-	observer.OnNewCount(CountEvent{res.inner.state.Name, res.inner.Value()})
-	res.lastObservedCount = res.inner.Value()
+	return newPersistentGCounterOf(NewPersistentCRDTWithSinkAndObserver(
+		GCounterCRDTType,
+		identity,
+		filename,
+		&gcounterStateSinkAdapter{sink},
+		&counterObserverAdapter{observer},
+	))
+}
+
+func newPersistentGCounterOf(p *PersistentCRDT) *PersistentGCounter {
+	res := &PersistentGCounter{PersistentCRDT: p}
+	p.read(func(c CRDT) {
+		res.inner = c.(*gcounterCRDT).GCounter
+	})
 	return res
 }
 
@@ -50,12 +44,21 @@ func (c *PersistentGCounter) Increment() {
 	c.IncrementFromActor(c)
 }
 
+// IncrementFromActor logs the increments refused once the own identity is retired, see TryIncrement
 func (c *PersistentGCounter) IncrementFromActor(anotherActor phony.Actor) {
-	c.Act(anotherActor, func() {
-		c.inner.Increment()
-		c.publishCountIfChangedSync()
-		c.sink.SetState(c.inner.GetState().Copy())
-		c.persist()
+	c.UpdateFromActor(anotherActor, func(CRDT) bool {
+		if err := c.inner.TryIncrement(); err != nil {
+			log.Printf("%s: not incrementing: %v", c.name, err)
+			return false
+		}
+		return true
+	})
+}
+
+// TryIncrement increments synchronously, failing with ErrIdentityRetired once the own identity is retired
+func (c *PersistentGCounter) TryIncrement() error {
+	return c.TryUpdate(func(CRDT) error {
+		return c.inner.TryIncrement()
 	})
 }
 
@@ -70,74 +73,36 @@ func (c *PersistentGCounter) Value() int64 {
 func (c *PersistentGCounter) GetState() GCounterState {
 	var res GCounterState
 	phony.Block(c, func() {
-		res = c.inner.GetState()
+		res = c.inner.GetState().Copy()
 	})
 	return res
 }
 
 func (c *PersistentGCounter) MergeWith(other GCounterStateSource) {
-	c.Act(c, func() {
-		c.inner.MergeWith(other)
-		c.publishCountIfChanged()
-		c.persist()
-	})
-}
-
-func (c *PersistentGCounter) PersistSync() {
-	phony.Block(c, func() {
-		c.persistSync()
-	})
+	c.PersistentCRDT.MergeWith(&gcounterCRDT{NewGCounterFromState("", other.GetState())})
 }
 
-func (c *PersistentGCounter) persist() {
-	c.Act(c, func() {
-		c.persistSync()
-	})
+type gcounterStateSinkAdapter struct {
+	sink GCounterStateSink
 }
 
-func (c *PersistentGCounter) publishCountIfChangedSync() {
-	newCount := c.inner.Value()
-	if newCount != c.lastObservedCount {
-		name := c.inner.state.Name
-		c.observer.OnNewCount(CountEvent{name, newCount})
-		c.lastObservedCount = newCount
-	}
+func (a *gcounterStateSinkAdapter) SetCRDTState(_, _ string, snapshot CRDT) {
+	a.sink.SetState(snapshot.(*gcounterCRDT).GetState())
 }
 
-func (c *PersistentGCounter) publishCountIfChanged() {
-	c.Act(c, func() {
-		c.publishCountIfChangedSync()
-	})
+type counterObserverAdapter struct {
+	observer CounterObserver
 }
 
-func (c *PersistentGCounter) persistSync() {
-	b, err := json.Marshal(c.inner.GetState())
-	if err != nil {
-		// something is not right with the setup
-		panic(err)
-	}
-	err = os.WriteFile(c.filename, b, 0644)
-	if err != nil {
-		// something is not right with the setup
-		panic(err)
-	}
+func (a *counterObserverAdapter) OnNewCRDTValue(ev CRDTEvent) {
+	a.observer.OnNewCount(CountEvent{ev.Name, ev.Value.(int64)})
 }
 
 func getStateFrom(filename string) GCounterState {
-	counterName := getFilenameWithoutExtension(filename)
-	contents, err := os.ReadFile(filename)
-	if err != nil || len(contents) == 0 {
-		log.Printf("error reading %s: %v", filename, err)
-		return NewNamedGcounterState(counterName)
-	}
-	var res GCounterState
-	err = json.Unmarshal(contents, &res)
+	res, err := ReadGCounterFile(filename)
 	if err != nil {
-		log.Printf("error deserializing state from %s: %v", filename, err)
-		return NewNamedGcounterState(counterName)
-	}
-	if res.Name == "" {
-		res.Name = counterName
+		log.Printf("error reading %s: %v", filename, err)
+		return NewNamedGcounterState(getFilenameWithoutExtension(filename))
 	}
 	return res
 }
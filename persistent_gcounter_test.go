@@ -57,6 +57,19 @@ func TestPersistentGCounter(t *testing.T) {
 		c.PersistSync()
 	})
 
+	t.Run("retired identities cannot increment", func(t *testing.T) {
+		c := NewPersistentGCounter("1", newTempFilename(t))
+		assert.NoError(t, c.TryIncrement())
+		coordinator := NewGCounterFromState("2", c.GetState())
+		coordinator.Retire("1")
+		c.MergeWith(coordinator)
+
+		assert.ErrorIs(t, c.TryIncrement(), ErrIdentityRetired)
+		c.Increment()
+		waitForGcounterValueOf(t, 1, c)
+		c.PersistSync()
+	})
+
 	t.Run("observing state change", func(t *testing.T) {
 		filename := newTempFilename(t)
 		testsink := &testGCounterStateSink{}
@@ -0,0 +1,95 @@
+package percounter
+
+import (
+	"github.com/Arceliar/phony"
+)
+
+// PersistentGSet is the G-Set view of a PersistentCRDT
+type PersistentGSet struct {
+	*PersistentCRDT
+	inner *GSet
+}
+
+func NewPersistentGSet(filename string) *PersistentGSet {
+	return NewPersistentGSetWithSink(filename, &noOpSetState{})
+}
+
+func NewPersistentGSetWithSink(filename string, sink GSetStateSink) *PersistentGSet {
+	return NewPersistentGSetWithSinkAndObserver(filename, sink, &noOpSetObserver{})
+}
+
+func NewPersistentGSetWithSinkAndObserver(filename string, sink GSetStateSink, observer SetObserver) *PersistentGSet {
+	return newPersistentGSetOf(NewPersistentCRDTWithSinkAndObserver(
+		GSetCRDTType,
+		"",
+		filename,
+		&gsetStateSinkAdapter{sink},
+		&setObserverAdapter{observer},
+	))
+}
+
+func newPersistentGSetOf(p *PersistentCRDT) *PersistentGSet {
+	res := &PersistentGSet{PersistentCRDT: p}
+	p.read(func(c CRDT) {
+		res.inner = c.(*gsetCRDT).GSet
+	})
+	return res
+}
+
+func (s *PersistentGSet) Add(element string) {
+	s.AddFromActor(s, element)
+}
+
+func (s *PersistentGSet) AddFromActor(anotherActor phony.Actor, element string) {
+	s.UpdateFromActor(anotherActor, func(CRDT) bool {
+		if s.inner.Contains(element) {
+			return false
+		}
+		s.inner.Add(element)
+		return true
+	})
+}
+
+func (s *PersistentGSet) Contains(element string) bool {
+	var res bool
+	phony.Block(s, func() {
+		res = s.inner.Contains(element)
+	})
+	return res
+}
+
+func (s *PersistentGSet) Elements() []string {
+	var res []string
+	phony.Block(s, func() {
+		res = s.inner.Elements()
+	})
+	return res
+}
+
+func (s *PersistentGSet) GetState() GSetState {
+	var res GSetState
+	phony.Block(s, func() {
+		res = s.inner.GetState().Copy()
+	})
+	return res
+}
+
+func (s *PersistentGSet) MergeWith(other GSetStateSource) {
+	s.PersistentCRDT.MergeWith(&gsetCRDT{NewGSetFromState(other.GetState().Copy())})
+}
+
+type gsetStateSinkAdapter struct {
+	sink GSetStateSink
+}
+
+func (a *gsetStateSinkAdapter) SetCRDTState(_, _ string, snapshot CRDT) {
+	a.sink.SetGSetState(snapshot.(*gsetCRDT).GetState())
+}
+
+type setObserverAdapter struct {
+	observer SetObserver
+}
+
+func (a *setObserverAdapter) OnNewCRDTValue(ev CRDTEvent) {
+	a.observer.OnNewElements(SetEvent{ev.Name, ev.Value.([]string)})
+}
@@ -0,0 +1,48 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistentGSet(t *testing.T) {
+	t.Run("picking up from a persisted set", func(t *testing.T) {
+		filename := newTempFilename(t)
+		{
+			s := NewPersistentGSet(filename)
+			s.Add("a")
+			s.Add("b")
+			waitForSetLenOf(t, 2, s.Elements)
+			s.PersistSync()
+		}
+
+		s := NewPersistentGSet(filename)
+		s.Add("c")
+		waitForSetElementsOf(t, []string{"a", "b", "c"}, s.Elements)
+		s.PersistSync()
+
+		assert.Equal(t, getFilenameWithoutExtension(filename), s.GetState().Name)
+	})
+
+	t.Run("observing elements", func(t *testing.T) {
+		filename := newTempFilename(t)
+		testObserver := &testSetObserver{}
+		s := NewPersistentGSetWithSinkAndObserver(filename, &noOpSetState{}, testObserver)
+		s.Add("a")
+		s.Add("a")
+		other := NewGSet()
+		other.Add("b")
+		s.MergeWith(other)
+		// already seen
+		s.MergeWith(other)
+		waitForSetLenOf(t, 2, s.Elements)
+		s.PersistSync()
+
+		events := testObserver.Seen()
+		assert.Len(t, events, 3)
+		assert.Empty(t, events[0].Elements)
+		assert.Equal(t, []string{"a"}, events[1].Elements)
+		assert.Equal(t, []string{"a", "b"}, events[2].Elements)
+	})
+}
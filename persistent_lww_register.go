@@ -0,0 +1,80 @@
+package percounter
+
+import (
+	"github.com/Arceliar/phony"
+)
+
+// PersistentLWWRegister is the last-writer-wins register view of a PersistentCRDT
+type PersistentLWWRegister struct {
+	*PersistentCRDT
+	inner *LWWRegister
+}
+
+func NewPersistentLWWRegister(identity, filename string) *PersistentLWWRegister {
+	return NewPersistentLWWRegisterWithSinkAndObserver(identity, filename, &noOpLWWRegisterState{}, &noOpValueObserver{})
+}
+
+func NewPersistentLWWRegisterWithSinkAndObserver(identity, filename string, sink LWWRegisterStateSink, observer ValueObserver) *PersistentLWWRegister {
+	return newPersistentLWWRegisterOf(NewPersistentCRDTWithSinkAndObserver(
+		LWWRegisterCRDTType,
+		identity,
+		filename,
+		&lwwRegisterStateSinkAdapter{sink},
+		&valueObserverAdapter{observer},
+	))
+}
+
+func newPersistentLWWRegisterOf(p *PersistentCRDT) *PersistentLWWRegister {
+	res := &PersistentLWWRegister{PersistentCRDT: p}
+	p.read(func(c CRDT) {
+		res.inner = c.(*lwwRegisterCRDT).LWWRegister
+	})
+	return res
+}
+
+func (r *PersistentLWWRegister) Set(value string) {
+	r.SetFromActor(r, value)
+}
+
+func (r *PersistentLWWRegister) SetFromActor(anotherActor phony.Actor, value string) {
+	r.UpdateFromActor(anotherActor, func(CRDT) bool {
+		r.inner.Set(value)
+		return true
+	})
+}
+
+func (r *PersistentLWWRegister) Value() string {
+	var val string
+	phony.Block(r, func() {
+		val = r.inner.Value()
+	})
+	return val
+}
+
+func (r *PersistentLWWRegister) GetState() LWWRegisterState {
+	var res LWWRegisterState
+	phony.Block(r, func() {
+		res = r.inner.GetState()
+	})
+	return res
+}
+
+func (r *PersistentLWWRegister) MergeWith(other LWWRegisterStateSource) {
+	r.PersistentCRDT.MergeWith(&lwwRegisterCRDT{NewLWWRegisterFromState("", other.GetState())})
+}
+
+type lwwRegisterStateSinkAdapter struct {
+	sink LWWRegisterStateSink
+}
+
+func (a *lwwRegisterStateSinkAdapter) SetCRDTState(_, _ string, snapshot CRDT) {
+	a.sink.SetLWWRegisterState(snapshot.(*lwwRegisterCRDT).GetState())
+}
+
+type valueObserverAdapter struct {
+	observer ValueObserver
+}
+
+func (a *valueObserverAdapter) OnNewCRDTValue(ev CRDTEvent) {
+	a.observer.OnNewValue(ValueEvent{ev.Name, ev.Value.(string)})
+}
@@ -0,0 +1,47 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistentLWWRegister(t *testing.T) {
+	t.Run("picking up from a persisted register", func(t *testing.T) {
+		filename := newTempFilename(t)
+		var persisted LWWRegisterState
+		{
+			r := NewPersistentLWWRegister("1", filename)
+			r.Set("a")
+			r.Set("b")
+			r.PersistSync()
+			persisted = r.GetState()
+		}
+
+		r := NewPersistentLWWRegister("1", filename)
+		assert.Equal(t, "b", r.Value())
+		r.Set("c")
+		assert.Equal(t, "c", r.Value())
+		assert.True(t, persisted.Timestamp.Before(r.GetState().Timestamp))
+		r.PersistSync()
+	})
+
+	t.Run("observing register value", func(t *testing.T) {
+		filename := newTempFilename(t)
+		testObserver := &testValueObserver{}
+		r := NewPersistentLWWRegisterWithSinkAndObserver("1", filename, &noOpLWWRegisterState{}, testObserver)
+		r.Set("a")
+		r.Set("a")
+		assert.Equal(t, "a", r.Value())
+		other := NewLWWRegister("2")
+		other.Set("b")
+		r.MergeWith(other)
+		r.PersistSync()
+
+		assert.Equal(t, []ValueEvent{
+			{getFilenameWithoutExtension(filename), ""},
+			{getFilenameWithoutExtension(filename), "a"},
+			{getFilenameWithoutExtension(filename), "b"},
+		}, testObserver.Seen())
+	})
+}
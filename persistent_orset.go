@@ -0,0 +1,98 @@
+package percounter
+
+import (
+	"github.com/Arceliar/phony"
+)
+
+// PersistentORSet is the OR-Set view of a PersistentCRDT
+type PersistentORSet struct {
+	*PersistentCRDT
+	inner *ORSet
+}
+
+func NewPersistentORSet(identity, filename string) *PersistentORSet {
+	return NewPersistentORSetWithSink(identity, filename, &noOpSetState{})
+}
+
+func NewPersistentORSetWithSink(identity, filename string, sink ORSetStateSink) *PersistentORSet {
+	return NewPersistentORSetWithSinkAndObserver(identity, filename, sink, &noOpSetObserver{})
+}
+
+func NewPersistentORSetWithSinkAndObserver(identity, filename string, sink ORSetStateSink, observer SetObserver) *PersistentORSet {
+	return newPersistentORSetOf(NewPersistentCRDTWithSinkAndObserver(
+		ORSetCRDTType,
+		identity,
+		filename,
+		&orsetStateSinkAdapter{sink},
+		&setObserverAdapter{observer},
+	))
+}
+
+func newPersistentORSetOf(p *PersistentCRDT) *PersistentORSet {
+	res := &PersistentORSet{PersistentCRDT: p}
+	p.read(func(c CRDT) {
+		res.inner = c.(*orsetCRDT).ORSet
+	})
+	return res
+}
+
+func (s *PersistentORSet) Add(element string) {
+	s.AddFromActor(s, element)
+}
+
+func (s *PersistentORSet) AddFromActor(anotherActor phony.Actor, element string) {
+	s.UpdateFromActor(anotherActor, func(CRDT) bool {
+		s.inner.Add(element)
+		return true
+	})
+}
+
+func (s *PersistentORSet) Remove(element string) {
+	s.RemoveFromActor(s, element)
+}
+
+func (s *PersistentORSet) RemoveFromActor(anotherActor phony.Actor, element string) {
+	s.UpdateFromActor(anotherActor, func(CRDT) bool {
+		if !s.inner.Contains(element) {
+			return false
+		}
+		s.inner.Remove(element)
+		return true
+	})
+}
+
+func (s *PersistentORSet) Contains(element string) bool {
+	var res bool
+	phony.Block(s, func() {
+		res = s.inner.Contains(element)
+	})
+	return res
+}
+
+func (s *PersistentORSet) Elements() []string {
+	var res []string
+	phony.Block(s, func() {
+		res = s.inner.Elements()
+	})
+	return res
+}
+
+func (s *PersistentORSet) GetState() ORSetState {
+	var res ORSetState
+	phony.Block(s, func() {
+		res = s.inner.GetState().Copy()
+	})
+	return res
+}
+
+func (s *PersistentORSet) MergeWith(other ORSetStateSource) {
+	s.PersistentCRDT.MergeWith(&orsetCRDT{NewORSetFromState("", other.GetState().Copy())})
+}
+
+type orsetStateSinkAdapter struct {
+	sink ORSetStateSink
+}
+
+func (a *orsetStateSinkAdapter) SetCRDTState(_, _ string, snapshot CRDT) {
+	a.sink.SetORSetState(snapshot.(*orsetCRDT).GetState())
+}
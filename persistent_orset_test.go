@@ -0,0 +1,44 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistentORSet(t *testing.T) {
+	t.Run("picking up from a persisted set", func(t *testing.T) {
+		filename := newTempFilename(t)
+		{
+			s := NewPersistentORSet("1", filename)
+			s.Add("a")
+			s.Add("b")
+			s.Remove("a")
+			waitForSetElementsOf(t, []string{"b"}, s.Elements)
+			s.PersistSync()
+		}
+
+		s := NewPersistentORSet("1", filename)
+		assert.Equal(t, []string{"b"}, s.Elements())
+		s.Add("a")
+		waitForSetElementsOf(t, []string{"a", "b"}, s.Elements)
+		s.PersistSync()
+	})
+
+	t.Run("observing elements", func(t *testing.T) {
+		filename := newTempFilename(t)
+		testObserver := &testSetObserver{}
+		s := NewPersistentORSetWithSinkAndObserver("1", filename, &noOpSetState{}, testObserver)
+		s.Add("a")
+		s.Remove("a")
+		// removing a missing element is not a change
+		s.Remove("a")
+		waitForSetLenOf(t, 0, s.Elements)
+		s.PersistSync()
+
+		events := testObserver.Seen()
+		assert.Len(t, events, 3)
+		assert.Equal(t, []string{"a"}, events[1].Elements)
+		assert.Empty(t, events[2].Elements)
+	})
+}
@@ -0,0 +1,93 @@
+package percounter
+
+import (
+	"github.com/Arceliar/phony"
+)
+
+// PersistentRegister is the Max/Min register view of a PersistentCRDT
+type PersistentRegister struct {
+	*PersistentCRDT
+	inner *extremumRegister
+}
+
+func NewPersistentMaxRegister(filename string) *PersistentRegister {
+	return NewPersistentRegisterWithSinkAndObserver(MaxRegisterKind, filename, &noOpRegisterState{}, &noOpCounterObserver{})
+}
+
+func NewPersistentMinRegister(filename string) *PersistentRegister {
+	return NewPersistentRegisterWithSinkAndObserver(MinRegisterKind, filename, &noOpRegisterState{}, &noOpCounterObserver{})
+}
+
+func NewPersistentRegisterWithSinkAndObserver(kind, filename string, sink RegisterStateSink, observer CounterObserver) *PersistentRegister {
+	return newPersistentRegisterOf(NewPersistentCRDTWithSinkAndObserver(
+		registerCRDTTypeOf(kind),
+		"",
+		filename,
+		&registerStateSinkAdapter{sink},
+		&counterObserverAdapter{observer},
+	))
+}
+
+func newPersistentRegisterOf(p *PersistentCRDT) *PersistentRegister {
+	res := &PersistentRegister{PersistentCRDT: p}
+	p.read(func(c CRDT) {
+		res.inner = c.(*registerCRDT).extremumRegister
+	})
+	return res
+}
+
+func (r *PersistentRegister) Observe(value int64) {
+	r.ObserveFromActor(r, value)
+}
+
+func (r *PersistentRegister) ObserveFromActor(anotherActor phony.Actor, value int64) {
+	r.UpdateFromActor(anotherActor, func(CRDT) bool {
+		before := r.inner.GetState()
+		r.inner.Observe(value)
+		return before != r.inner.GetState()
+	})
+}
+
+func (r *PersistentRegister) Value() int64 {
+	var val int64
+	phony.Block(r, func() {
+		val = r.inner.Value()
+	})
+	return val
+}
+
+func (r *PersistentRegister) GetState() RegisterState {
+	var res RegisterState
+	phony.Block(r, func() {
+		res = r.inner.GetState()
+	})
+	return res
+}
+
+func (r *PersistentRegister) MergeWith(other RegisterStateSource) {
+	state := other.GetState()
+	state.Kind = r.crdtTypeKind()
+	r.PersistentCRDT.MergeWith(newRegisterCRDT(state))
+}
+
+func (r *PersistentRegister) crdtTypeKind() string {
+	if r.Type().Tag == MinRegisterNetworkMessage {
+		return MinRegisterKind
+	}
+	return MaxRegisterKind
+}
+
+func registerCRDTTypeOf(kind string) CRDTType {
+	if kind == MinRegisterKind {
+		return MinRegisterCRDTType
+	}
+	return MaxRegisterCRDTType
+}
+
+type registerStateSinkAdapter struct {
+	sink RegisterStateSink
+}
+
+func (a *registerStateSinkAdapter) SetCRDTState(_, _ string, snapshot CRDT) {
+	a.sink.SetRegisterState(snapshot.(*registerCRDT).GetState())
+}
@@ -0,0 +1,53 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersistentRegister(t *testing.T) {
+	t.Run("picking up from a persisted register", func(t *testing.T) {
+		filename := newTempFilename(t)
+		{
+			r := NewPersistentMaxRegister(filename)
+			r.Observe(42)
+			r.Observe(17)
+			waitForGcounterValueOf(t, 42, r)
+			r.PersistSync()
+		}
+
+		r := NewPersistentMaxRegister(filename)
+		assert.Equal(t, int64(42), r.Value())
+		assert.Equal(t, MaxRegisterKind, r.GetState().Kind)
+		assert.Equal(t, getFilenameWithoutExtension(filename), r.GetState().Name)
+	})
+
+	t.Run("observing register value", func(t *testing.T) {
+		filename := newTempFilename(t)
+		testObserver := newTestCounterObserver()
+		testsink := &testRegisterStateSink{}
+		r := NewPersistentRegisterWithSinkAndObserver(MinRegisterKind, filename, testsink, testObserver)
+		r.Observe(10)
+		r.Observe(12)
+		r.Observe(4)
+		waitForGcounterValueOf(t, 4, r)
+		assert.Equal(t, int64(4), testsink.lastState.Value)
+
+		other := NewMinRegister()
+		other.Observe(1)
+		r.MergeWith(other)
+		waitForGcounterValueOf(t, 1, r)
+		r.PersistSync()
+
+		assertValuesSeen(t, []int64{0, 10, 4, 1}, testObserver.WaitForGtValuesSeen(t, 4))
+	})
+}
+
+type testRegisterStateSink struct {
+	lastState RegisterState
+}
+
+func (sink *testRegisterStateSink) SetRegisterState(s RegisterState) {
+	sink.lastState = s
+}
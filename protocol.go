@@ -0,0 +1,41 @@
+package percounter
+
+import "slices"
+
+// ProtocolVersion is advertised in the connection metadata. Peers not advertising any
+// are assumed to speak the original protocol, version 1, without any capabilities
+const ProtocolVersion = 2
+
+const legacyProtocolVersion = 1
+
+// capabilities a peer can advertise, gating the features used towards it.
+// Peers match them to the address a node advertises: the features relying on them require SetMyIP
+const (
+	GzipCapability        = GzipCompression
+	BinaryWireCapability  = BinaryWireFormat
+	BatchCapability       = "batch"
+	AntiEntropyCapability = "anti-entropy"
+	MerkleSyncCapability  = "merkle"
+	RetirementCapability  = "retirement"
+)
+
+type PeerProtocol struct {
+	Version      int      `json:"version"`
+	Capabilities []string `json:"capabilities"`
+}
+
+func (p PeerProtocol) Supports(capability string) bool {
+	return p.Version >= ProtocolVersion && slices.Contains(p.Capabilities, capability)
+}
+
+func peerProtocolOf(msg *NetworkedGCounterState) PeerProtocol {
+	version, err := tryGetPeerMetadataUint(msg, ProtocolVersionKey)
+	if err != nil || version == 0 {
+		return PeerProtocol{Version: legacyProtocolVersion, Capabilities: []string{}}
+	}
+	capabilities := tryGetPeerMetadataStrings(msg, CapabilitiesKey)
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+	return PeerProtocol{Version: int(version), Capabilities: capabilities}
+}
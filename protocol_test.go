@@ -0,0 +1,36 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerProtocol(t *testing.T) {
+	t.Run("peers without a version speak the legacy protocol", func(t *testing.T) {
+		protocol := peerProtocolOf(&NetworkedGCounterState{Metadata: map[string]interface{}{MyIPKey: "127.0.0.1"}})
+		assert.Equal(t, PeerProtocol{Version: 1, Capabilities: []string{}}, protocol)
+		assert.False(t, protocol.Supports(BatchCapability))
+
+		// capabilities are ignored without a version
+		protocol = peerProtocolOf(&NetworkedGCounterState{Metadata: map[string]interface{}{
+			CapabilitiesKey: []interface{}{BatchCapability},
+		}})
+		assert.False(t, protocol.Supports(BatchCapability))
+	})
+
+	t.Run("advertised capabilities are supported", func(t *testing.T) {
+		protocol := peerProtocolOf(&NetworkedGCounterState{Metadata: map[string]interface{}{
+			ProtocolVersionKey: float64(2),
+			CapabilitiesKey:    []interface{}{BatchCapability, GzipCapability},
+		}})
+		assert.Equal(t, 2, protocol.Version)
+		assert.True(t, protocol.Supports(BatchCapability))
+		assert.True(t, protocol.Supports(GzipCapability))
+		assert.False(t, protocol.Supports(BinaryWireCapability))
+	})
+
+	t.Run("unknown peers support nothing", func(t *testing.T) {
+		assert.False(t, PeerProtocol{}.Supports(AntiEntropyCapability))
+	})
+}
@@ -0,0 +1,91 @@
+package percounter
+
+const MaxRegisterKind = "max"
+const MinRegisterKind = "min"
+
+type RegisterState struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Value int64  `json:"value"`
+	IsSet bool   `json:"is_set"`
+}
+
+func NewNamedRegisterState(name, kind string) RegisterState {
+	return RegisterState{
+		Name: name,
+		Kind: kind,
+	}
+}
+
+// MaxRegister keeps the highest value observed by any replica, e.g. a high-water mark
+type MaxRegister struct {
+	extremumRegister
+}
+
+func NewMaxRegister() *MaxRegister {
+	return NewMaxRegisterFromState(NewNamedRegisterState("singleton", MaxRegisterKind))
+}
+
+func NewMaxRegisterFromState(state RegisterState) *MaxRegister {
+	state.Kind = MaxRegisterKind
+	return &MaxRegister{newExtremumRegister(state)}
+}
+
+// MinRegister keeps the lowest value observed by any replica
+type MinRegister struct {
+	extremumRegister
+}
+
+func NewMinRegister() *MinRegister {
+	return NewMinRegisterFromState(NewNamedRegisterState("singleton", MinRegisterKind))
+}
+
+func NewMinRegisterFromState(state RegisterState) *MinRegister {
+	state.Kind = MinRegisterKind
+	return &MinRegister{newExtremumRegister(state)}
+}
+
+type extremumRegister struct {
+	state   RegisterState
+	replace func(current, candidate int64) bool
+}
+
+func newExtremumRegister(state RegisterState) extremumRegister {
+	replace := func(current, candidate int64) bool { return candidate > current }
+	if state.Kind == MinRegisterKind {
+		replace = func(current, candidate int64) bool { return candidate < current }
+	}
+	return extremumRegister{
+		state:   state,
+		replace: replace,
+	}
+}
+
+func (r *extremumRegister) Observe(value int64) {
+	if r.state.IsSet && !r.replace(r.state.Value, value) {
+		return
+	}
+	r.state.Value = value
+	r.state.IsSet = true
+}
+
+// Value is 0 until the first value is observed
+func (r *extremumRegister) Value() int64 {
+	return r.state.Value
+}
+
+func (r *extremumRegister) IsSet() bool {
+	return r.state.IsSet
+}
+
+func (r *extremumRegister) MergeWith(other RegisterStateSource) {
+	otherState := other.GetState()
+	if !otherState.IsSet {
+		return
+	}
+	r.Observe(otherState.Value)
+}
+
+func (r *extremumRegister) GetState() RegisterState {
+	return r.state
+}
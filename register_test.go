@@ -0,0 +1,50 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisters(t *testing.T) {
+	t.Run("max register keeps the high-water mark", func(t *testing.T) {
+		r := NewMaxRegister()
+		assert.False(t, r.IsSet())
+		r.Observe(3)
+		r.Observe(7)
+		r.Observe(5)
+		assert.True(t, r.IsSet())
+		assert.Equal(t, int64(7), r.Value())
+	})
+
+	t.Run("min register keeps the lowest value, including negative ones", func(t *testing.T) {
+		r := NewMinRegister()
+		r.Observe(3)
+		r.Observe(-2)
+		r.Observe(5)
+		assert.Equal(t, int64(-2), r.Value())
+	})
+
+	t.Run("merging", func(t *testing.T) {
+		max1 := NewMaxRegister()
+		max1.Observe(2)
+		max2 := NewMaxRegister()
+		max2.Observe(9)
+		max1.MergeWith(max2)
+		assert.Equal(t, int64(9), max1.Value())
+
+		min1 := NewMinRegister()
+		min1.Observe(2)
+		min2 := NewMinRegister()
+		min2.Observe(9)
+		min1.MergeWith(min2)
+		assert.Equal(t, int64(2), min1.Value())
+
+		// unset registers do not contribute
+		min1.MergeWith(NewMinRegister())
+		assert.Equal(t, int64(2), min1.Value())
+		fresh := NewMinRegister()
+		fresh.MergeWith(min2)
+		assert.Equal(t, int64(9), fresh.Value())
+	})
+}
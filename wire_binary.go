@@ -0,0 +1,393 @@
+package percounter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+)
+
+const JSONWireFormat = "json"
+const BinaryWireFormat = "binary/1"
+
+const binaryWireFormatVersion = 1
+
+// binaryWireMagic can be told apart from JSON objects and gzip streams
+var binaryWireMagic = []byte{0xb1, 'p', 'c'}
+
+const maxBinaryNesting = 32
+
+var errTruncatedBinaryState = errors.New("truncated binary state")
+
+const (
+	wireNil byte = iota
+	wireString
+	wireFalse
+	wireTrue
+	wireNumber
+	wireList
+	wireMap
+	wireJSON
+)
+
+func isBinaryEncoded(message []byte) bool {
+	return bytes.HasPrefix(message, binaryWireMagic)
+}
+
+// EncodeBinaryState: magic, version, a string table, then the fields referring to it
+func EncodeBinaryState(s *NetworkedGCounterState) ([]byte, error) {
+	e := &binaryEncoder{indices: map[string]uint64{}}
+	e.writeString(s.Type)
+	e.writeString(s.SourcePeer)
+	e.writeString(s.Name)
+	if s.Peers == nil {
+		e.body = binary.AppendUvarint(e.body, 0)
+	} else {
+		e.body = binary.AppendUvarint(e.body, uint64(len(s.Peers))+1)
+		for _, peer := range slices.Sorted(maps.Keys(s.Peers)) {
+			e.writeString(peer)
+			e.body = binary.AppendVarint(e.body, s.Peers[peer])
+		}
+	}
+	if s.Metadata == nil {
+		e.body = binary.AppendUvarint(e.body, 0)
+	} else {
+		e.body = binary.AppendUvarint(e.body, uint64(len(s.Metadata))+1)
+		for _, key := range slices.Sorted(maps.Keys(s.Metadata)) {
+			e.writeString(key)
+			if err := e.writeValue(s.Metadata[key], 0); err != nil {
+				return nil, fmt.Errorf("metadata '%s': %w", key, err)
+			}
+		}
+	}
+	e.body = binary.AppendUvarint(e.body, uint64(len(s.State)))
+	e.body = append(e.body, s.State...)
+
+	res := append([]byte{}, binaryWireMagic...)
+	res = append(res, binaryWireFormatVersion)
+	res = binary.AppendUvarint(res, uint64(len(e.table)))
+	for _, str := range e.table {
+		res = binary.AppendUvarint(res, uint64(len(str)))
+		res = append(res, str...)
+	}
+	return append(res, e.body...), nil
+}
+
+func DecodeBinaryState(data []byte) (NetworkedGCounterState, error) {
+	res := NetworkedGCounterState{}
+	if !isBinaryEncoded(data) {
+		return res, errors.New("not a binary state")
+	}
+	d := &binaryDecoder{data: data, pos: len(binaryWireMagic)}
+	version, err := d.readByte()
+	if err != nil {
+		return res, err
+	}
+	if version != binaryWireFormatVersion {
+		return res, fmt.Errorf("unsupported binary wire format version %d", version)
+	}
+	count, err := d.readCount()
+	if err != nil {
+		return res, err
+	}
+	d.table = make([]string, 0, count)
+	for range count {
+		str, err := d.readBytes()
+		if err != nil {
+			return res, err
+		}
+		d.table = append(d.table, string(str))
+	}
+	if res.Type, err = d.readString(); err != nil {
+		return res, err
+	}
+	if res.SourcePeer, err = d.readString(); err != nil {
+		return res, err
+	}
+	if res.Name, err = d.readString(); err != nil {
+		return res, err
+	}
+	if res.Peers, err = d.readPeers(); err != nil {
+		return res, err
+	}
+	if res.Metadata, err = d.readMap(0); err != nil {
+		return res, err
+	}
+	state, err := d.readBytes()
+	if err != nil {
+		return res, err
+	}
+	if len(state) > 0 {
+		res.State = json.RawMessage(bytes.Clone(state))
+	}
+	if d.pos != len(d.data) {
+		return res, fmt.Errorf("%d trailing bytes in binary state", len(d.data)-d.pos)
+	}
+	return res, nil
+}
+
+type binaryEncoder struct {
+	table   []string
+	indices map[string]uint64
+	body    []byte
+}
+
+func (e *binaryEncoder) writeString(s string) {
+	index, ok := e.indices[s]
+	if !ok {
+		index = uint64(len(e.table))
+		e.indices[s] = index
+		e.table = append(e.table, s)
+	}
+	e.body = binary.AppendUvarint(e.body, index)
+}
+
+func (e *binaryEncoder) writeValue(v any, depth int) error {
+	if depth > maxBinaryNesting {
+		return errors.New("metadata nested too deeply")
+	}
+	switch value := v.(type) {
+	case nil:
+		e.body = append(e.body, wireNil)
+	case string:
+		e.body = append(e.body, wireString)
+		e.writeString(value)
+	case bool:
+		if value {
+			e.body = append(e.body, wireTrue)
+		} else {
+			e.body = append(e.body, wireFalse)
+		}
+	case []string:
+		e.body = append(e.body, wireList)
+		e.body = binary.AppendUvarint(e.body, uint64(len(value)))
+		for _, s := range value {
+			e.body = append(e.body, wireString)
+			e.writeString(s)
+		}
+	case []interface{}:
+		e.body = append(e.body, wireList)
+		e.body = binary.AppendUvarint(e.body, uint64(len(value)))
+		for _, item := range value {
+			if err := e.writeValue(item, depth+1); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		e.body = append(e.body, wireMap)
+		e.body = binary.AppendUvarint(e.body, uint64(len(value))+1)
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			e.writeString(key)
+			if err := e.writeValue(value[key], depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		// numbers are decoded as float64, the same as from JSON
+		if number, ok := numberOf(value); ok {
+			e.body = append(e.body, wireNumber)
+			e.body = binary.LittleEndian.AppendUint64(e.body, math.Float64bits(number))
+			return nil
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		e.body = append(e.body, wireJSON)
+		e.body = binary.AppendUvarint(e.body, uint64(len(raw)))
+		e.body = append(e.body, raw...)
+	}
+	return nil
+}
+
+type binaryDecoder struct {
+	data  []byte
+	pos   int
+	table []string
+}
+
+func (d *binaryDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errTruncatedBinaryState
+	}
+	d.pos++
+	return d.data[d.pos-1], nil
+}
+
+func (d *binaryDecoder) readUvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, errTruncatedBinaryState
+	}
+	d.pos += n
+	return v, nil
+}
+
+// readCount reads a number of items, each taking at least a byte
+func (d *binaryDecoder) readCount() (int, error) {
+	count, err := d.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if count > uint64(len(d.data)-d.pos) {
+		return 0, errTruncatedBinaryState
+	}
+	return int(count), nil
+}
+
+// readOptionalCount reads a count of a map that can be absent
+func (d *binaryDecoder) readOptionalCount() (int, bool, error) {
+	count, err := d.readUvarint()
+	if err != nil {
+		return 0, false, err
+	}
+	if count == 0 {
+		return 0, false, nil
+	}
+	if count-1 > uint64(len(d.data)-d.pos) {
+		return 0, false, errTruncatedBinaryState
+	}
+	return int(count - 1), true, nil
+}
+
+func (d *binaryDecoder) readBytes() ([]byte, error) {
+	length, err := d.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(d.data)-d.pos) {
+		return nil, errTruncatedBinaryState
+	}
+	res := d.data[d.pos : d.pos+int(length)]
+	d.pos += int(length)
+	return res, nil
+}
+
+func (d *binaryDecoder) readString() (string, error) {
+	index, err := d.readUvarint()
+	if err != nil {
+		return "", err
+	}
+	if index >= uint64(len(d.table)) {
+		return "", fmt.Errorf("string index %d out of range", index)
+	}
+	return d.table[index], nil
+}
+
+func (d *binaryDecoder) readPeers() (map[string]int64, error) {
+	count, present, err := d.readOptionalCount()
+	if err != nil || !present {
+		return nil, err
+	}
+	res := make(map[string]int64, count)
+	for range count {
+		peer, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, n := binary.Varint(d.data[d.pos:])
+		if n <= 0 {
+			return nil, errTruncatedBinaryState
+		}
+		d.pos += n
+		res[peer] = value
+	}
+	return res, nil
+}
+
+func (d *binaryDecoder) readMap(depth int) (map[string]interface{}, error) {
+	count, present, err := d.readOptionalCount()
+	if err != nil || !present {
+		return nil, err
+	}
+	res := make(map[string]interface{}, count)
+	for range count {
+		key, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		if res[key], err = d.readValue(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (d *binaryDecoder) readValue(depth int) (interface{}, error) {
+	if depth > maxBinaryNesting {
+		return nil, errors.New("metadata nested too deeply")
+	}
+	tag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case wireNil:
+		return nil, nil
+	case wireString:
+		return d.readString()
+	case wireFalse:
+		return false, nil
+	case wireTrue:
+		return true, nil
+	case wireNumber:
+		if len(d.data)-d.pos < 8 {
+			return nil, errTruncatedBinaryState
+		}
+		bits := binary.LittleEndian.Uint64(d.data[d.pos:])
+		d.pos += 8
+		return math.Float64frombits(bits), nil
+	case wireList:
+		count, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		res := make([]interface{}, 0, count)
+		for range count {
+			item, err := d.readValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, item)
+		}
+		return res, nil
+	case wireMap:
+		m, err := d.readMap(depth)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return nil, errors.New("absent nested map")
+		}
+		return m, nil
+	case wireJSON:
+		raw, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		var res interface{}
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unknown value tag %d", tag)
+}
+
+func numberOf(v any) (float64, bool) {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
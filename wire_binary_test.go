@@ -0,0 +1,145 @@
+package percounter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryWireFormat(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		state := NetworkedGCounterState{
+			Type:       GCounterNetworkMessage,
+			SourcePeer: "a",
+			Name:       "x",
+			Peers:      map[string]int64{"a": 1, "b": 1 << 40, "c": -3},
+			Metadata: map[string]interface{}{
+				MyIPKey:         "127.0.0.1",
+				MyTcpPortKey:    "5001",
+				SwimSeqKey:      float64(42),
+				CapabilitiesKey: []interface{}{"gzip"},
+				"reply":         true,
+				"nested":        map[string]interface{}{"a": nil, "b": false},
+			},
+			State: json.RawMessage(`{"elements":{"a":true}}`),
+		}
+		data, err := EncodeBinaryState(&state)
+		require.NoError(t, err)
+		assert.True(t, isBinaryEncoded(data))
+		decoded, err := DecodeBinaryState(data)
+		require.NoError(t, err)
+		assert.Equal(t, state, decoded)
+	})
+
+	t.Run("go values decode as from JSON", func(t *testing.T) {
+		state := NetworkedGCounterState{
+			Type: SwimPingNetworkMessage,
+			Metadata: map[string]interface{}{
+				SwimSeqKey:      uint64(7),
+				CapabilitiesKey: []string{"gzip"},
+				MembersKey:      []MemberUpdate{{"a", "", MemberAlive, 1}},
+			},
+		}
+		data, err := EncodeBinaryState(&state)
+		require.NoError(t, err)
+		decoded, err := DecodeBinaryState(data)
+		require.NoError(t, err)
+
+		viaJSON := NetworkedGCounterState{}
+		jsonData, err := json.Marshal(state)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(jsonData, &viaJSON))
+		assert.Equal(t, viaJSON.Metadata, decoded.Metadata)
+	})
+
+	t.Run("absent and empty maps are told apart", func(t *testing.T) {
+		for _, state := range []NetworkedGCounterState{
+			{Peers: nil, Metadata: nil},
+			{Peers: map[string]int64{}, Metadata: map[string]interface{}{}},
+		} {
+			data, err := EncodeBinaryState(&state)
+			require.NoError(t, err)
+			decoded, err := DecodeBinaryState(data)
+			require.NoError(t, err)
+			assert.Equal(t, state, decoded)
+		}
+	})
+
+	t.Run("smaller than JSON", func(t *testing.T) {
+		state := NetworkedGCounterState{Type: GCounterNetworkMessage, Name: "x", Peers: map[string]int64{}}
+		for _, peer := range []string{"node-a", "node-b", "node-c", "node-d"} {
+			state.Peers[peer] = 12345
+		}
+		data, err := EncodeBinaryState(&state)
+		require.NoError(t, err)
+		jsonData, err := json.Marshal(state)
+		require.NoError(t, err)
+		assert.Less(t, len(data), len(jsonData))
+	})
+
+	t.Run("malformed input", func(t *testing.T) {
+		data, err := EncodeBinaryState(&NetworkedGCounterState{Type: "t", Peers: map[string]int64{"a": 1}})
+		require.NoError(t, err)
+		for i := range len(data) {
+			_, err := DecodeBinaryState(data[:i])
+			assert.Error(t, err, "truncated at %d", i)
+		}
+		_, err = DecodeBinaryState(append(data, 0))
+		assert.Error(t, err)
+		unsupported := append([]byte{}, data...)
+		unsupported[len(binaryWireMagic)] = binaryWireFormatVersion + 1
+		_, err = DecodeBinaryState(unsupported)
+		assert.Error(t, err)
+		_, err = DecodeBinaryState([]byte(`{"type":"t"}`))
+		assert.Error(t, err)
+	})
+}
+
+func FuzzBinaryWireFormatRoundTrip(f *testing.F) {
+	f.Add("g-counter.network.message", "a", "x", "b", int64(1), "my_ip", "127.0.0.1", []byte(`{"a":1}`))
+	f.Add("", "", "", "", int64(-1), "", "", []byte{})
+	f.Fuzz(func(t *testing.T, messageType, sourcePeer, name, peer string, count int64, key, value string, state []byte) {
+		original := NetworkedGCounterState{
+			Type:       messageType,
+			SourcePeer: sourcePeer,
+			Name:       name,
+			Peers:      map[string]int64{peer: count},
+			Metadata:   map[string]interface{}{key: value, key + "-list": []interface{}{value, float64(count), true}},
+		}
+		if len(state) > 0 {
+			original.State = state
+		}
+		data, err := EncodeBinaryState(&original)
+		require.NoError(t, err)
+		decoded, err := DecodeBinaryState(data)
+		require.NoError(t, err)
+		assert.Equal(t, original, decoded)
+	})
+}
+
+func FuzzBinaryWireFormatDecode(f *testing.F) {
+	seed, _ := EncodeBinaryState(&NetworkedGCounterState{
+		Type:     GCounterNetworkMessage,
+		Peers:    map[string]int64{"a": 1},
+		Metadata: map[string]interface{}{"k": []interface{}{"v", map[string]interface{}{"n": 1.5}}},
+		State:    json.RawMessage(`{}`),
+	})
+	f.Add(seed)
+	f.Add(append([]byte{}, binaryWireMagic...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoded, err := DecodeBinaryState(data)
+		if err != nil {
+			return
+		}
+		// whatever decodes must survive a round trip, compared encoded as NaN != NaN
+		reencoded, err := EncodeBinaryState(&decoded)
+		require.NoError(t, err)
+		again, err := DecodeBinaryState(reencoded)
+		require.NoError(t, err)
+		encodedAgain, err := EncodeBinaryState(&again)
+		require.NoError(t, err)
+		assert.Equal(t, reencoded, encodedAgain)
+	})
+}
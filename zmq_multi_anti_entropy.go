@@ -0,0 +1,179 @@
+package percounter
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+// SetAntiEntropyInterval should be called before Start. Every interval, the state digest is sent
+// to a random peer, which responds with the replicas that differ. Zero disables anti-entropy
+func (z *ZmqMultiGcounter) SetAntiEntropyInterval(interval time.Duration) {
+	phony.Block(z, func() {
+		z.antiEntropyInterval = interval
+	})
+}
+
+// SyncWithPeer starts an anti-entropy exchange with the peer
+func (z *ZmqMultiGcounter) SyncWithPeer(peer string) {
+	z.Act(z, func() {
+		z.startSyncSync(peer)
+	})
+}
+
+// Digest summarizes the state of all replicas
+func (z *ZmqMultiGcounter) Digest() StateDigest {
+	var res StateDigest
+	phony.Block(z, func() {
+		res = z.digestSync()
+	})
+	return res
+}
+
+func (z *ZmqMultiGcounter) startAntiEntropy() {
+	phony.Block(z, func() {
+		if z.antiEntropyInterval <= 0 || z.antiEntropyStop != nil {
+			return
+		}
+		z.antiEntropyStop = make(chan struct{})
+		go z.antiEntropyLoop(z.antiEntropyInterval, z.antiEntropyStop)
+	})
+}
+
+func (z *ZmqMultiGcounter) stopAntiEntropy() {
+	phony.Block(z, func() {
+		if z.antiEntropyStop == nil {
+			return
+		}
+		close(z.antiEntropyStop)
+		z.antiEntropyStop = nil
+	})
+}
+
+func (z *ZmqMultiGcounter) antiEntropyLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			z.Act(z, func() {
+				if len(z.peers) == 0 {
+					return
+				}
+				z.startSyncSync(z.peers[rand.IntN(len(z.peers))])
+			})
+		}
+	}
+}
+
+func (z *ZmqMultiGcounter) digestSync() StateDigest {
+	res := StateDigest{}
+	for key, replica := range z.inner {
+		hash, err := replica.stateDigest()
+		if err != nil {
+			log.Printf("%s: could not digest %s '%s': %v", z.identity, key.typeTag, key.name, err)
+			continue
+		}
+		res.Set(key.typeTag, key.name, hash)
+	}
+	return res
+}
+
+// startSyncSync skips peers known not to support anti-entropy
+func (z *ZmqMultiGcounter) startSyncSync(peer string) {
+	protocol, known := z.peerProtocols[peer]
+	switch {
+	case z.merkleSync && (!known || protocol.Supports(MerkleSyncCapability)):
+		z.sendMerkleNodesSync(peer, map[string]string{"": z.merkleTreeSync(true).Root()})
+	case !known || protocol.Supports(AntiEntropyCapability):
+		z.sendDigestSync(peer, false, nil)
+	}
+}
+
+// sendDigestSync sends the digest of the replicas within the Merkle subtrees of the scope, or of all replicas
+func (z *ZmqMultiGcounter) sendDigestSync(peer string, reply bool, scope []string) {
+	local := z.digestSync()
+	if scope != nil {
+		local = local.within(scope)
+	}
+	digest, err := json.Marshal(local)
+	if err != nil {
+		log.Printf("%s: error serializing the digest: %v", z.identity, err)
+		return
+	}
+	metadata := z.myConnectionInfoSync()
+	metadata[AntiEntropyReplyKey] = reply
+	if scope != nil {
+		metadata[AntiEntropyScopeKey] = scope
+	}
+	z.sendSync(peer, &NetworkedGCounterState{
+		Type:       AntiEntropyDigestMessage,
+		SourcePeer: z.identity,
+		Metadata:   metadata,
+		State:      digest,
+	})
+}
+
+func (z *ZmqMultiGcounter) onDigest(msg *NetworkedGCounterState) {
+	remote := StateDigest{}
+	if err := json.Unmarshal(msg.State, &remote); err != nil {
+		log.Printf("%s: malformed digest from %s: %v", z.identity, msg.SourcePeer, err)
+		return
+	}
+	reply, _ := msg.Metadata[AntiEntropyReplyKey].(bool)
+	scope := tryGetPeerMetadataStrings(msg, AntiEntropyScopeKey)
+	peer := peerAddressOf(msg)
+	z.Act(z, func() {
+		local := z.digestSync()
+		if scope != nil {
+			local = local.within(scope)
+		}
+		for _, key := range local.staleIn(remote) {
+			replica := z.inner[key]
+			if peer == "" {
+				// without an address to respond to, fall back to the configured peers
+				z.propagateStateSync(key.typeTag, key.name, replica.Snapshot())
+				continue
+			}
+			if err := z.sendReplicaToPeerSync(peer, key, replica); err != nil {
+				log.Printf("%s: error serializing state: %v", key.name, err)
+			}
+		}
+		if !reply && peer != "" && len(remote.staleIn(local)) > 0 {
+			// pull the replicas the peer has newer
+			z.sendDigestSync(peer, true, scope)
+		}
+	})
+}
+
+// peerAddressOf is empty if the peer did not advertise its address
+func peerAddressOf(msg *NetworkedGCounterState) string {
+	peerIp, ipErr := tryGetPeerIp(msg)
+	peerPort, portErr := tryGetPeerTcpPort(msg)
+	if ipErr != nil || portErr != nil || peerIp == "" || peerPort == "" {
+		return ""
+	}
+	return zmqAddressOf(peerIp, peerPort)
+}
+
+// tryGetPeerMetadataStrings is nil if the key is absent or not a list of strings
+func tryGetPeerMetadataStrings(msg *NetworkedGCounterState, key string) []string {
+	values, ok := msg.Metadata[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	res := []string{}
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return nil
+		}
+		res = append(res, s)
+	}
+	return res
+}
@@ -0,0 +1,76 @@
+package percounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterAntiEntropy(t *testing.T) {
+	startConnectedPair := func(t *testing.T, antiEntropyInterval time.Duration) (*ZmqMultiGcounter, *ZmqMultiGcounter, string, string) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		c1.SetMyIP("127.0.0.1")
+		c1.SetAntiEntropyInterval(antiEntropyInterval)
+		assert.NoError(t, c1.Start())
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		c2.SetMyIP("127.0.0.1")
+		assert.NoError(t, c2.Start())
+		address1 := zmqAddressOf("127.0.0.1", port1)
+		address2 := zmqAddressOf("127.0.0.1", port2)
+		c1.UpdatePeers([]string{address2})
+		c2.UpdatePeers([]string{address1})
+		waitForMemberStateOf(t, MemberAlive, c1, "2")
+		waitForMemberStateOf(t, MemberAlive, c2, "1")
+		return c1, c2, address1, address2
+	}
+
+	// a replica loaded from disk is not propagated, as if its messages were missed
+	loadUnpropagatedCounter := func(t *testing.T, c *ZmqMultiGcounter, name string, increments int) {
+		counter := NewPersistentGCounter(c.identity, c.multiFilenameFor(name, GCounterCRDTType.Extension))
+		for range increments {
+			counter.Increment()
+		}
+		counter.PersistSync()
+		assert.NoError(t, c.LoadAllSync())
+	}
+
+	t.Run("the responder sends what the requester lacks", func(t *testing.T) {
+		c1, c2, address1, _ := startConnectedPair(t, 0)
+		defer c1.Stop()
+		defer c2.Stop()
+		loadUnpropagatedCounter(t, c1, "x", 2)
+
+		c2.SyncWithPeer(address1)
+		waitForMultiGcounterValueOf(t, 2, c2, "x")
+	})
+
+	t.Run("the requester pulls what the responder lacks", func(t *testing.T) {
+		c1, c2, _, address2 := startConnectedPair(t, 0)
+		defer c1.Stop()
+		defer c2.Stop()
+		loadUnpropagatedCounter(t, c1, "x", 3)
+
+		c1.SyncWithPeer(address2)
+		waitForMultiGcounterValueOf(t, 3, c2, "x")
+		waitForEqualDigests(t, c1, c2)
+	})
+
+	t.Run("periodic anti-entropy", func(t *testing.T) {
+		c1, c2, _, _ := startConnectedPair(t, 100*time.Millisecond)
+		defer c1.Stop()
+		defer c2.Stop()
+		loadUnpropagatedCounter(t, c1, "x", 1)
+		loadUnpropagatedCounter(t, c2, "y", 2)
+
+		waitForMultiGcounterValueOf(t, 2, c1, "y")
+		waitForMultiGcounterValueOf(t, 1, c2, "x")
+	})
+}
+
+func waitForEqualDigests(t *testing.T, c1, c2 *ZmqMultiGcounter) {
+	waitFor(t, func() bool { return assert.ObjectsAreEqual(c1.Digest(), c2.Digest()) })
+	assert.Equal(t, c1.Digest(), c2.Digest())
+}
@@ -0,0 +1,131 @@
+package percounter
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+// BatchConfig: changes are sent as one message FlushInterval after the first one, or once MaxBatchSize are pending
+type BatchConfig struct {
+	FlushInterval time.Duration
+	MaxBatchSize  int
+}
+
+func DefaultBatchConfig() BatchConfig {
+	return BatchConfig{
+		FlushInterval: 50 * time.Millisecond,
+		MaxBatchSize:  100,
+	}
+}
+
+type stateBatch struct {
+	config    BatchConfig
+	pending   map[replicaKey]CRDT
+	order     []replicaKey
+	scheduled bool
+}
+
+// EnableBatching sends replica changes in batches to the peers supporting them
+func (z *ZmqMultiGcounter) EnableBatching(config BatchConfig) {
+	phony.Block(z, func() {
+		z.batch = &stateBatch{
+			config:  config,
+			pending: map[replicaKey]CRDT{},
+		}
+	})
+}
+
+// FlushBatch sends the pending changes immediately
+func (z *ZmqMultiGcounter) FlushBatch() {
+	phony.Block(z, func() {
+		z.flushBatchSync()
+	})
+}
+
+func (z *ZmqMultiGcounter) enqueueStateSync(typeTag, name string, snapshot CRDT) {
+	key := replicaKey{typeTag, name}
+	if _, ok := z.batch.pending[key]; !ok {
+		z.batch.order = append(z.batch.order, key)
+	}
+	// the latest snapshot subsumes the earlier ones
+	z.batch.pending[key] = snapshot
+	if len(z.batch.order) >= z.batch.config.MaxBatchSize {
+		z.flushBatchSync()
+		return
+	}
+	if !z.batch.scheduled {
+		z.batch.scheduled = true
+		time.AfterFunc(z.batch.config.FlushInterval, func() {
+			z.Act(z, z.flushBatchSync)
+		})
+	}
+}
+
+func (z *ZmqMultiGcounter) flushBatchSync() {
+	if z.batch == nil {
+		return
+	}
+	z.batch.scheduled = false
+	if len(z.batch.order) == 0 {
+		return
+	}
+	states := []NetworkedGCounterState{}
+	for _, key := range z.batch.order {
+		state, err := z.networkedStateSync(key.typeTag, key.name, z.batch.pending[key])
+		if err != nil {
+			log.Printf("%s: error serializing state: %v", key.name, err)
+			continue
+		}
+		states = append(states, state)
+	}
+	z.batch.pending = map[replicaKey]CRDT{}
+	z.batch.order = nil
+	rawStates, err := json.Marshal(states)
+	if err != nil {
+		log.Printf("%s: error serializing the batch: %v", z.identity, err)
+		return
+	}
+	batchPeers, otherPeers := z.peersBySupportSync(BatchCapability)
+	if len(batchPeers) > 0 {
+		batch := &wireMessage{state: &NetworkedGCounterState{
+			Type:       BatchNetworkMessage,
+			SourcePeer: z.identity,
+			Metadata:   z.myConnectionInfoSync(),
+			State:      rawStates,
+		}}
+		for _, peer := range batchPeers {
+			z.sendWireMessageSync(peer, batch)
+		}
+	}
+	if len(otherPeers) == 0 {
+		return
+	}
+	// peers not known to support batches get the states one by one
+	for i := range states {
+		states[i].Metadata = z.myConnectionInfoSync()
+		m := &wireMessage{state: &states[i]}
+		for _, peer := range otherPeers {
+			z.sendWireMessageSync(peer, m)
+		}
+	}
+}
+
+func (z *ZmqMultiGcounter) onBatch(msg *NetworkedGCounterState) {
+	states := []NetworkedGCounterState{}
+	if err := json.Unmarshal(msg.State, &states); err != nil {
+		log.Printf("%s: malformed batch from %s: %v", z.identity, msg.SourcePeer, err)
+		return
+	}
+	for i := range states {
+		state := &states[i]
+		crdtType, ok := LookupCRDTType(state.Type)
+		if !ok {
+			log.Printf("unknown message type '%s' in a batch from '%s', ignoring", state.Type, msg.SourcePeer)
+			continue
+		}
+		z.mergeReplicaMessage(crdtType, state)
+	}
+}
@@ -0,0 +1,94 @@
+package percounter
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterBatching(t *testing.T) {
+	startPair := func(t *testing.T, config BatchConfig) (*ZmqMultiGcounter, *ZmqMultiGcounter, *testClusterObserver) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		c1.SetMyIP("127.0.0.1")
+		c1.EnableBatching(config)
+		assert.NoError(t, c1.Start())
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		c2.SetMyIP("127.0.0.1")
+		observer := newTestClusterObserver()
+		c2.SetClusterObserver(observer)
+		assert.NoError(t, c2.Start())
+		c1.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port2)})
+		waitForMemberStateOf(t, MemberAlive, c2, "1")
+		waitForPeerProtocolOf(t, c1, zmqAddressOf("127.0.0.1", port2))
+		return c1, c2, observer
+	}
+
+	t.Run("changes are coalesced per flush interval", func(t *testing.T) {
+		c1, c2, observer := startPair(t, BatchConfig{FlushInterval: 300 * time.Millisecond, MaxBatchSize: 100})
+		defer c1.Stop()
+		defer c2.Stop()
+
+		for i := range 10 {
+			c1.Increment(fmt.Sprintf("counter-%d", i))
+		}
+		for range 5 {
+			c1.Increment("counter-0")
+		}
+		waitForMultiGcounterValueOf(t, 6, c2, "counter-0")
+		waitForMultiGcounterValueOf(t, 1, c2, "counter-9")
+
+		types := messageTypesReceived(observer)
+		assert.Equal(t, 0, types[GCounterNetworkMessage])
+		assert.Equal(t, 1, types[BatchNetworkMessage])
+	})
+
+	t.Run("a full batch is flushed immediately", func(t *testing.T) {
+		c1, c2, observer := startPair(t, BatchConfig{FlushInterval: time.Hour, MaxBatchSize: 5})
+		defer c1.Stop()
+		defer c2.Stop()
+
+		for i := range 12 {
+			c1.Increment(fmt.Sprintf("counter-%d", i))
+		}
+		waitForMessageTypeCountOf(t, 2, observer, BatchNetworkMessage)
+
+		// the rest is sent on demand
+		c1.FlushBatch()
+		waitForMessageTypeCountOf(t, 3, observer, BatchNetworkMessage)
+		for i := range 12 {
+			waitForMultiGcounterValueOf(t, 1, c2, fmt.Sprintf("counter-%d", i))
+		}
+	})
+
+	t.Run("nodes without batching merge other replica types from batches", func(t *testing.T) {
+		c1, c2, _ := startPair(t, DefaultBatchConfig())
+		defer c1.Stop()
+		defer c2.Stop()
+
+		c1.AddToGSet("s", "a")
+		c1.SetRegister("r", "x")
+		waitForSetElementsOf(t, []string{"a"}, func() []string { return c2.GSetElements("s") })
+		waitForRegisterValueOf(t, "x", c2, "r")
+	})
+}
+
+func messageTypesReceived(o *testClusterObserver) map[string]int {
+	res := map[string]int{}
+	for _, m := range o.MessagesReceived() {
+		msg := NetworkedGCounterState{}
+		if json.Unmarshal([]byte(m.msg), &msg) == nil {
+			res[msg.Type]++
+		}
+	}
+	return res
+}
+
+func waitForMessageTypeCountOf(t *testing.T, expectedCount int, o *testClusterObserver, messageType string) {
+	waitFor(t, func() bool { return messageTypesReceived(o)[messageType] == expectedCount })
+	assert.Equal(t, expectedCount, messageTypesReceived(o)[messageType])
+}
@@ -0,0 +1,91 @@
+package percounter
+
+import (
+	"errors"
+	"log"
+)
+
+func (z *ZmqMultiGcounter) InitBoundedCounter(name string, bound int64) {
+	z.Act(z, func() {
+		replica := z.getOrCreateReplicaSync(BoundedCounterCRDTType, name)
+		replica.UpdateFromActor(z, func(c CRDT) bool {
+			counter := c.(*boundedCounterCRDT)
+			if counter.IsInitialized() {
+				return false
+			}
+			counter.Init(bound)
+			return true
+		})
+	})
+}
+
+// TryIncrementBounded fails if the local share of the bound is exhausted,
+// in which case the other peers are asked to transfer some of their rights
+func (z *ZmqMultiGcounter) TryIncrementBounded(name string) error {
+	replica := z.getReplica(BoundedCounterCRDTType, name)
+	err := replica.TryUpdate(func(c CRDT) error {
+		return c.(*boundedCounterCRDT).TryIncrement()
+	})
+	if errors.Is(err, ErrBoundedCounterExhausted) {
+		z.Act(z, func() {
+			z.broadcastRightsRequestSync(name)
+		})
+	}
+	return err
+}
+
+func (z *ZmqMultiGcounter) TransferBoundedRights(name, to string, amount int64) error {
+	replica := z.getReplica(BoundedCounterCRDTType, name)
+	return replica.TryUpdate(func(c CRDT) error {
+		return c.(*boundedCounterCRDT).Transfer(to, amount)
+	})
+}
+
+func (z *ZmqMultiGcounter) BoundedValue(name string) int64 {
+	return z.getReplica(BoundedCounterCRDTType, name).Value().(int64)
+}
+
+func (z *ZmqMultiGcounter) BoundedLocalRights(name string) int64 {
+	var rights int64
+	z.getReplica(BoundedCounterCRDTType, name).read(func(c CRDT) {
+		rights = c.(*boundedCounterCRDT).LocalRights()
+	})
+	return rights
+}
+
+// BoundedExceeded tells whether concurrent initializations let the increments exceed the bound
+func (z *ZmqMultiGcounter) BoundedExceeded(name string) bool {
+	var exceeded bool
+	z.getReplica(BoundedCounterCRDTType, name).read(func(c CRDT) {
+		exceeded = c.(*boundedCounterCRDT).Exceeded()
+	})
+	return exceeded
+}
+
+func (z *ZmqMultiGcounter) broadcastRightsRequestSync(name string) {
+	request := NetworkedGCounterState{
+		Type:       BoundedCounterRightsRequestMessage,
+		SourcePeer: z.identity,
+		Name:       name,
+		Metadata:   z.myConnectionInfoSync(),
+	}
+	z.broadcastSync(&request)
+}
+
+// a peer with spare rights hands over half of them to the requesting peer
+func (z *ZmqMultiGcounter) onRightsRequest(msg *NetworkedGCounterState) {
+	z.Act(z, func() {
+		replica, ok := z.inner[replicaKey{BoundedCounterNetworkMessage, msg.Name}]
+		if !ok || msg.SourcePeer == "" || msg.SourcePeer == z.identity {
+			return
+		}
+		err := replica.TryUpdate(func(c CRDT) error {
+			counter := c.(*boundedCounterCRDT)
+			rights := counter.LocalRights()
+			return counter.Transfer(msg.SourcePeer, (rights+1)/2)
+		})
+		if err != nil {
+			log.Printf("%s: not transferring rights of %s to %s: %v", z.identity, msg.Name, msg.SourcePeer, err)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterBoundedCounters(t *testing.T) {
+	t.Run("a cluster-wide quota", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		defer c1.Stop()
+		assert.NoError(t, c1.Start())
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		defer c2.Stop()
+		assert.NoError(t, c2.Start())
+		c1.UpdatePeers([]string{"tcp://localhost:" + port2})
+		c2.UpdatePeers([]string{"tcp://localhost:" + port1})
+
+		c1.InitBoundedCounter(name1, 4)
+		assert.NoError(t, c1.TryIncrementBounded(name1))
+		waitForBoundedValueOf(t, 1, c2, name1)
+
+		// c2 has no rights yet, but asks for them
+		assert.ErrorIs(t, c2.TryIncrementBounded(name1), ErrBoundedCounterExhausted)
+		waitForBoundedRightsOf(t, 2, c2, name1)
+		assert.Equal(t, int64(1), c1.BoundedLocalRights(name1))
+
+		assert.NoError(t, c2.TryIncrementBounded(name1))
+		assert.NoError(t, c2.TryIncrementBounded(name1))
+		assert.NoError(t, c1.TryIncrementBounded(name1))
+		waitForBoundedValueOf(t, 4, c1, name1)
+		waitForBoundedValueOf(t, 4, c2, name1)
+
+		// the bound is never exceeded
+		assert.Error(t, c1.TryIncrementBounded(name1))
+		assert.Error(t, c2.TryIncrementBounded(name1))
+		assert.Error(t, c1.TransferBoundedRights(name1, "2", 1))
+
+		c1.PersistSync()
+		c2.PersistSync()
+	})
+}
+
+func waitForBoundedValueOf(t *testing.T, expectedValue int64, c *ZmqMultiGcounter, name string) {
+	waitFor(t, func() bool { return expectedValue == c.BoundedValue(name) })
+	assert.Equal(t, expectedValue, c.BoundedValue(name))
+}
+
+func waitForBoundedRightsOf(t *testing.T, expectedRights int64, c *ZmqMultiGcounter, name string) {
+	waitFor(t, func() bool { return expectedRights == c.BoundedLocalRights(name) })
+	assert.Equal(t, expectedRights, c.BoundedLocalRights(name))
+}
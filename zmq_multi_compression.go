@@ -0,0 +1,82 @@
+package percounter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/Arceliar/phony"
+)
+
+const GzipCompression = "gzip"
+
+// maxDecompressedMessageSize rejects messages expanding beyond any legitimate state
+const maxDecompressedMessageSize = 64 << 20
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// CompressionConfig: messages of at least Threshold bytes are gzipped for the peers supporting it
+type CompressionConfig struct {
+	Threshold int
+	Level     int
+}
+
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		Threshold: 1024,
+		Level:     gzip.DefaultCompression,
+	}
+}
+
+type compressionState struct {
+	config CompressionConfig
+}
+
+// EnableCompression should be called before Start
+func (z *ZmqMultiGcounter) EnableCompression(config CompressionConfig) {
+	phony.Block(z, func() {
+		z.compression = &compressionState{
+			config: config,
+		}
+	})
+}
+
+func (z *ZmqMultiGcounter) shouldCompressSync(msg []byte) bool {
+	return z.compression != nil && len(msg) >= z.compression.config.Threshold
+}
+
+func isCompressed(message []byte) bool {
+	return bytes.HasPrefix(message, gzipMagic)
+}
+
+func gzipCompress(message []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(message); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecompress(message []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	res, err := io.ReadAll(io.LimitReader(r, maxDecompressedMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(res) > maxDecompressedMessageSize {
+		return nil, fmt.Errorf("decompressed message exceeds %d bytes", maxDecompressedMessageSize)
+	}
+	return res, nil
+}
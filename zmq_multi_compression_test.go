@@ -0,0 +1,122 @@
+package percounter
+
+import (
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Arceliar/phony"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipCompression(t *testing.T) {
+	message := []byte(`{"type":"g-counter.network.message","peers":{` + strings.Repeat(`"peer":1,`, 100) + `"last":1}}`)
+	compressed, err := gzipCompress(message, DefaultCompressionConfig().Level)
+	require.NoError(t, err)
+	assert.True(t, isCompressed(compressed))
+	assert.False(t, isCompressed(message))
+	assert.Less(t, len(compressed), len(message))
+
+	decompressed, err := gzipDecompress(compressed)
+	require.NoError(t, err)
+	assert.Equal(t, message, decompressed)
+
+	_, err = gzipDecompress(append([]byte{}, gzipMagic...))
+	assert.Error(t, err)
+
+	bomb, err := gzipCompress(make([]byte, maxDecompressedMessageSize+1), gzip.BestCompression)
+	require.NoError(t, err)
+	_, err = gzipDecompress(bomb)
+	assert.ErrorContains(t, err, "exceeds")
+	exact, err := gzipCompress(make([]byte, maxDecompressedMessageSize), gzip.BestCompression)
+	require.NoError(t, err)
+	decompressed, err = gzipDecompress(exact)
+	require.NoError(t, err)
+	assert.Len(t, decompressed, maxDecompressedMessageSize)
+}
+
+func TestZmqMultiGcounterCompression(t *testing.T) {
+	t.Run("large payloads are compressed for peers supporting it", func(t *testing.T) {
+		newNode := func(identity, port string, compress bool) (*ZmqMultiGcounter, *testClusterObserver) {
+			c := NewZmqMultiGcounter(identity, t.TempDir(), "tcp://:"+port)
+			c.SetMyIP("127.0.0.1")
+			if compress {
+				c.EnableCompression(CompressionConfig{Threshold: 512, Level: DefaultCompressionConfig().Level})
+			}
+			observer := newTestClusterObserver()
+			c.SetClusterObserver(observer)
+			assert.NoError(t, c.Start())
+			return c, observer
+		}
+		port1 := randomPort()
+		port2 := randomPort()
+		port3 := randomPort()
+		c1, observer1 := newNode("1", port1, true)
+		defer c1.Stop()
+		c2, observer2 := newNode("2", port2, true)
+		defer c2.Stop()
+		c3, observer3 := newNode("3", port3, false)
+		defer c3.Stop()
+		c1.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port2), zmqAddressOf("127.0.0.1", port3)})
+		waitForCompressionSupportOf(t, true, c1, zmqAddressOf("127.0.0.1", port2))
+		waitForCompressionSupportOf(t, false, c1, zmqAddressOf("127.0.0.1", port3))
+
+		// a small change is sent as is
+		c1.AddToGSet("s", "a")
+		waitForSetElementsOf(t, []string{"a"}, func() []string { return c2.GSetElements("s") })
+		assert.Empty(t, compressedMessagesOf(observer2.MessagesReceived()))
+
+		elements := []string{"a"}
+		for i := range 50 {
+			element := fmt.Sprintf("a-rather-long-element-name-%d", i)
+			c1.AddToGSet("s", element)
+			elements = append(elements, element)
+		}
+		waitForSetLenOf(t, len(elements), func() []string { return c2.GSetElements("s") })
+		waitForSetLenOf(t, len(elements), func() []string { return c3.GSetElements("s") })
+		assert.NotEmpty(t, compressedMessagesOf(observer2.MessagesReceived()))
+		assert.Empty(t, compressedMessagesOf(observer3.MessagesReceived()))
+		// the sent messages are observed as on the wire
+		assert.NotEmpty(t, compressedMessagesOf(observer1.MessagesSent()))
+		for _, m := range observer1.MessagesSent() {
+			switch m.peer {
+			case zmqAddressOf("127.0.0.1", port2):
+				assert.True(t, len(m.msg) <= 512 || isCompressed([]byte(m.msg)))
+			case zmqAddressOf("127.0.0.1", port3):
+				assert.False(t, isCompressed([]byte(m.msg)))
+			}
+		}
+	})
+}
+
+func compressedMessagesOf(events []testMessageEvent) []testMessageEvent {
+	res := []testMessageEvent{}
+	for _, m := range events {
+		if isCompressed([]byte(m.msg)) {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func compressionSupportOf(c *ZmqMultiGcounter, peer string) (bool, bool) {
+	var supported, known bool
+	phony.Block(c, func() {
+		var protocol PeerProtocol
+		protocol, known = c.peerProtocols[peer]
+		supported = protocol.Supports(GzipCapability)
+	})
+	return supported, known
+}
+
+func waitForCompressionSupportOf(t *testing.T, expected bool, c *ZmqMultiGcounter, peer string) {
+	waitFor(t, func() bool {
+		supported, known := compressionSupportOf(c, peer)
+		return known && supported == expected
+	})
+	supported, known := compressionSupportOf(c, peer)
+	assert.True(t, known)
+	assert.Equal(t, expected, supported)
+}
@@ -2,27 +2,62 @@ package percounter
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/Arceliar/phony"
 	"github.com/d-led/zmqcluster"
 )
 
+// ZmqMultiGcounter hosts named replicas of any registered CRDT type, G-Counters being the default
 type ZmqMultiGcounter struct {
 	phony.Inbox
-	dirname               string
-	identity              string
-	peers                 []string //for tracing only
-	inner                 map[string]*PersistentGCounter
-	cluster               zmqcluster.Cluster
-	observer              CounterObserver
-	clusterObserver       ClusterObserver
-	shouldPersistOnSignal bool
+	dirname              string
+	identity             string
+	peers                []string
+	configuredPeers      []string
+	inner                map[replicaKey]*PersistentCRDT
+	cluster              zmqcluster.Cluster
+	observer             CounterObserver
+	setObserver          SetObserver
+	valueObserver        ValueObserver
+	crdtObserver         CRDTObserver
+	clusterObserver      ClusterObserver
+	membership           *Membership
+	heartbeatStop        chan struct{}
+	gossip               *gossipState
+	antiEntropyInterval  time.Duration
+	antiEntropyStop      chan struct{}
+	merkleSync           bool
+	merkleTree           *MerkleTree
+	batch                *stateBatch
+	compression          *compressionState
+	binaryWireFormat     bool
+	peerProtocols        map[string]PeerProtocol
+	pendingInitialSync   map[string]bool
+	handshakeTimeout     time.Duration
+	emergencyPersistence *EmergencyPersistence
+	instance             string
+	ownCounts            map[string]int64
+	identityCollision    *IdentityCollisionError
+	identityObserver     IdentityCollisionObserver
+	retirements          map[uint64]*retirementRound
+	retirementSeq        uint64
+	retirementLease      *retirementLease
+	identityRetired      error
+}
+
+type replicaKey struct {
+	typeTag string
+	name    string
 }
 
 func NewObservableZmqMultiGcounterInCluster(identity, dirname string, cluster zmqcluster.Cluster, observer CounterObserver) *ZmqMultiGcounter {
@@ -31,14 +66,25 @@ func NewObservableZmqMultiGcounterInCluster(identity, dirname string, cluster zm
 		panic(err)
 	}
 	res := &ZmqMultiGcounter{
-		identity: identity,
-		dirname:  dirname,
-		observer: observer,
-		peers:    []string{},
+		identity:           identity,
+		dirname:            dirname,
+		observer:           observer,
+		setObserver:        &noOpSetObserver{},
+		valueObserver:      &noOpValueObserver{},
+		crdtObserver:       &noOpCRDTObserver{},
+		membership:         NewMembership(DefaultMembershipConfig()),
+		peers:              []string{},
+		peerProtocols:      map[string]PeerProtocol{},
+		pendingInitialSync: map[string]bool{},
+		handshakeTimeout:   DefaultHandshakeTimeout,
+		instance:           newInstanceID(),
+		ownCounts:          map[string]int64{},
+		identityObserver:   &noOpIdentityCollisionObserver{},
+		retirements:        map[uint64]*retirementRound{},
 	}
 	cluster.AddListenerSync(res)
 	res.cluster = cluster
-	res.inner = make(map[string]*PersistentGCounter)
+	res.inner = make(map[replicaKey]*PersistentCRDT)
 	return res
 }
 
@@ -61,9 +107,29 @@ func (z *ZmqMultiGcounter) SetClusterObserver(o ClusterObserver) {
 	})
 }
 
+// SetMyIP sets the IP advertised to peers, so that they can connect back and negotiate capabilities, see protocol.go
+func (z *ZmqMultiGcounter) SetMyIP(ip string) {
+	z.cluster.SetMyIP(ip)
+}
+
+// SetCRDTObserver observes value changes of replicas of all types
+func (z *ZmqMultiGcounter) SetCRDTObserver(o CRDTObserver) {
+	phony.Block(z, func() {
+		z.crdtObserver = o
+	})
+}
+
 func (z *ZmqMultiGcounter) ShouldPersistOnSignal() {
+	z.PersistVia(GlobalEmergencyPersistence())
+}
+
+// PersistVia registers the replicas for persistence in the given registry
+func (z *ZmqMultiGcounter) PersistVia(e *EmergencyPersistence) {
 	phony.Block(z, func() {
-		z.shouldPersistOnSignal = true
+		z.emergencyPersistence = e
+		for _, replica := range z.inner {
+			e.AddForPersistence(replica)
+		}
 	})
 }
 
@@ -76,34 +142,53 @@ func (z *ZmqMultiGcounter) LoadAllSync() error {
 			return
 		}
 		for _, f := range files {
-			counterName, ok := getCounterName(f.Name())
+			crdtType, ok := lookupCRDTTypeByExtension(filepath.Ext(f.Name()))
 			if !ok {
 				continue
 			}
-			_ = z.getOrCreateCounterSync(counterName)
+			_ = z.getOrCreateReplicaSync(crdtType, getFilenameWithoutExtension(f.Name()))
 		}
 	})
 	return err
 }
 
+// Start refuses to start once an identity collision has been detected
 func (z *ZmqMultiGcounter) Start() error {
-	return z.cluster.Start()
+	if err := z.IdentityCollision(); err != nil {
+		return err
+	}
+	if err := z.checkIdentityNotRetired(); err != nil {
+		return err
+	}
+	err := z.cluster.Start()
+	if err != nil {
+		return err
+	}
+	z.startHeartbeats()
+	z.startGossip()
+	z.startAntiEntropy()
+	return nil
 }
 
 func (z *ZmqMultiGcounter) Stop() {
+	z.stopHeartbeats()
+	z.stopGossip()
+	z.stopAntiEntropy()
+	z.FlushBatch()
 	z.cluster.Stop()
 }
 
 func (z *ZmqMultiGcounter) OnMessage(identity []byte, message []byte) {
-	state := NetworkedGCounterState{}
-	err := json.Unmarshal(message, &state)
+	state, err := decodeMessage(message)
 	if err != nil {
 		log.Printf("%s: failed to deserialize state: %v", z.identity, err)
 		return
 	}
+	z.recordSignOfLife(identity, &state)
+	z.recordPeerProtocol(&state)
+	z.checkIdentity(&state)
+	z.onGossip(&state)
 	switch state.Type {
-	case GCounterNetworkMessage:
-		z.MergeWith(NewGCounterFromState(state.Name, GCounterState{state.Name, state.Peers}))
 	case PeerOhaiNetworkMessage:
 		log.Printf("received an 'ohai' from %s, sending 'hello' back", string(identity))
 		peerIp, err := tryGetPeerIp(&state)
@@ -122,9 +207,33 @@ func (z *ZmqMultiGcounter) OnMessage(identity []byte, message []byte) {
 		}
 	case PeerHelloNetworkMessage:
 		log.Printf("received a 'hello' from %s", string(identity))
+	case BoundedCounterRightsRequestMessage:
+		z.onRightsRequest(&state)
+	case SwimPingNetworkMessage:
+		z.onSwimPing(&state)
+	case SwimPingReqNetworkMessage:
+		z.onSwimPingReq(&state)
+	case SwimAckNetworkMessage:
+		z.onSwimAck(&state)
+	case AntiEntropyDigestMessage:
+		z.onDigest(&state)
+	case MerkleSyncMessage:
+		z.onMerkleNodes(&state)
+	case BatchNetworkMessage:
+		z.onBatch(&state)
+	case RetirementPrepareMessage:
+		z.onRetirementPrepare(&state)
+	case RetirementAckMessage:
+		z.onRetirementAck(&state)
+	case RetirementDoneMessage:
+		z.onRetirementDone(&state)
 	default:
-		log.Printf("unknown message type '%s' received: name:'%s', source_peer:'%s', ignoring", state.Type, state.Name, state.SourcePeer)
-		return
+		crdtType, ok := LookupCRDTType(state.Type)
+		if !ok {
+			log.Printf("unknown message type '%s' received: name:'%s', source_peer:'%s', ignoring", state.Type, state.Name, state.SourcePeer)
+			return
+		}
+		z.mergeReplicaMessage(crdtType, &state)
 	}
 
 	peer := string(identity)
@@ -138,6 +247,7 @@ func (z *ZmqMultiGcounter) OnMessage(identity []byte, message []byte) {
 	}
 }
 
+// OnMessageSent reports each message sent by the cluster, as on the wire
 func (z *ZmqMultiGcounter) OnMessageSent(peer string, message []byte) {
 	if z.clusterObserver != nil {
 		z.clusterObserver.AfterMessageSent(peer, message)
@@ -145,140 +255,281 @@ func (z *ZmqMultiGcounter) OnMessageSent(peer string, message []byte) {
 }
 
 func (z *ZmqMultiGcounter) OnNewPeerConnected(c zmqcluster.Cluster, peer string) {
-	z.sendMyStateToPeer(peer)
+	z.Act(z, func() {
+		z.onPeerConnectedSync(peer)
+	})
 }
 
 func (z *ZmqMultiGcounter) UpdatePeers(peers []string) {
 	z.Act(z, func() {
-		z.cluster.UpdatePeers(peers)
-		z.peers = peers
+		z.configuredPeers = peers
+		z.refreshClusterPeersSync()
 		z.broadcastOhaiSync()
 	})
 }
 
+// Increment is refused once the own identity is retired, see TryIncrement
 func (z *ZmqMultiGcounter) Increment(name string) {
 	z.Act(z, func() {
-		counter := z.getOrCreateCounterSync(name)
+		if z.identityRetired != nil {
+			log.Printf("%s: not incrementing '%s': %v", z.identity, name, z.identityRetired)
+			return
+		}
+		counter := newPersistentGCounterOf(z.getOrCreateReplicaSync(GCounterCRDTType, name))
 		counter.IncrementFromActor(z)
 	})
 }
 
-// callback once the inner counter state is changed
-func (z *ZmqMultiGcounter) SetState(s GCounterState) {
+// TryIncrement increments synchronously, failing with ErrIdentityRetired once the own identity is retired
+func (z *ZmqMultiGcounter) TryIncrement(name string) error {
+	var replica *PersistentCRDT
+	var err error
+	phony.Block(z, func() {
+		if err = z.identityRetired; err != nil {
+			return
+		}
+		replica = z.getOrCreateReplicaSync(GCounterCRDTType, name)
+	})
+	if err != nil {
+		return err
+	}
+	return newPersistentGCounterOf(replica).TryIncrement()
+}
+
+// UpdateReplica applies a local change to the named replica of a registered type,
+// see PersistentCRDT.Update
+func (z *ZmqMultiGcounter) UpdateReplica(typeTag, name string, mutate func(CRDT) bool) error {
+	crdtType, ok := LookupCRDTType(typeTag)
+	if !ok {
+		return fmt.Errorf("unknown CRDT type '%s'", typeTag)
+	}
 	z.Act(z, func() {
-		z.propagateStateSync(s)
+		replica := z.getOrCreateReplicaSync(crdtType, name)
+		replica.UpdateFromActor(z, mutate)
 	})
+	return nil
 }
 
-func (c *ZmqMultiGcounter) MergeWith(other GCounterStateSource) {
-	c.Act(c, func() {
-		counter := c.getOrCreateCounterSync(nameOrSingleton(other.GetState().Name))
-		counter.MergeWith(other)
+func (z *ZmqMultiGcounter) GetReplica(typeTag, name string) (*PersistentCRDT, error) {
+	crdtType, ok := LookupCRDTType(typeTag)
+	if !ok {
+		return nil, fmt.Errorf("unknown CRDT type '%s'", typeTag)
+	}
+	return z.getReplica(crdtType, name), nil
+}
+
+// callback once an inner replica state is changed
+func (z *ZmqMultiGcounter) SetCRDTState(typeTag, name string, snapshot CRDT) {
+	z.Act(z, func() {
+		z.recordOwnCountSync(typeTag, name, snapshot)
+		z.propagateStateSync(typeTag, name, snapshot)
 	})
 }
 
+// callback once an inner counter state is changed
+func (z *ZmqMultiGcounter) SetState(s GCounterState) {
+	z.SetCRDTState(GCounterNetworkMessage, nameOrSingleton(s.Name), &gcounterCRDT{NewGCounterFromState(z.identity, s.Copy())})
+}
+
+func (c *ZmqMultiGcounter) MergeWith(other GCounterStateSource) {
+	state := other.GetState().Copy()
+	c.mergeReplica(GCounterCRDTType, nameOrSingleton(state.Name), &gcounterCRDT{NewGCounterFromState(c.identity, state)})
+}
+
 func (c *ZmqMultiGcounter) Value(name string) int64 {
-	var val int64
-	phony.Block(c, func() {
-		counter := c.getOrCreateCounterSync(name)
-		val = counter.Value()
+	return c.GetCounter(name).Value()
+}
+
+// CounterNames are the sorted names of the G-Counter replicas
+func (z *ZmqMultiGcounter) CounterNames() []string {
+	res := []string{}
+	phony.Block(z, func() {
+		for key := range z.inner {
+			if key.typeTag == GCounterCRDTType.Tag {
+				res = append(res, key.name)
+			}
+		}
 	})
-	return val
+	slices.Sort(res)
+	return res
 }
 
-func (c *ZmqMultiGcounter) GetCounter(name string) *PersistentGCounter {
-	var res *PersistentGCounter
-	phony.Block(c, func() {
-		res = c.getOrCreateCounterSync(name)
+func (z *ZmqMultiGcounter) Identity() string {
+	return z.identity
+}
+
+// Peers are the addresses currently connected to, configured or discovered
+func (z *ZmqMultiGcounter) Peers() []string {
+	var res []string
+	phony.Block(z, func() {
+		res = slices.Clone(z.peers)
 	})
 	return res
 }
 
+func (c *ZmqMultiGcounter) GetCounter(name string) *PersistentGCounter {
+	return newPersistentGCounterOf(c.getReplica(GCounterCRDTType, name))
+}
+
 func (c *ZmqMultiGcounter) PersistSync() {
 	phony.Block(c, func() {
-		for _, counter := range c.inner {
-			counter.PersistSync()
+		for _, replica := range c.inner {
+			replica.PersistSync()
 		}
 	})
 }
 
-func (c *ZmqMultiGcounter) PersistOneSync(name string) {
+func (c *ZmqMultiGcounter) TryPersistSync() error {
+	var replicas []*PersistentCRDT
 	phony.Block(c, func() {
-		counter := c.getOrCreateCounterSync(name)
-		counter.PersistSync()
+		replicas = slices.Collect(maps.Values(c.inner))
 	})
+	var errs []error
+	for _, replica := range replicas {
+		if err := replica.TryPersistSync(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *ZmqMultiGcounter) PersistOneSync(name string) {
+	c.getReplica(GCounterCRDTType, name).PersistSync()
+}
+
+func (z *ZmqMultiGcounter) getReplica(crdtType CRDTType, name string) *PersistentCRDT {
+	var res *PersistentCRDT
+	phony.Block(z, func() {
+		res = z.getOrCreateReplicaSync(crdtType, name)
+	})
+	return res
 }
 
-func (z *ZmqMultiGcounter) getOrCreateCounterSync(name string) *PersistentGCounter {
-	if counter, ok := z.inner[name]; ok {
-		return counter
+func (z *ZmqMultiGcounter) mergeReplica(crdtType CRDTType, name string, other CRDT) {
+	z.Act(z, func() {
+		z.checkOwnCountSync(crdtType, name, other)
+		replica := z.getOrCreateReplicaSync(crdtType, name)
+		farBehind := isFarBehind(replica, other)
+		replica.MergeWith(other)
+		z.checkRetiredByPeerSync(replica, other)
+		if farBehind {
+			z.pullDroppedSlotsSync(name)
+		}
+	})
+}
+
+func (z *ZmqMultiGcounter) getOrCreateReplicaSync(crdtType CRDTType, name string) *PersistentCRDT {
+	key := replicaKey{crdtType.Tag, name}
+	if replica, ok := z.inner[key]; ok {
+		return replica
 	}
 
-	counter := NewPersistentGCounterWithSinkAndObserver(z.identity, z.multiCounterFilenameFor(name), z, z.observer)
-	counter.inner.state.Name = name
-	// to do: improve construction
-	z.inner[name] = counter
-	if z.shouldPersistOnSignal {
-		GlobalEmergencyPersistence().AddForPersistence(counter)
+	replica := newNamedPersistentCRDT(crdtType, z.identity, name, z.multiFilenameFor(name, crdtType.Extension), z, z.replicaObserverSync())
+	z.inner[key] = replica
+	if z.emergencyPersistence != nil {
+		z.emergencyPersistence.AddForPersistence(replica)
 	}
-	return counter
+	return replica
 }
 
-func (z *ZmqMultiGcounter) propagateStateSync(s GCounterState) {
-	networkedState := NetworkedGCounterState{
-		Type:       GCounterNetworkMessage,
-		SourcePeer: z.identity,
-		Name:       s.Name,
-		Peers:      s.Peers,
-		Metadata:   z.myConnectionInfoSync(),
+func (z *ZmqMultiGcounter) replicaObserverSync() CRDTObserver {
+	return &replicaObserver{
+		counterObserver: z.observer,
+		setObserver:     z.setObserver,
+		valueObserver:   z.valueObserver,
+		crdtObserver:    z.crdtObserver,
 	}
-	msg, err := json.Marshal(networkedState)
+}
+
+func (z *ZmqMultiGcounter) mergeReplicaMessage(crdtType CRDTType, msg *NetworkedGCounterState) {
+	name := nameOrSingleton(msg.Name)
+	other, err := replicaFromMessage(crdtType, name, msg)
 	if err != nil {
-		log.Printf("%s: error serializing state: %v", s.Name, err)
+		log.Printf("%s: failed to deserialize %s state: %v", z.identity, crdtType.Tag, err)
 		return
 	}
-	z.cluster.BroadcastMessage(msg)
-	if z.clusterObserver == nil {
+	z.mergeReplica(crdtType, name, other)
+}
+
+func (z *ZmqMultiGcounter) propagateStateSync(typeTag, name string, snapshot CRDT) {
+	if z.batch != nil {
+		z.enqueueStateSync(typeTag, name, snapshot)
 		return
 	}
-	for _, peer := range z.peers {
-		z.clusterObserver.AfterMessageSent(peer, msg)
+	state, err := z.networkedStateSync(typeTag, name, snapshot)
+	if err != nil {
+		log.Printf("%s: error serializing state: %v", name, err)
+		return
 	}
+	state.Metadata = z.myConnectionInfoSync()
+	z.broadcastSync(&state)
 }
 
 func (z *ZmqMultiGcounter) sendMyStateToPeer(peer string) {
 	z.Act(z, func() {
-		// send all counters
-		for _, counter := range z.inner {
-			s := counter.GetState()
-			networkedState := NetworkedGCounterState{
-				Type:       GCounterNetworkMessage,
-				SourcePeer: z.identity,
-				Name:       s.Name,
-				Peers:      s.Peers,
-				Metadata:   z.myConnectionInfoSync(),
-			}
-			msg, err := json.Marshal(networkedState)
-			if err != nil {
-				log.Printf("%s: error serializing state: %v", s.Name, err)
+		// send all replicas
+		for key, replica := range z.inner {
+			if err := z.sendReplicaToPeerSync(peer, key, replica); err != nil {
+				log.Printf("%s: error serializing state: %v", key.name, err)
 				return
 			}
-			// sent async - no error handling for now
-			z.cluster.SendMessageToPeer(peer, msg)
-			if z.clusterObserver != nil {
-				z.clusterObserver.AfterMessageSent(peer, msg)
-			}
 		}
 	})
 }
 
-func (z *ZmqMultiGcounter) broadcastOhaiSync() {
-	ohai := NetworkedGCounterState{
-		Type:       PeerOhaiNetworkMessage,
+func (z *ZmqMultiGcounter) sendReplicaToPeerSync(peer string, key replicaKey, replica *PersistentCRDT) error {
+	state, err := z.networkedStateSync(key.typeTag, key.name, replica.Snapshot())
+	if err != nil {
+		return err
+	}
+	state.Metadata = z.myConnectionInfoSync()
+	// sent async - no error handling for now
+	z.sendSync(peer, &state)
+	return nil
+}
+
+func (z *ZmqMultiGcounter) networkedStateSync(typeTag, name string, snapshot CRDT) (NetworkedGCounterState, error) {
+	networkedState := NetworkedGCounterState{
+		Type:       typeTag,
 		SourcePeer: z.identity,
-		Metadata:   z.myConnectionInfoSync(),
+		Name:       name,
 	}
-	msg, err := json.Marshal(ohai)
+	if counter, ok := snapshot.(*gcounterCRDT); ok {
+		// g-counters keep the original wire format, the retired slot is only understood by current peers
+		networkedState.Peers = counter.state.Peers
+		if counter.state.Retired != nil {
+			rawState, err := counter.Marshal()
+			if err != nil {
+				return networkedState, err
+			}
+			networkedState.State = rawState
+		}
+	} else {
+		rawState, err := snapshot.Marshal()
+		if err != nil {
+			return networkedState, err
+		}
+		networkedState.State = rawState
+	}
+	return networkedState, nil
+}
+
+func replicaFromMessage(crdtType CRDTType, name string, msg *NetworkedGCounterState) (CRDT, error) {
+	res := crdtType.New("temporary-replica", name)
+	if counter, ok := res.(*gcounterCRDT); ok {
+		if len(msg.State) > 0 {
+			return counter, counter.Unmarshal(msg.State)
+		}
+		if msg.Peers != nil {
+			counter.state.Peers = msg.Peers
+		}
+		return counter, nil
+	}
+	return res, res.Unmarshal(msg.State)
+}
+
+func (z *ZmqMultiGcounter) broadcastOhaiSync() {
+	msg, err := z.ohaiMessageSync()
 	if err != nil {
 		log.Println("error serializing ohai: ", err)
 		return
@@ -286,20 +537,40 @@ func (z *ZmqMultiGcounter) broadcastOhaiSync() {
 	z.cluster.BroadcastMessage(msg)
 }
 
-func (z *ZmqMultiGcounter) sendHelloToPeer(peer string) {
-	ohai := NetworkedGCounterState{
-		Type:       PeerHelloNetworkMessage,
-		SourcePeer: z.identity,
-		Metadata:   map[string]interface{}{"my_ip": z.cluster.MyIP()},
-	}
-	msg, err := json.Marshal(ohai)
+func (z *ZmqMultiGcounter) sendOhaiToPeerSync(peer string) {
+	msg, err := z.ohaiMessageSync()
 	if err != nil {
-		log.Println("error serializing hello: ", err)
+		log.Println("error serializing ohai: ", err)
 		return
 	}
 	z.cluster.SendMessageToPeer(peer, msg)
 }
 
+// the handshake stays JSON for peers of any protocol version to understand it
+func (z *ZmqMultiGcounter) ohaiMessageSync() ([]byte, error) {
+	return json.Marshal(NetworkedGCounterState{
+		Type:       PeerOhaiNetworkMessage,
+		SourcePeer: z.identity,
+		Metadata:   z.myConnectionInfoSync(),
+	})
+}
+
+func (z *ZmqMultiGcounter) sendHelloToPeer(peer string) {
+	z.Act(z, func() {
+		hello := NetworkedGCounterState{
+			Type:       PeerHelloNetworkMessage,
+			SourcePeer: z.identity,
+			Metadata:   z.myConnectionInfoSync(),
+		}
+		msg, err := json.Marshal(hello)
+		if err != nil {
+			log.Println("error serializing hello: ", err)
+			return
+		}
+		z.cluster.SendMessageToPeer(peer, msg)
+	})
+}
+
 func zmqAddressOf(peerIp, peerPort string) string {
 	return fmt.Sprintf("tcp://[%s]:%s", peerIp, peerPort)
 }
@@ -324,15 +595,43 @@ func tryGetPeerMetadataString(msg *NetworkedGCounterState, key string) (string,
 	return val, nil
 }
 
-func (z *ZmqMultiGcounter) multiCounterFilenameFor(name string) string {
-	return path.Join(z.dirname, name+".gcounter")
+func (z *ZmqMultiGcounter) multiFilenameFor(name, extension string) string {
+	return path.Join(z.dirname, name+extension)
 }
 
 func (z *ZmqMultiGcounter) myConnectionInfoSync() map[string]interface{} {
-	return map[string]interface{}{
+	res := map[string]interface{}{
 		MyIPKey:      z.cluster.MyIP(),
 		MyTcpPortKey: z.cluster.MyTcpPort(),
 	}
+	if z.gossip != nil {
+		res[MembersKey] = z.piggybackedUpdatesSync()
+	}
+	res[InstanceKey] = z.instance
+	res[ProtocolVersionKey] = ProtocolVersion
+	res[CapabilitiesKey] = z.capabilitiesSync()
+	return res
+}
+
+// replicaObserver dispatches value changes to the observers of the respective value types
+type replicaObserver struct {
+	counterObserver CounterObserver
+	setObserver     SetObserver
+	valueObserver   ValueObserver
+	crdtObserver    CRDTObserver
+}
+
+// OnNewCRDTValue dispatches by the type of the replica, other types only reaching the CRDT observer
+func (o *replicaObserver) OnNewCRDTValue(ev CRDTEvent) {
+	switch ev.Type {
+	case GCounterCRDTType.Tag, MaxRegisterCRDTType.Tag, MinRegisterCRDTType.Tag:
+		o.counterObserver.OnNewCount(CountEvent{ev.Name, ev.Value.(int64)})
+	case GSetCRDTType.Tag, ORSetCRDTType.Tag:
+		o.setObserver.OnNewElements(SetEvent{ev.Name, ev.Value.([]string)})
+	case LWWRegisterCRDTType.Tag:
+		o.valueObserver.OnNewValue(ValueEvent{ev.Name, ev.Value.(string)})
+	}
+	o.crdtObserver.OnNewCRDTValue(ev)
 }
 
 func nameOrSingleton(name string) string {
@@ -341,10 +640,3 @@ func nameOrSingleton(name string) string {
 	}
 	return "singleton"
 }
-
-func getCounterName(filename string) (string, bool) {
-	if filepath.Ext(filename) != ".gcounter" {
-		return "", false
-	}
-	return getFilenameWithoutExtension(filename), true
-}
@@ -1,11 +1,10 @@
 package percounter
 
 import (
-	"log"
 	"os"
 	"testing"
-	"time"
 
+	"github.com/Arceliar/phony"
 	"github.com/d-led/zmqcluster"
 	"github.com/stretchr/testify/assert"
 )
@@ -41,7 +40,7 @@ func TestZmqMultiGcounter(t *testing.T) {
 		// upon c1 discovering a new peer, c2 should merge from c1
 		c1.UpdatePeers([]string{"tcp://localhost:" + port2})
 		waitForMultiGcounterValueOf(t, 1, c2, name1)
-		assert.Len(t, clusterObserver1.MessagesSent(), 3 /*1 ohai, 2 updates*/)
+		assert.Len(t, clusterObserver1.MessagesSent(), 2 /*ohai+state*/)
 		assert.Len(t, clusterObserver2.MessagesReceived(), 2)
 
 		// until now, only the first 2 values should have been observed
@@ -64,11 +63,11 @@ func TestZmqMultiGcounter(t *testing.T) {
 		c2.PersistSync()
 
 		// 1 c1 sync after connect
-		assert.Len(t, clusterObserver1.MessagesSent(), 3)
+		assert.Len(t, clusterObserver1.MessagesSent(), 2)
 		assert.Len(t, clusterObserver2.MessagesReceived(), 2 /*ohai+state*/)
 		// 1 broadcast on merge + 1 incremement from c2
 		assert.Len(t, clusterObserver1.MessagesReceived(), 3 /*ohai+hello+state*/)
-		assert.Len(t, clusterObserver2.MessagesSent(), 5)
+		assert.Len(t, clusterObserver2.MessagesSent(), 3 /*ohai+sync after connect+increment*/)
 
 		// now all should have been observed
 		assert.Equal(t, []CountEvent{
@@ -192,6 +191,33 @@ func TestZmqMultiGcounter(t *testing.T) {
 		c.PersistSync()
 	})
 
+	t.Run("counter observers see G-Counters and registers", func(t *testing.T) {
+		testObserver := newTestCounterObserver()
+		c := NewObservableZmqMultiGcounter("1", t.TempDir(), "tcp://:"+randomPort(), testObserver)
+		defer c.Stop()
+		assert.NoError(t, c.Start())
+
+		c.ObserveMax("max", 5)
+		c.ObserveMin("min", -1)
+		c.InitBoundedCounter("bounded", 3)
+		c.Increment(name1)
+		waitForMultiGcounterValueOf(t, 1, c, name1)
+		assert.Equal(t, int64(5), c.MaxValue("max"))
+		assert.Equal(t, int64(-1), c.MinValue("min"))
+		assert.Equal(t, int64(0), c.BoundedValue("bounded"))
+
+		// the bounded counter is not reported
+		assert.ElementsMatch(t, []CountEvent{
+			{name1, 0},
+			{name1, 1},
+			{"max", 0},
+			{"max", 5},
+			{"min", 0},
+			{"min", -1},
+		}, testObserver.WaitForGtValuesSeen(t, 6))
+		c.PersistSync()
+	})
+
 	t.Run("re-using an existing cluster but the named counters are not synced", func(t *testing.T) {
 		port1 := randomPort()
 		c := zmqcluster.NewZmqCluster("1", "tcp://:"+port1)
@@ -233,13 +259,43 @@ func TestZmqMultiGcounter(t *testing.T) {
 }
 
 func waitForMultiGcounterValueOf(t *testing.T, expectedValue int64, c *ZmqMultiGcounter, name string) {
-	for w := 0; w < 15; w++ {
-		if expectedValue == c.Value(name) {
-			// all ok
-			return
-		}
-		log.Printf("waiting for the counter to arrive at the expected value of %d ...", expectedValue)
-		time.Sleep(100 * time.Millisecond)
-	}
+	waitFor(t, func() bool { return expectedValue == c.Value(name) })
 	assert.Equal(t, expectedValue, c.Value(name))
 }
+
+func replicasOfType(c *ZmqMultiGcounter, typeTag string) []string {
+	res := []string{}
+	phony.Block(c, func() {
+		for key := range c.inner {
+			if key.typeTag == typeTag {
+				res = append(res, key.name)
+			}
+		}
+	})
+	return res
+}
+
+func TestZmqMultiGcounterCustomCRDT(t *testing.T) {
+	t.Run("replicating a registered custom type", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		defer c1.Stop()
+		assert.NoError(t, c1.Start())
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		defer c2.Stop()
+		assert.NoError(t, c2.Start())
+		c1.UpdatePeers([]string{"tcp://localhost:" + port2})
+
+		assert.Error(t, c1.UpdateReplica("unknown", name1, raiseTestFlag))
+		assert.NoError(t, c1.UpdateReplica(testFlagNetworkMessage, name1, raiseTestFlag))
+
+		replica, err := c2.GetReplica(testFlagNetworkMessage, name1)
+		assert.NoError(t, err)
+		waitFor(t, func() bool { return replica.Value() == true })
+		assert.Equal(t, true, replica.Value())
+
+		c1.PersistSync()
+		c2.PersistSync()
+	})
+}
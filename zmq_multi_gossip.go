@@ -0,0 +1,411 @@
+package percounter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+type gossipState struct {
+	config      GossipConfig
+	incarnation uint64
+	queue       disseminationQueue
+	known       map[string]bool
+	discovered  map[string]string
+	suspectedAt map[string]time.Time
+	probes      map[uint64]*swimProbe
+	seq         uint64
+	lastProbe   time.Time
+	stop        chan struct{}
+}
+
+type swimProbe struct {
+	target   string
+	address  string
+	deadline time.Time
+	indirect bool
+	// set when probing on behalf of another member via ping-req
+	relayTo  string
+	relaySeq uint64
+}
+
+// EnableGossip switches failure detection to SWIM-style probing and disseminates membership
+// piggybacked on the outgoing messages, connecting to the members discovered this way.
+// Should be called before Start
+func (z *ZmqMultiGcounter) EnableGossip(config GossipConfig) {
+	phony.Block(z, func() {
+		z.gossip = &gossipState{
+			config:      config,
+			known:       map[string]bool{},
+			discovered:  map[string]string{},
+			suspectedAt: map[string]time.Time{},
+			probes:      map[uint64]*swimProbe{},
+		}
+	})
+	// liveness is now decided by probing rather than by silence
+	membershipConfig := z.membership.Config()
+	membershipConfig.SuspectTimeout = 0
+	membershipConfig.DeadTimeout = 0
+	z.membership.SetConfig(membershipConfig)
+}
+
+func (z *ZmqMultiGcounter) startGossip() {
+	phony.Block(z, func() {
+		if z.gossip == nil || z.gossip.stop != nil {
+			return
+		}
+		z.gossip.stop = make(chan struct{})
+		go z.gossipLoop(z.gossip.config.ProbeTimeout, z.gossip.stop)
+	})
+}
+
+func (z *ZmqMultiGcounter) stopGossip() {
+	phony.Block(z, func() {
+		if z.gossip == nil || z.gossip.stop == nil {
+			return
+		}
+		close(z.gossip.stop)
+		z.gossip.stop = nil
+	})
+}
+
+func (z *ZmqMultiGcounter) gossipLoop(resolution time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			z.Act(z, z.swimTickSync)
+		}
+	}
+}
+
+func (z *ZmqMultiGcounter) swimTickSync() {
+	if z.gossip == nil {
+		return
+	}
+	now := time.Now()
+	for _, seq := range slices.Sorted(maps.Keys(z.gossip.probes)) {
+		probe := z.gossip.probes[seq]
+		if now.Before(probe.deadline) {
+			continue
+		}
+		z.onProbeTimeoutSync(seq, probe, now)
+	}
+	for _, identity := range slices.Sorted(maps.Keys(z.gossip.suspectedAt)) {
+		if now.Sub(z.gossip.suspectedAt[identity]) < z.gossip.config.SuspicionTimeout {
+			continue
+		}
+		delete(z.gossip.suspectedAt, identity)
+		member, ok := z.membership.Member(identity)
+		if !ok || member.State != MemberSuspect {
+			continue
+		}
+		u := member.Update()
+		u.State = MemberDead
+		z.applyMemberUpdatesSync([]MemberUpdate{u})
+	}
+	if now.Sub(z.gossip.lastProbe) >= z.gossip.config.ProbeInterval {
+		z.gossip.lastProbe = now
+		z.startProbeSync(now)
+	}
+}
+
+func (z *ZmqMultiGcounter) startProbeSync(now time.Time) {
+	candidates := z.probeCandidatesSync("")
+	if len(candidates) == 0 {
+		return
+	}
+	target := candidates[rand.IntN(len(candidates))]
+	seq := z.nextSwimSeqSync()
+	z.gossip.probes[seq] = &swimProbe{
+		target:   target.Identity,
+		address:  target.Address,
+		deadline: now.Add(z.gossip.config.ProbeTimeout),
+	}
+	z.sendSwimMessageSync(target.Address, SwimPingNetworkMessage, seq, nil)
+}
+
+func (z *ZmqMultiGcounter) onProbeTimeoutSync(seq uint64, probe *swimProbe, now time.Time) {
+	if probe.relayTo != "" || probe.indirect {
+		delete(z.gossip.probes, seq)
+		if probe.relayTo == "" {
+			z.suspectSync(probe.target)
+		}
+		return
+	}
+	helpers := z.probeCandidatesSync(probe.target)
+	rand.Shuffle(len(helpers), func(i, j int) {
+		helpers[i], helpers[j] = helpers[j], helpers[i]
+	})
+	helpers = helpers[:min(len(helpers), z.gossip.config.IndirectProbes)]
+	if len(helpers) == 0 {
+		delete(z.gossip.probes, seq)
+		z.suspectSync(probe.target)
+		return
+	}
+	probe.indirect = true
+	// the indirect round trip goes through an intermediary
+	probe.deadline = now.Add(2 * z.gossip.config.ProbeTimeout)
+	for _, helper := range helpers {
+		z.sendSwimMessageSync(helper.Address, SwimPingReqNetworkMessage, seq, map[string]interface{}{
+			SwimTargetKey:        probe.target,
+			SwimTargetAddressKey: probe.address,
+		})
+	}
+}
+
+func (z *ZmqMultiGcounter) suspectSync(identity string) {
+	member, ok := z.membership.Member(identity)
+	if !ok || member.State != MemberAlive {
+		return
+	}
+	u := member.Update()
+	u.State = MemberSuspect
+	z.applyMemberUpdatesSync([]MemberUpdate{u})
+}
+
+// probeCandidatesSync are the reachable non-dead members other than self and except
+func (z *ZmqMultiGcounter) probeCandidatesSync(except string) []Member {
+	return slices.DeleteFunc(z.membership.Members(), func(m Member) bool {
+		return m.Identity == z.identity || m.Identity == except || m.Address == "" || m.State == MemberDead
+	})
+}
+
+func (z *ZmqMultiGcounter) onSwimPing(msg *NetworkedGCounterState) {
+	z.Act(z, func() {
+		seq, address, ok := swimRequestOf(msg)
+		if !ok {
+			return
+		}
+		z.sendSwimMessageSync(address, SwimAckNetworkMessage, seq, nil)
+	})
+}
+
+func (z *ZmqMultiGcounter) onSwimPingReq(msg *NetworkedGCounterState) {
+	z.Act(z, func() {
+		if z.gossip == nil {
+			return
+		}
+		seq, address, ok := swimRequestOf(msg)
+		if !ok {
+			return
+		}
+		target, targetErr := tryGetPeerMetadataString(msg, SwimTargetKey)
+		targetAddress, addressErr := tryGetPeerMetadataString(msg, SwimTargetAddressKey)
+		if targetErr != nil || addressErr != nil {
+			log.Printf("%s: malformed ping-req from %s", z.identity, msg.SourcePeer)
+			return
+		}
+		relaySeq := z.nextSwimSeqSync()
+		z.gossip.probes[relaySeq] = &swimProbe{
+			target:   target,
+			address:  targetAddress,
+			deadline: time.Now().Add(z.gossip.config.ProbeTimeout),
+			relayTo:  address,
+			relaySeq: seq,
+		}
+		z.sendSwimMessageSync(targetAddress, SwimPingNetworkMessage, relaySeq, nil)
+	})
+}
+
+func (z *ZmqMultiGcounter) onSwimAck(msg *NetworkedGCounterState) {
+	z.Act(z, func() {
+		if z.gossip == nil {
+			return
+		}
+		seq, err := tryGetPeerMetadataUint(msg, SwimSeqKey)
+		if err != nil {
+			return
+		}
+		probe, ok := z.gossip.probes[seq]
+		if !ok {
+			return
+		}
+		delete(z.gossip.probes, seq)
+		if probe.relayTo != "" {
+			z.sendSwimMessageSync(probe.relayTo, SwimAckNetworkMessage, probe.relaySeq, nil)
+			return
+		}
+		delete(z.gossip.suspectedAt, probe.target)
+		z.membership.Seen(probe.target, probe.address)
+	})
+}
+
+func (z *ZmqMultiGcounter) sendSwimMessageSync(address, messageType string, seq uint64, extra map[string]interface{}) {
+	metadata := z.myConnectionInfoSync()
+	metadata[SwimSeqKey] = seq
+	for k, v := range extra {
+		metadata[k] = v
+	}
+	z.sendSync(address, &NetworkedGCounterState{
+		Type:       messageType,
+		SourcePeer: z.identity,
+		Metadata:   metadata,
+	})
+}
+
+func (z *ZmqMultiGcounter) nextSwimSeqSync() uint64 {
+	z.gossip.seq++
+	return z.gossip.seq
+}
+
+func (z *ZmqMultiGcounter) onGossip(msg *NetworkedGCounterState) {
+	updates, ok := memberUpdatesOf(msg)
+	if !ok {
+		return
+	}
+	z.Act(z, func() {
+		if z.gossip == nil {
+			return
+		}
+		z.applyMemberUpdatesSync(updates)
+	})
+}
+
+func (z *ZmqMultiGcounter) applyMemberUpdatesSync(updates []MemberUpdate) {
+	for _, u := range updates {
+		if u.Identity == z.identity {
+			z.refuteSync(u)
+			continue
+		}
+		isNew := !z.gossip.known[u.Identity]
+		z.gossip.known[u.Identity] = true
+		applied := z.membership.Apply(u)
+		if !applied && !isNew {
+			continue
+		}
+		z.gossip.queue.enqueue(u)
+		switch u.State {
+		case MemberSuspect:
+			if _, ok := z.gossip.suspectedAt[u.Identity]; !ok {
+				z.gossip.suspectedAt[u.Identity] = time.Now()
+			}
+		default:
+			delete(z.gossip.suspectedAt, u.Identity)
+		}
+		if isNew {
+			// let the newcomer learn about the rest of the cluster
+			for _, m := range z.membership.Members() {
+				z.gossip.queue.enqueue(m.Update())
+			}
+		}
+		z.updateDiscoveredSync(u)
+	}
+}
+
+// refuteSync overrides rumors of this node's failure by a fresher incarnation
+func (z *ZmqMultiGcounter) refuteSync(u MemberUpdate) {
+	if u.State == MemberAlive || u.Incarnation < z.gossip.incarnation {
+		return
+	}
+	z.gossip.incarnation = u.Incarnation + 1
+	z.gossip.queue.enqueue(z.selfUpdateSync())
+}
+
+func (z *ZmqMultiGcounter) selfUpdateSync() MemberUpdate {
+	address := ""
+	if ip := z.cluster.MyIP(); ip != "" {
+		address = zmqAddressOf(ip, z.cluster.MyTcpPort())
+	}
+	return MemberUpdate{
+		Identity:    z.identity,
+		Address:     address,
+		State:       MemberAlive,
+		Incarnation: z.gossip.incarnation,
+	}
+}
+
+func (z *ZmqMultiGcounter) piggybackedUpdatesSync() []MemberUpdate {
+	limit := retransmitLimitFor(z.gossip.config.RetransmitMultiplier, len(z.gossip.known)+1)
+	return append(
+		[]MemberUpdate{z.selfUpdateSync()},
+		z.gossip.queue.next(z.gossip.config.MaxPiggybackedUpdates, limit)...,
+	)
+}
+
+func (z *ZmqMultiGcounter) updateDiscoveredSync(u MemberUpdate) {
+	if u.Address == "" || u.Address == z.selfUpdateSync().Address {
+		return
+	}
+	previous, ok := z.gossip.discovered[u.Identity]
+	switch {
+	case u.State == MemberDead && ok:
+		delete(z.gossip.discovered, u.Identity)
+	case u.State != MemberDead && previous != u.Address:
+		z.gossip.discovered[u.Identity] = u.Address
+	default:
+		return
+	}
+	z.refreshClusterPeersSync()
+}
+
+// refreshClusterPeersSync connects to the configured peers and the ones discovered via gossip
+func (z *ZmqMultiGcounter) refreshClusterPeersSync() {
+	peers := slices.Clone(z.configuredPeers)
+	if z.gossip != nil {
+		for _, identity := range slices.Sorted(maps.Keys(z.gossip.discovered)) {
+			address := z.gossip.discovered[identity]
+			if !slices.Contains(peers, address) {
+				peers = append(peers, address)
+			}
+		}
+	}
+	z.cluster.UpdatePeers(peers)
+	z.peers = peers
+}
+
+func memberUpdatesOf(msg *NetworkedGCounterState) ([]MemberUpdate, bool) {
+	raw, ok := msg.Metadata[MembersKey]
+	if !ok {
+		return nil, false
+	}
+	// round-trip the generically deserialized metadata
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false
+	}
+	updates := []MemberUpdate{}
+	if err := json.Unmarshal(data, &updates); err != nil {
+		log.Printf("malformed membership updates from %s: %v", msg.SourcePeer, err)
+		return nil, false
+	}
+	return updates, true
+}
+
+// swimRequestOf extracts the sequence number and the address to respond to
+func swimRequestOf(msg *NetworkedGCounterState) (uint64, string, bool) {
+	seq, err := tryGetPeerMetadataUint(msg, SwimSeqKey)
+	if err != nil {
+		log.Printf("%s from %s: %v", msg.Type, msg.SourcePeer, err)
+		return 0, "", false
+	}
+	peerIp, ipErr := tryGetPeerIp(msg)
+	peerPort, portErr := tryGetPeerTcpPort(msg)
+	if ipErr != nil || portErr != nil || peerIp == "" || peerPort == "" {
+		log.Printf("%s from %s: no address to respond to", msg.Type, msg.SourcePeer)
+		return 0, "", false
+	}
+	return seq, zmqAddressOf(peerIp, peerPort), true
+}
+
+func tryGetPeerMetadataUint(msg *NetworkedGCounterState, key string) (uint64, error) {
+	valI, ok := msg.Metadata[key]
+	if !ok {
+		return 0, fmt.Errorf("no field '%s' in message", key)
+	}
+	// JSON numbers are deserialized as float64
+	val, ok := valI.(float64)
+	if !ok || val < 0 {
+		return 0, fmt.Errorf("'%s' is not an unsigned number", key)
+	}
+	return uint64(val), nil
+}
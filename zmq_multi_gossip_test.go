@@ -0,0 +1,51 @@
+package percounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterGossip(t *testing.T) {
+	t.Run("discovering the cluster via a seed and detecting failures", func(t *testing.T) {
+		config := GossipConfig{
+			ProbeInterval:         100 * time.Millisecond,
+			ProbeTimeout:          50 * time.Millisecond,
+			IndirectProbes:        2,
+			SuspicionTimeout:      300 * time.Millisecond,
+			MaxPiggybackedUpdates: 8,
+			RetransmitMultiplier:  3,
+		}
+		newNode := func(identity, port string) *ZmqMultiGcounter {
+			c := NewZmqMultiGcounter(identity, t.TempDir(), "tcp://:"+port)
+			c.SetMyIP("127.0.0.1")
+			c.EnableGossip(config)
+			assert.NoError(t, c.Start())
+			return c
+		}
+		seedPort := randomPort()
+		seed := zmqAddressOf("127.0.0.1", seedPort)
+		a := newNode("a", seedPort)
+		defer a.Stop()
+		b := newNode("b", randomPort())
+		defer b.Stop()
+		c := newNode("c", randomPort())
+		b.UpdatePeers([]string{seed})
+		c.UpdatePeers([]string{seed})
+
+		// b and c only know the seed but learn about each other
+		waitForMemberStateOf(t, MemberAlive, b, "c")
+		waitForMemberStateOf(t, MemberAlive, c, "b")
+		waitForMemberStateOf(t, MemberAlive, a, "c")
+
+		c.Increment("x")
+		waitForMultiGcounterValueOf(t, 1, b, "x")
+
+		c.Stop()
+		waitForMemberStateOf(t, MemberDead, a, "c")
+		waitForMemberStateOf(t, MemberDead, b, "c")
+		// a slow ack under load may get b suspected until it refutes
+		waitForMemberStateOf(t, MemberAlive, a, "b")
+	})
+}
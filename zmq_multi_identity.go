@@ -0,0 +1,91 @@
+package percounter
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+const DefaultIdentityCheckTimeout = 1 * time.Second
+
+func (z *ZmqMultiGcounter) SetIdentityCollisionObserver(o IdentityCollisionObserver) {
+	phony.Block(z, func() {
+		z.identityObserver = o
+	})
+}
+
+// IdentityCollision is the first detected identity collision, if any
+func (z *ZmqMultiGcounter) IdentityCollision() error {
+	var res error
+	phony.Block(z, func() {
+		if z.identityCollision != nil {
+			res = z.identityCollision
+		}
+	})
+	return res
+}
+
+// VerifyIdentity greets the peers for the timeout, stopping the node if another one uses the same identity
+func (z *ZmqMultiGcounter) VerifyIdentity(timeout time.Duration) error {
+	phony.Block(z, func() {
+		z.broadcastOhaiSync()
+	})
+	time.Sleep(timeout)
+	if err := z.IdentityCollision(); err != nil {
+		z.Stop()
+		return err
+	}
+	return nil
+}
+
+// checkIdentity detects messages of other processes with the same identity, legacy nodes are checked in the handshake
+func (z *ZmqMultiGcounter) checkIdentity(msg *NetworkedGCounterState) {
+	if msg.SourcePeer != z.identity {
+		return
+	}
+	instance, err := tryGetPeerMetadataString(msg, InstanceKey)
+	isHandshake := msg.Type == PeerOhaiNetworkMessage || msg.Type == PeerHelloNetworkMessage
+	z.Act(z, func() {
+		switch {
+		case err == nil && instance != "" && instance != z.instance:
+			z.reportIdentityCollisionSync(peerAddressOf(msg), fmt.Sprintf("received a message of instance %s", instance))
+		case (err != nil || instance == "") && isHandshake:
+			z.reportIdentityCollisionSync(peerAddressOf(msg), "received a greeting of a node not telling its instance")
+		}
+	})
+}
+
+// recordOwnCountSync tracks the counts produced by this node
+func (z *ZmqMultiGcounter) recordOwnCountSync(typeTag, name string, snapshot CRDT) {
+	counter, ok := snapshot.(*gcounterCRDT)
+	if typeTag != GCounterCRDTType.Tag || !ok {
+		return
+	}
+	z.ownCounts[name] = max(z.ownCounts[name], counter.GetState().Peers[z.identity])
+}
+
+// checkOwnCountSync detects foreign increments in the own slot, skipping counters not incremented since the start
+func (z *ZmqMultiGcounter) checkOwnCountSync(crdtType CRDTType, name string, other CRDT) {
+	counter, ok := other.(*gcounterCRDT)
+	if crdtType.Tag != GCounterCRDTType.Tag || !ok {
+		return
+	}
+	own, produced := z.ownCounts[name]
+	if remote := counter.GetState().Peers[z.identity]; produced && remote > own {
+		z.reportIdentityCollisionSync("", fmt.Sprintf("counter '%s' has %d increments of this identity, only %d were produced", name, remote, own))
+	}
+}
+
+func (z *ZmqMultiGcounter) reportIdentityCollisionSync(address, reason string) {
+	err := &IdentityCollisionError{Identity: z.identity, Address: address, Reason: reason}
+	if z.identityCollision != nil && z.identityCollision.Error() == err.Error() {
+		return
+	}
+	log.Printf("%s: %v", z.identity, err)
+	if z.identityCollision == nil {
+		z.identityCollision = err
+	}
+	z.identityObserver.OnIdentityCollision(err)
+}
@@ -0,0 +1,108 @@
+package percounter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Arceliar/phony"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZmqMultiGcounterIdentityCollision(t *testing.T) {
+	newNode := func(t *testing.T, identity, port string) (*ZmqMultiGcounter, *testIdentityCollisionObserver) {
+		c := NewZmqMultiGcounter(identity, t.TempDir(), "tcp://:"+port)
+		c.SetMyIP("127.0.0.1")
+		observer := &testIdentityCollisionObserver{}
+		c.SetIdentityCollisionObserver(observer)
+		require.NoError(t, c.Start())
+		t.Cleanup(c.Stop)
+		return c, observer
+	}
+
+	t.Run("nodes with the same identity detect each other and refuse to start", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1, observer1 := newNode(t, "1", port1)
+		c2, observer2 := newNode(t, "1", port2)
+		c2.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port1)})
+
+		err := c2.VerifyIdentity(500 * time.Millisecond)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrIdentityCollision)
+		var collision *IdentityCollisionError
+		require.ErrorAs(t, err, &collision)
+		assert.Equal(t, "1", collision.Identity)
+		assert.Equal(t, zmqAddressOf("127.0.0.1", port1), collision.Address)
+		assert.NotEmpty(t, observer2.Seen())
+
+		// the greeted node detects the collision as well
+		assert.ErrorIs(t, c1.IdentityCollision(), ErrIdentityCollision)
+		assert.NotEmpty(t, observer1.Seen())
+
+		assert.ErrorIs(t, c2.Start(), ErrIdentityCollision)
+	})
+
+	t.Run("distinct identities pass the verification", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		_, observer1 := newNode(t, "1", port1)
+		c2, observer2 := newNode(t, "2", port2)
+		c2.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port1)})
+
+		assert.NoError(t, c2.VerifyIdentity(300*time.Millisecond))
+		assert.Empty(t, observer1.Seen())
+		assert.Empty(t, observer2.Seen())
+	})
+
+	t.Run("nodes configured as their own peer are no collision", func(t *testing.T) {
+		port := randomPort()
+		c, observer := newNode(t, "1", port)
+		c.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port)})
+		c.Increment("x")
+
+		assert.NoError(t, c.VerifyIdentity(300*time.Millisecond))
+		assert.Empty(t, observer.Seen())
+	})
+
+	t.Run("increments in the own slot not produced by the node are detected", func(t *testing.T) {
+		c, observer := newNode(t, "1", randomPort())
+		c.Increment("x")
+		c.Increment("x")
+		waitForMultiGcounterValueOf(t, 2, c, "x")
+
+		// an echo of the own state
+		c.MergeWith(NewGCounterFromState("", GCounterState{Name: "x", Peers: map[string]int64{"1": 2, "2": 1}}))
+		waitForMultiGcounterValueOf(t, 3, c, "x")
+		phony.Block(c, func() {})
+		assert.NoError(t, c.IdentityCollision())
+
+		c.MergeWith(NewGCounterFromState("", GCounterState{Name: "x", Peers: map[string]int64{"1": 5}}))
+		waitForIdentityCollisionOf(t, c)
+		// persisted before the test directory is removed
+		waitForMultiGcounterValueOf(t, 6, c, "x")
+		assert.Len(t, observer.Seen(), 1)
+		assert.Contains(t, observer.Seen()[0].Reason, "counter 'x' has 5 increments of this identity, only 2 were produced")
+	})
+
+	t.Run("a lost state is recovered from the peers without a collision", func(t *testing.T) {
+		c, observer := newNode(t, "1", randomPort())
+		c.MergeWith(NewGCounterFromState("", GCounterState{Name: "x", Peers: map[string]int64{"1": 5}}))
+		waitForMultiGcounterValueOf(t, 5, c, "x")
+		c.Increment("x")
+		waitForMultiGcounterValueOf(t, 6, c, "x")
+
+		c.MergeWith(NewGCounterFromState("", GCounterState{Name: "x", Peers: map[string]int64{"1": 6}}))
+		// the merge is checked in the actor
+		phony.Block(c, func() {})
+		assert.NoError(t, c.IdentityCollision())
+		assert.Empty(t, observer.Seen())
+		assert.Equal(t, int64(6), c.Value("x"))
+	})
+}
+
+func waitForIdentityCollisionOf(t *testing.T, c *ZmqMultiGcounter) {
+	waitFor(t, func() bool { return c.IdentityCollision() != nil })
+	assert.True(t, errors.Is(c.IdentityCollision(), ErrIdentityCollision))
+}
@@ -0,0 +1,26 @@
+package percounter
+
+import (
+	"github.com/Arceliar/phony"
+)
+
+func (z *ZmqMultiGcounter) SetValueObserver(o ValueObserver) {
+	phony.Block(z, func() {
+		z.valueObserver = o
+	})
+}
+
+func (z *ZmqMultiGcounter) SetRegister(name, value string) {
+	z.Act(z, func() {
+		register := newPersistentLWWRegisterOf(z.getOrCreateReplicaSync(LWWRegisterCRDTType, name))
+		register.SetFromActor(z, value)
+	})
+}
+
+func (z *ZmqMultiGcounter) RegisterValue(name string) string {
+	return z.GetLWWRegister(name).Value()
+}
+
+func (z *ZmqMultiGcounter) GetLWWRegister(name string) *PersistentLWWRegister {
+	return newPersistentLWWRegisterOf(z.getReplica(LWWRegisterCRDTType, name))
+}
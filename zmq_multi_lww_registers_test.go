@@ -0,0 +1,54 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterLWWRegisters(t *testing.T) {
+	t.Run("exchanging register values", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		defer c1.Stop()
+		assert.NoError(t, c1.Start())
+		c1.SetRegister(name1, "initial")
+
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		defer c2.Stop()
+		assert.NoError(t, c2.Start())
+
+		c1.UpdatePeers([]string{"tcp://localhost:" + port2})
+		c2.UpdatePeers([]string{"tcp://localhost:" + port1})
+		waitForRegisterValueOf(t, "initial", c2, name1)
+
+		c2.SetRegister(name1, "updated")
+		waitForRegisterValueOf(t, "updated", c1, name1)
+
+		c1.PersistSync()
+		c2.PersistSync()
+	})
+
+	t.Run("eagerly loading registers", func(t *testing.T) {
+		tempDir := t.TempDir()
+		{
+			c1 := NewZmqMultiGcounter("1", tempDir, "tcp://:"+randomPort())
+			c1.SetRegister(name1, "a")
+			waitForRegisterValueOf(t, "a", c1, name1)
+			c1.PersistSync()
+		}
+
+		testObserver := &testValueObserver{}
+		c1 := NewZmqMultiGcounter("1", tempDir, "tcp://:"+randomPort())
+		c1.SetValueObserver(testObserver)
+		assert.NoError(t, c1.LoadAllSync())
+		assert.Len(t, replicasOfType(c1, LWWRegisterNetworkMessage), 1)
+		assert.Equal(t, []ValueEvent{{name1, "a"}}, testObserver.Seen())
+	})
+}
+
+func waitForRegisterValueOf(t *testing.T, expectedValue string, c *ZmqMultiGcounter, name string) {
+	waitFor(t, func() bool { return expectedValue == c.RegisterValue(name) })
+	assert.Equal(t, expectedValue, c.RegisterValue(name))
+}
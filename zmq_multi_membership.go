@@ -0,0 +1,79 @@
+package percounter
+
+import (
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+// SetMembershipConfig should be called before Start for the heartbeat interval to take effect
+func (z *ZmqMultiGcounter) SetMembershipConfig(config MembershipConfig) {
+	z.membership.SetConfig(config)
+}
+
+func (z *ZmqMultiGcounter) AddMembershipObserver(o MembershipObserver) {
+	z.membership.AddObserver(o)
+}
+
+// Members are the peers this node has heard from, with their liveness
+func (z *ZmqMultiGcounter) Members() []Member {
+	return z.membership.Members()
+}
+
+func (z *ZmqMultiGcounter) startHeartbeats() {
+	interval := z.membership.Config().HeartbeatInterval
+	if interval <= 0 {
+		return
+	}
+	phony.Block(z, func() {
+		if z.heartbeatStop != nil {
+			// already started
+			return
+		}
+		z.heartbeatStop = make(chan struct{})
+		go z.heartbeatLoop(interval, z.heartbeatStop)
+	})
+}
+
+func (z *ZmqMultiGcounter) stopHeartbeats() {
+	phony.Block(z, func() {
+		if z.heartbeatStop == nil {
+			return
+		}
+		close(z.heartbeatStop)
+		z.heartbeatStop = nil
+	})
+}
+
+func (z *ZmqMultiGcounter) heartbeatLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			z.Act(z, func() {
+				z.broadcastOhaiSync()
+			})
+			z.membership.Tick()
+		}
+	}
+}
+
+func (z *ZmqMultiGcounter) recordSignOfLife(identity []byte, msg *NetworkedGCounterState) {
+	peer := msg.SourcePeer
+	if peer == "" {
+		peer = string(identity)
+	}
+	if peer == z.identity {
+		return
+	}
+	address := ""
+	peerIp, ipErr := tryGetPeerIp(msg)
+	peerPort, portErr := tryGetPeerTcpPort(msg)
+	if ipErr == nil && portErr == nil && peerIp != "" && peerPort != "" {
+		address = zmqAddressOf(peerIp, peerPort)
+	}
+	z.membership.Seen(peer, address)
+}
@@ -0,0 +1,61 @@
+package percounter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterMembership(t *testing.T) {
+	t.Run("detecting live and failed peers via heartbeats", func(t *testing.T) {
+		config := MembershipConfig{
+			HeartbeatInterval: 50 * time.Millisecond,
+			SuspectTimeout:    300 * time.Millisecond,
+			DeadTimeout:       600 * time.Millisecond,
+		}
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		c1.SetMembershipConfig(config)
+		observer := &testMembershipObserver{}
+		c1.AddMembershipObserver(observer)
+		defer c1.Stop()
+		assert.NoError(t, c1.Start())
+		assert.Empty(t, c1.Members())
+
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		c2.SetMembershipConfig(config)
+		assert.NoError(t, c2.Start())
+		c1.UpdatePeers([]string{"tcp://localhost:" + port2})
+		c2.UpdatePeers([]string{"tcp://localhost:" + port1})
+
+		waitForMemberStateOf(t, MemberAlive, c1, "2")
+		waitForMemberStateOf(t, MemberAlive, c2, "1")
+		// heartbeats keep the member alive
+		time.Sleep(400 * time.Millisecond)
+		waitForMemberStateOf(t, MemberAlive, c1, "2")
+
+		c2.Stop()
+		waitForMemberStateOf(t, MemberSuspect, c1, "2")
+		waitForMemberStateOf(t, MemberDead, c1, "2")
+
+		changes := observer.Seen()
+		assert.Len(t, changes, 3)
+		assert.Equal(t, MemberDead, changes[len(changes)-1].Member.State)
+	})
+}
+
+func memberStateOf(c *ZmqMultiGcounter, identity string) MemberState {
+	for _, m := range c.Members() {
+		if m.Identity == identity {
+			return m.State
+		}
+	}
+	return ""
+}
+
+func waitForMemberStateOf(t *testing.T, expectedState MemberState, c *ZmqMultiGcounter, identity string) {
+	waitFor(t, func() bool { return expectedState == memberStateOf(c, identity) })
+	assert.Equal(t, expectedState, memberStateOf(c, identity))
+}
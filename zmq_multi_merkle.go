@@ -0,0 +1,73 @@
+package percounter
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"slices"
+
+	"github.com/Arceliar/phony"
+)
+
+// UseMerkleSync reconciles the replicas with new peers and in anti-entropy rounds via Merkle trees
+func (z *ZmqMultiGcounter) UseMerkleSync() {
+	phony.Block(z, func() {
+		z.merkleSync = true
+	})
+}
+
+// merkleTreeSync is rebuilt once per round, when the roots are exchanged
+func (z *ZmqMultiGcounter) merkleTreeSync(newRound bool) *MerkleTree {
+	if newRound || z.merkleTree == nil {
+		z.merkleTree = NewMerkleTree(z.digestSync())
+	}
+	return z.merkleTree
+}
+
+func (z *ZmqMultiGcounter) sendMerkleNodesSync(peer string, nodes map[string]string) {
+	data, err := json.Marshal(nodes)
+	if err != nil {
+		log.Printf("%s: error serializing merkle nodes: %v", z.identity, err)
+		return
+	}
+	z.sendSync(peer, &NetworkedGCounterState{
+		Type:       MerkleSyncMessage,
+		SourcePeer: z.identity,
+		Metadata:   z.myConnectionInfoSync(),
+		State:      data,
+	})
+}
+
+// onMerkleNodes descends into the differing subtrees, the replicas of differing leaves are compared via digests
+func (z *ZmqMultiGcounter) onMerkleNodes(msg *NetworkedGCounterState) {
+	remote := map[string]string{}
+	if err := json.Unmarshal(msg.State, &remote); err != nil {
+		log.Printf("%s: malformed merkle nodes from %s: %v", z.identity, msg.SourcePeer, err)
+		return
+	}
+	peer := peerAddressOf(msg)
+	if peer == "" {
+		log.Printf("%s: merkle sync from %s: no address to respond to", z.identity, msg.SourcePeer)
+		return
+	}
+	z.Act(z, func() {
+		_, newRound := remote[""]
+		tree := z.merkleTreeSync(newRound)
+		children := map[string]string{}
+		leaves := []string{}
+		for _, prefix := range tree.Diff(remote) {
+			if tree.IsLeaf(prefix) {
+				leaves = append(leaves, prefix)
+				continue
+			}
+			maps.Copy(children, tree.Children(prefix))
+		}
+		if len(children) > 0 {
+			z.sendMerkleNodesSync(peer, children)
+		}
+		if len(leaves) > 0 {
+			slices.Sort(leaves)
+			z.sendDigestSync(peer, false, leaves)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package percounter
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Arceliar/phony"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterMerkleSync(t *testing.T) {
+	t.Run("only divergent counters are exchanged with a new peer", func(t *testing.T) {
+		const counters = 300
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		observer := newTestClusterObserver()
+		c2.SetClusterObserver(observer)
+		for _, c := range []*ZmqMultiGcounter{c1, c2} {
+			c.SetMyIP("127.0.0.1")
+			c.UseMerkleSync()
+			// the same history on both nodes
+			for i := range counters {
+				counter := NewPersistentGCounter("0", c.multiFilenameFor(fmt.Sprintf("counter-%d", i), GCounterCRDTType.Extension))
+				counter.Increment()
+				counter.PersistSync()
+			}
+		}
+		divergent := NewPersistentGCounter("1", c1.multiFilenameFor("counter-7", GCounterCRDTType.Extension))
+		divergent.Increment()
+		divergent.PersistSync()
+		onlyOnC1 := NewPersistentGCounter("1", c1.multiFilenameFor("new", GCounterCRDTType.Extension))
+		onlyOnC1.Increment()
+		onlyOnC1.PersistSync()
+		for _, c := range []*ZmqMultiGcounter{c1, c2} {
+			assert.NoError(t, c.LoadAllSync())
+			assert.NoError(t, c.Start())
+			defer c.Stop()
+		}
+
+		c2.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port1)})
+		waitForMultiGcounterValueOf(t, 2, c2, "counter-7")
+		waitForMultiGcounterValueOf(t, 1, c2, "new")
+		waitForEqualDigests(t, c1, c2)
+
+		time.Sleep(200 * time.Millisecond)
+		// both sides of the connection may start a sync concurrently
+		received := counterStatesReceived(observer)
+		slices.Sort(received)
+		assert.Equal(t, []string{"counter-7", "new"}, slices.Compact(received))
+	})
+
+	t.Run("the tree is built once per round", func(t *testing.T) {
+		c := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+randomPort())
+		c.Increment("x")
+		waitForMultiGcounterValueOf(t, 1, c, "x")
+		phony.Block(c, func() {
+			tree := c.merkleTreeSync(true)
+			assert.Same(t, tree, c.merkleTreeSync(false))
+			assert.NotSame(t, tree, c.merkleTreeSync(true))
+		})
+		c.PersistSync()
+	})
+}
+
+func counterStatesReceived(o *testClusterObserver) []string {
+	res := []string{}
+	for _, m := range o.MessagesReceived() {
+		msg := NetworkedGCounterState{}
+		if json.Unmarshal([]byte(m.msg), &msg) == nil && msg.Type == GCounterNetworkMessage {
+			res = append(res, msg.Name)
+		}
+	}
+	return res
+}
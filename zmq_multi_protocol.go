@@ -0,0 +1,93 @@
+package percounter
+
+import (
+	"maps"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+const DefaultHandshakeTimeout = 1 * time.Second
+
+// PeerProtocols are the protocol versions and capabilities of the peers by address,
+// as learned from their connection metadata
+func (z *ZmqMultiGcounter) PeerProtocols() map[string]PeerProtocol {
+	var res map[string]PeerProtocol
+	phony.Block(z, func() {
+		res = maps.Clone(z.peerProtocols)
+	})
+	return res
+}
+
+func (z *ZmqMultiGcounter) capabilitiesSync() []string {
+	res := []string{BatchCapability, AntiEntropyCapability, MerkleSyncCapability, RetirementCapability}
+	if z.compression != nil {
+		res = append(res, GzipCapability)
+	}
+	if z.binaryWireFormat {
+		res = append(res, BinaryWireCapability)
+	}
+	return res
+}
+
+func (z *ZmqMultiGcounter) supportsSync(peer, capability string) bool {
+	return z.peerProtocols[peer].Supports(capability)
+}
+
+func (z *ZmqMultiGcounter) peersBySupportSync(capability string) (supporting, others []string) {
+	for _, peer := range z.peers {
+		if z.supportsSync(peer, capability) {
+			supporting = append(supporting, peer)
+		} else {
+			others = append(others, peer)
+		}
+	}
+	return supporting, others
+}
+
+func (z *ZmqMultiGcounter) recordPeerProtocol(msg *NetworkedGCounterState) {
+	address := peerAddressOf(msg)
+	if address == "" {
+		return
+	}
+	protocol := peerProtocolOf(msg)
+	z.Act(z, func() {
+		z.peerProtocols[address] = protocol
+		if _, pending := z.pendingInitialSync[address]; pending {
+			delete(z.pendingInitialSync, address)
+			z.initialSyncSync(address)
+		}
+	})
+}
+
+// onPeerConnectedSync brings a new peer up to date. With Merkle sync, the handshake is awaited
+// to learn whether the peer supports it, peers not completing it get the full state
+func (z *ZmqMultiGcounter) onPeerConnectedSync(peer string) {
+	if !z.merkleSync || z.cluster.MyIP() == "" {
+		z.sendMyStateToPeer(peer)
+		return
+	}
+	if _, known := z.peerProtocols[peer]; known {
+		z.initialSyncSync(peer)
+		return
+	}
+	z.pendingInitialSync[peer] = true
+	z.sendOhaiToPeerSync(peer)
+	time.AfterFunc(z.handshakeTimeout, func() {
+		z.Act(z, func() {
+			if _, pending := z.pendingInitialSync[peer]; !pending {
+				return
+			}
+			delete(z.pendingInitialSync, peer)
+			z.sendMyStateToPeer(peer)
+		})
+	})
+}
+
+func (z *ZmqMultiGcounter) initialSyncSync(peer string) {
+	if z.supportsSync(peer, MerkleSyncCapability) {
+		z.startSyncSync(peer)
+		return
+	}
+	z.sendMyStateToPeer(peer)
+}
@@ -0,0 +1,173 @@
+package percounter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Arceliar/phony"
+	"github.com/d-led/zmqcluster"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZmqMultiGcounterProtocolNegotiation(t *testing.T) {
+	newModernNode := func(t *testing.T, identity, port string) *ZmqMultiGcounter {
+		c := NewZmqMultiGcounter(identity, t.TempDir(), "tcp://:"+port)
+		c.SetMyIP("127.0.0.1")
+		c.EnableCompression(CompressionConfig{Threshold: 1, Level: DefaultCompressionConfig().Level})
+		c.EnableBinaryWireFormat()
+		c.EnableBatching(BatchConfig{FlushInterval: 10 * time.Millisecond, MaxBatchSize: 100})
+		c.UseMerkleSync()
+		require.NoError(t, c.Start())
+		return c
+	}
+
+	t.Run("modern peers learn each other's capabilities", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := newModernNode(t, "1", port1)
+		defer c1.Stop()
+		c2 := newModernNode(t, "2", port2)
+		defer c2.Stop()
+		c1.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port2)})
+
+		waitForPeerProtocolOf(t, c1, zmqAddressOf("127.0.0.1", port2))
+		protocol := c1.PeerProtocols()[zmqAddressOf("127.0.0.1", port2)]
+		assert.Equal(t, ProtocolVersion, protocol.Version)
+		for _, capability := range []string{BatchCapability, AntiEntropyCapability, MerkleSyncCapability, RetirementCapability, GzipCapability, BinaryWireCapability} {
+			assert.True(t, protocol.Supports(capability), capability)
+		}
+
+		c1.Increment("x")
+		waitForMultiGcounterValueOf(t, 1, c2, "x")
+	})
+
+	t.Run("legacy peers get plain JSON state messages", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := newModernNode(t, "1", port1)
+		defer c1.Stop()
+		c1.Increment("before")
+		legacy := startLegacyPeer(t, "2", port2, true)
+		defer legacy.Stop()
+		c1.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port2)})
+
+		waitForPeerProtocolOf(t, c1, zmqAddressOf("127.0.0.1", port2))
+		assert.Equal(t, legacyProtocolVersion, c1.PeerProtocols()[zmqAddressOf("127.0.0.1", port2)].Version)
+		waitForLegacyCounterValueOf(t, 1, legacy, "before")
+
+		c1.Increment("after")
+		c1.Increment("after")
+		waitForLegacyCounterValueOf(t, 2, legacy, "after")
+		assert.Equal(t, 0, legacy.Undecodable())
+	})
+
+	t.Run("peers not completing the handshake get the full state", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := newModernNode(t, "1", port1)
+		defer c1.Stop()
+		phony.Block(c1, func() {
+			c1.handshakeTimeout = 100 * time.Millisecond
+		})
+		c1.Increment("before")
+		legacy := startLegacyPeer(t, "2", port2, false)
+		defer legacy.Stop()
+		c1.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port2)})
+
+		waitForLegacyCounterValueOf(t, 1, legacy, "before")
+		assert.Equal(t, 0, legacy.Undecodable())
+	})
+}
+
+// legacyPeer speaks the original protocol: JSON only, no capabilities advertised
+type legacyPeer struct {
+	phony.Inbox
+	cluster     *zmqcluster.ZmqCluster
+	replyHello  bool
+	counters    map[string]int64
+	undecodable int
+}
+
+func startLegacyPeer(t *testing.T, identity, port string, replyHello bool) *legacyPeer {
+	p := &legacyPeer{
+		cluster:    zmqcluster.NewZmqCluster(identity, "tcp://:"+port),
+		replyHello: replyHello,
+		counters:   map[string]int64{},
+	}
+	p.cluster.SetMyIP("127.0.0.1")
+	p.cluster.AddListenerSync(p)
+	require.NoError(t, p.cluster.Start())
+	return p
+}
+
+func (p *legacyPeer) Stop() {
+	p.cluster.Stop()
+}
+
+func (p *legacyPeer) OnMessage(identity []byte, message []byte) {
+	p.Act(p, func() {
+		msg := NetworkedGCounterState{}
+		if err := json.Unmarshal(message, &msg); err != nil {
+			p.undecodable++
+			return
+		}
+		switch msg.Type {
+		case PeerOhaiNetworkMessage:
+			if !p.replyHello {
+				return
+			}
+			ip, _ := tryGetPeerIp(&msg)
+			port, _ := tryGetPeerTcpPort(&msg)
+			hello, _ := json.Marshal(NetworkedGCounterState{
+				Type:       PeerHelloNetworkMessage,
+				SourcePeer: "legacy",
+				Metadata: map[string]interface{}{
+					MyIPKey:      p.cluster.MyIP(),
+					MyTcpPortKey: p.cluster.MyTcpPort(),
+				},
+			})
+			p.cluster.SendMessageToPeer(zmqAddressOf(ip, port), hello)
+		case GCounterNetworkMessage:
+			var value int64
+			for _, count := range msg.Peers {
+				value += count
+			}
+			p.counters[msg.Name] = max(p.counters[msg.Name], value)
+		}
+	})
+}
+
+func (p *legacyPeer) OnMessageSent(peer string, message []byte) {}
+
+func (p *legacyPeer) OnNewPeerConnected(c zmqcluster.Cluster, peer string) {}
+
+func (p *legacyPeer) CounterValue(name string) int64 {
+	var res int64
+	phony.Block(p, func() {
+		res = p.counters[name]
+	})
+	return res
+}
+
+func (p *legacyPeer) Undecodable() int {
+	var res int
+	phony.Block(p, func() {
+		res = p.undecodable
+	})
+	return res
+}
+
+func waitForLegacyCounterValueOf(t *testing.T, expectedValue int64, p *legacyPeer, name string) {
+	waitFor(t, func() bool { return p.CounterValue(name) == expectedValue })
+	assert.Equal(t, expectedValue, p.CounterValue(name))
+}
+
+func waitForPeerProtocolOf(t *testing.T, c *ZmqMultiGcounter, peer string) {
+	waitFor(t, func() bool {
+		_, known := c.PeerProtocols()[peer]
+		return known
+	})
+	assert.Contains(t, c.PeerProtocols(), peer)
+}
@@ -0,0 +1,31 @@
+package percounter
+
+func (z *ZmqMultiGcounter) ObserveMax(name string, value int64) {
+	z.Act(z, func() {
+		register := newPersistentRegisterOf(z.getOrCreateReplicaSync(MaxRegisterCRDTType, name))
+		register.ObserveFromActor(z, value)
+	})
+}
+
+func (z *ZmqMultiGcounter) MaxValue(name string) int64 {
+	return z.GetMaxRegister(name).Value()
+}
+
+func (z *ZmqMultiGcounter) GetMaxRegister(name string) *PersistentRegister {
+	return newPersistentRegisterOf(z.getReplica(MaxRegisterCRDTType, name))
+}
+
+func (z *ZmqMultiGcounter) ObserveMin(name string, value int64) {
+	z.Act(z, func() {
+		register := newPersistentRegisterOf(z.getOrCreateReplicaSync(MinRegisterCRDTType, name))
+		register.ObserveFromActor(z, value)
+	})
+}
+
+func (z *ZmqMultiGcounter) MinValue(name string) int64 {
+	return z.GetMinRegister(name).Value()
+}
+
+func (z *ZmqMultiGcounter) GetMinRegister(name string) *PersistentRegister {
+	return newPersistentRegisterOf(z.getReplica(MinRegisterCRDTType, name))
+}
@@ -0,0 +1,57 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterRegisters(t *testing.T) {
+	t.Run("exchanging register state changes", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		defer c1.Stop()
+		assert.NoError(t, c1.Start())
+		c1.ObserveMax(name1, 10)
+		c1.ObserveMin(name1, 10)
+
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		defer c2.Stop()
+		assert.NoError(t, c2.Start())
+
+		c1.UpdatePeers([]string{"tcp://localhost:" + port2})
+		c2.UpdatePeers([]string{"tcp://localhost:" + port1})
+		waitForGcounterValueOf(t, 10, c2.GetMaxRegister(name1))
+		waitForGcounterValueOf(t, 10, c2.GetMinRegister(name1))
+
+		c2.ObserveMax(name1, 20)
+		c2.ObserveMin(name1, 5)
+		// not a new high-water mark
+		c1.ObserveMax(name1, 15)
+		waitForGcounterValueOf(t, 20, c1.GetMaxRegister(name1))
+		waitForGcounterValueOf(t, 5, c1.GetMinRegister(name1))
+		assert.Equal(t, int64(20), c2.MaxValue(name1))
+		assert.Equal(t, int64(5), c2.MinValue(name1))
+
+		c1.PersistSync()
+		c2.PersistSync()
+	})
+
+	t.Run("eagerly loading registers", func(t *testing.T) {
+		tempDir := t.TempDir()
+		{
+			c1 := NewZmqMultiGcounter("1", tempDir, "tcp://:"+randomPort())
+			c1.ObserveMax(name1, 3)
+			c1.ObserveMin(name2, 3)
+			waitForGcounterValueOf(t, 3, c1.GetMinRegister(name2))
+			c1.PersistSync()
+		}
+
+		c1 := NewZmqMultiGcounter("1", tempDir, "tcp://:"+randomPort())
+		assert.NoError(t, c1.LoadAllSync())
+		assert.Len(t, replicasOfType(c1, MaxRegisterNetworkMessage), 1)
+		assert.Len(t, replicasOfType(c1, MinRegisterNetworkMessage), 1)
+		assert.Equal(t, int64(3), c1.MaxValue(name1))
+	})
+}
@@ -0,0 +1,381 @@
+package percounter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+const DefaultRetirementTimeout = 5 * time.Second
+
+var ErrRetirementNotAgreed = errors.New("retirement not agreed")
+
+type retirementRound struct {
+	participants []string
+	awaiting     map[string]bool
+	done         chan error
+}
+
+// retirementLease keeps a participant out of other rounds until the coordinator is done or the lease expires
+type retirementLease struct {
+	coordinator string
+	seq         uint64
+	expires     time.Time
+}
+
+// Retire folds the slots of dead or departed identities into the retired slot of all G-Counters once all peers agree.
+// One retirement is in flight at a time, the peers refuse the rounds of other coordinators meanwhile
+func (z *ZmqMultiGcounter) Retire(timeout time.Duration, identities ...string) error {
+	return z.retire(timeout, "", identities)
+}
+
+// Leave retires the own identity and stops the node. The stored identity is removed, see RemoveStoredIdentity
+func (z *ZmqMultiGcounter) Leave(timeout time.Duration) error {
+	err := z.retire(timeout, z.identity, []string{z.identity})
+	z.Stop()
+	if err != nil {
+		return err
+	}
+	return RemoveStoredIdentity(z.dirname, z.identity)
+}
+
+func (z *ZmqMultiGcounter) retire(timeout time.Duration, departing string, identities []string) error {
+	if len(identities) == 0 {
+		return errors.New("no identities to retire")
+	}
+	var round *retirementRound
+	var seq uint64
+	var err error
+	phony.Block(z, func() {
+		if err = z.checkRetirableSync(departing, identities); err != nil {
+			return
+		}
+		if err = z.checkNoRetirementInFlightSync(); err != nil {
+			return
+		}
+		var participants []string
+		if participants, err = z.retirementParticipantsSync(identities); err != nil {
+			return
+		}
+		z.retirementSeq++
+		seq = z.retirementSeq
+		round = &retirementRound{
+			participants: participants,
+			awaiting:     map[string]bool{},
+			done:         make(chan error, 1),
+		}
+		for _, peer := range participants {
+			round.awaiting[peer] = true
+		}
+		z.retirements[seq] = round
+		for _, peer := range participants {
+			z.sendRetirementMessageSync(peer, RetirementPrepareMessage, seq, map[string]interface{}{
+				RetiringKey:          identities,
+				RetirementTimeoutKey: timeout.Milliseconds(),
+			})
+		}
+		if len(participants) == 0 {
+			z.finishRetirementSync(seq, nil)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRetirementNotAgreed, err)
+	}
+
+	select {
+	case err = <-round.done:
+	case <-time.After(timeout):
+		phony.Block(z, func() {
+			if _, pending := z.retirements[seq]; !pending {
+				// agreed just in time
+				err = <-round.done
+				return
+			}
+			err = fmt.Errorf("%w: no answer from %v", ErrRetirementNotAgreed, slices.Sorted(maps.Keys(round.awaiting)))
+			z.finishRetirementSync(seq, err)
+		})
+	}
+	if err == nil {
+		z.commitRetirement(identities)
+	}
+	phony.Block(z, func() {
+		for _, peer := range round.participants {
+			z.sendRetirementMessageSync(peer, RetirementDoneMessage, seq, nil)
+		}
+	})
+	return err
+}
+
+// commitRetirement returns once the retired state is persisted and sent to the peers
+func (z *ZmqMultiGcounter) commitRetirement(identities []string) {
+	var replicas []*PersistentCRDT
+	phony.Block(z, func() {
+		if slices.Contains(identities, z.identity) {
+			z.identityRetired = fmt.Errorf("%w: '%s' left", ErrIdentityRetired, z.identity)
+		}
+		for key, replica := range z.inner {
+			if key.typeTag != GCounterCRDTType.Tag {
+				continue
+			}
+			replicas = append(replicas, replica)
+			replica.UpdateFromActor(z, func(c CRDT) bool {
+				return c.(*gcounterCRDT).Retire(identities...)
+			})
+		}
+	})
+	for _, replica := range replicas {
+		phony.Block(replica, func() {})
+	}
+	z.FlushBatch()
+}
+
+// IdentityRetired is not nil once the own identity is retired, the node refusing to count and stopping
+func (z *ZmqMultiGcounter) IdentityRetired() error {
+	var res error
+	phony.Block(z, func() {
+		res = z.identityRetired
+	})
+	return res
+}
+
+// checkRetiredByPeerSync stops the node once a peer retired its identity,
+// the own slot folded by the merge being sent to the peers before
+func (z *ZmqMultiGcounter) checkRetiredByPeerSync(replica *PersistentCRDT, other CRDT) {
+	counter, ok := other.(*gcounterCRDT)
+	if !ok || z.identityRetired != nil || !counter.state.Retired.folded(z.identity) {
+		return
+	}
+	z.identityRetired = fmt.Errorf("%w: '%s' in counter '%s'", ErrIdentityRetired, z.identity, replica.Name())
+	log.Printf("%s: stopping: %v", z.identity, z.identityRetired)
+	go func() {
+		phony.Block(replica, func() {})
+		phony.Block(z, func() {
+			for _, peer := range z.peers {
+				z.sendMyStateToPeer(peer)
+			}
+		})
+		z.Stop()
+	}()
+}
+
+func isFarBehind(replica *PersistentCRDT, other CRDT) bool {
+	counter, ok := other.(*gcounterCRDT)
+	if !ok {
+		return false
+	}
+	var res bool
+	replica.read(func(c CRDT) {
+		res = c.(*gcounterCRDT).farBehind(counter.state)
+	})
+	return res
+}
+
+// pullDroppedSlotsSync syncs with all peers after a replica too far behind dropped the slots unknown to a newer one,
+// for the live identities among them to be counted again
+func (z *ZmqMultiGcounter) pullDroppedSlotsSync(name string) {
+	log.Printf("%s: counter '%s' is too far behind the retirements, pulling the live slots from the peers", z.identity, name)
+	for _, peer := range z.peers {
+		z.startSyncSync(peer)
+	}
+}
+
+// checkIdentityNotRetired refuses to start counting in a slot already retired
+func (z *ZmqMultiGcounter) checkIdentityNotRetired() error {
+	var err error
+	phony.Block(z, func() {
+		for key, replica := range z.inner {
+			if key.typeTag != GCounterCRDTType.Tag {
+				continue
+			}
+			replica.read(func(c CRDT) {
+				if c.(*gcounterCRDT).GetState().Retired.folded(z.identity) {
+					err = fmt.Errorf("%w: '%s' in counter '%s'", ErrIdentityRetired, z.identity, key.name)
+				}
+			})
+		}
+	})
+	return err
+}
+
+func (z *ZmqMultiGcounter) retiredSync(identity string) bool {
+	var res bool
+	for key, replica := range z.inner {
+		if key.typeTag != GCounterCRDTType.Tag {
+			continue
+		}
+		replica.read(func(c CRDT) {
+			res = res || c.(*gcounterCRDT).GetState().Retired.folded(identity)
+		})
+	}
+	return res
+}
+
+// checkRetirableSync only retires the departing identity and members known to be dead,
+// i.e. not heard of despite heartbeats or declared dead via gossip
+func (z *ZmqMultiGcounter) checkRetirableSync(departing string, identities []string) error {
+	for _, identity := range identities {
+		if identity == departing {
+			continue
+		}
+		if identity == z.identity {
+			return fmt.Errorf("'%s' is the identity of this node", identity)
+		}
+		member, ok := z.membership.Member(identity)
+		if !ok {
+			return fmt.Errorf("'%s' is not a known member", identity)
+		}
+		if member.State != MemberDead {
+			return fmt.Errorf("'%s' is %s", identity, member.State)
+		}
+	}
+	return nil
+}
+
+// checkNoRetirementInFlightSync prevents concurrent rounds from retiring different identities in the same epoch
+func (z *ZmqMultiGcounter) checkNoRetirementInFlightSync() error {
+	if len(z.retirements) > 0 {
+		return errors.New("another retirement is in flight")
+	}
+	if lease := z.retirementLease; lease != nil && time.Now().Before(lease.expires) {
+		return fmt.Errorf("the retirement coordinated by %s is in flight", lease.coordinator)
+	}
+	return nil
+}
+
+// retirementParticipantsSync are the peers other than the retiring, already retired or dead ones, all of which have to agree
+func (z *ZmqMultiGcounter) retirementParticipantsSync(identities []string) ([]string, error) {
+	excluded := map[string]bool{}
+	for _, member := range z.membership.Members() {
+		if member.State == MemberDead || slices.Contains(identities, member.Identity) || z.retiredSync(member.Identity) {
+			excluded[member.Address] = true
+		}
+	}
+	res := []string{}
+	for _, peer := range z.peers {
+		if excluded[peer] {
+			continue
+		}
+		if !z.supportsSync(peer, RetirementCapability) {
+			return nil, fmt.Errorf("%s does not support retirement", peer)
+		}
+		res = append(res, peer)
+	}
+	return res, nil
+}
+
+// onRetirementPrepare sends the counters with slots of the retiring identities or retired slots back before agreeing,
+// for the coordinator to retire them in the epoch following the latest one of all peers
+func (z *ZmqMultiGcounter) onRetirementPrepare(msg *NetworkedGCounterState) {
+	z.Act(z, func() {
+		seq, err := tryGetPeerMetadataUint(msg, RetirementSeqKey)
+		address := peerAddressOf(msg)
+		identities := tryGetPeerMetadataStrings(msg, RetiringKey)
+		if err != nil || address == "" || identities == nil {
+			log.Printf("%s: malformed retirement request from %s", z.identity, msg.SourcePeer)
+			return
+		}
+		err = z.checkRetirableSync(msg.SourcePeer, identities)
+		if err == nil {
+			err = z.checkNoRetirementInFlightSync()
+		}
+		if err != nil {
+			log.Printf("%s: refusing the retirement requested by %s: %v", z.identity, msg.SourcePeer, err)
+			z.sendRetirementMessageSync(address, RetirementAckMessage, seq, map[string]interface{}{
+				RetirementRefusalKey: err.Error(),
+			})
+			return
+		}
+		timeout := DefaultRetirementTimeout
+		if ms, err := tryGetPeerMetadataUint(msg, RetirementTimeoutKey); err == nil {
+			timeout = time.Duration(ms) * time.Millisecond
+		}
+		z.retirementLease = &retirementLease{
+			coordinator: msg.SourcePeer,
+			seq:         seq,
+			// covering the commit following the agreement
+			expires: time.Now().Add(2 * timeout),
+		}
+		for key, replica := range z.inner {
+			if key.typeTag != GCounterCRDTType.Tag {
+				continue
+			}
+			var relevant bool
+			replica.read(func(c CRDT) {
+				state := c.(*gcounterCRDT).GetState()
+				relevant = state.Retired != nil
+				for _, identity := range identities {
+					_, ok := state.Peers[identity]
+					relevant = relevant || ok
+				}
+			})
+			if !relevant {
+				continue
+			}
+			if err := z.sendReplicaToPeerSync(address, key, replica); err != nil {
+				log.Printf("%s: error serializing state: %v", key.name, err)
+			}
+		}
+		// sent after the states, thus merged by the coordinator before the agreement
+		z.sendRetirementMessageSync(address, RetirementAckMessage, seq, nil)
+	})
+}
+
+func (z *ZmqMultiGcounter) onRetirementAck(msg *NetworkedGCounterState) {
+	z.Act(z, func() {
+		seq, err := tryGetPeerMetadataUint(msg, RetirementSeqKey)
+		if err != nil {
+			return
+		}
+		round, ok := z.retirements[seq]
+		if !ok {
+			return
+		}
+		if refusal, err := tryGetPeerMetadataString(msg, RetirementRefusalKey); err == nil && refusal != "" {
+			z.finishRetirementSync(seq, fmt.Errorf("%w: refused by %s: %s", ErrRetirementNotAgreed, msg.SourcePeer, refusal))
+			return
+		}
+		delete(round.awaiting, peerAddressOf(msg))
+		if len(round.awaiting) == 0 {
+			z.finishRetirementSync(seq, nil)
+		}
+	})
+}
+
+// onRetirementDone releases the lease once the coordinator committed or gave up
+func (z *ZmqMultiGcounter) onRetirementDone(msg *NetworkedGCounterState) {
+	z.Act(z, func() {
+		seq, err := tryGetPeerMetadataUint(msg, RetirementSeqKey)
+		lease := z.retirementLease
+		if err != nil || lease == nil || lease.coordinator != msg.SourcePeer || lease.seq != seq {
+			return
+		}
+		z.retirementLease = nil
+	})
+}
+
+func (z *ZmqMultiGcounter) finishRetirementSync(seq uint64, err error) {
+	round, ok := z.retirements[seq]
+	if !ok {
+		return
+	}
+	delete(z.retirements, seq)
+	round.done <- err
+}
+
+func (z *ZmqMultiGcounter) sendRetirementMessageSync(address, messageType string, seq uint64, extra map[string]interface{}) {
+	metadata := z.myConnectionInfoSync()
+	metadata[RetirementSeqKey] = seq
+	for k, v := range extra {
+		metadata[k] = v
+	}
+	z.sendSync(address, &NetworkedGCounterState{
+		Type:       messageType,
+		SourcePeer: z.identity,
+		Metadata:   metadata,
+	})
+}
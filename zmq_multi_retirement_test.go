@@ -0,0 +1,310 @@
+package percounter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Arceliar/phony"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZmqMultiGcounterRetirement(t *testing.T) {
+	config := MembershipConfig{
+		HeartbeatInterval: 50 * time.Millisecond,
+		SuspectTimeout:    300 * time.Millisecond,
+		DeadTimeout:       600 * time.Millisecond,
+	}
+	// startCluster connects all nodes with each other, each having incremented x once
+	startCluster := func(t *testing.T, identities ...string) ([]*ZmqMultiGcounter, []string) {
+		var nodes []*ZmqMultiGcounter
+		var addresses []string
+		for _, identity := range identities {
+			port := randomPort()
+			c := NewZmqMultiGcounter(identity, t.TempDir(), "tcp://:"+port)
+			c.SetMyIP("127.0.0.1")
+			c.SetMembershipConfig(config)
+			require.NoError(t, c.Start())
+			nodes = append(nodes, c)
+			addresses = append(addresses, zmqAddressOf("127.0.0.1", port))
+		}
+		for i, c := range nodes {
+			var peers []string
+			for j, address := range addresses {
+				if i != j {
+					peers = append(peers, address)
+				}
+			}
+			c.UpdatePeers(peers)
+		}
+		for i, c := range nodes {
+			for j, address := range addresses {
+				if i != j {
+					waitForPeerProtocolOf(t, c, address)
+				}
+			}
+			c.Increment("x")
+		}
+		for _, c := range nodes {
+			waitForMultiGcounterValueOf(t, int64(len(nodes)), c, "x")
+		}
+		return nodes, addresses
+	}
+
+	t.Run("a departing node is folded into the retired slot", func(t *testing.T) {
+		nodes, _ := startCluster(t, "1", "2", "3")
+		defer nodes[0].Stop()
+		defer nodes[1].Stop()
+
+		require.NoError(t, nodes[2].Leave(2*time.Second))
+		for _, c := range nodes[:2] {
+			waitForPeersOf(t, []string{"1", "2"}, c, "x")
+			assert.Equal(t, int64(3), c.Value("x"))
+			assert.Equal(t, int64(1), c.GetCounter("x").GetState().Retired.Total())
+		}
+
+		nodes[0].Increment("x")
+		waitForMultiGcounterValueOf(t, 4, nodes[1], "x")
+		nodes[1].PersistSync()
+		state, err := ReadGCounterFile(filepath.Join(nodes[1].dirname, "x.gcounter"))
+		require.NoError(t, err)
+		assert.Equal(t, &RetiredSlot{Epoch: 1, Base: 0, Epochs: []RetiredEpoch{{Epoch: 1, Folded: map[string]int64{"3": 1}}}}, state.Retired)
+	})
+
+	t.Run("dead nodes are retired once the others agree", func(t *testing.T) {
+		nodes, _ := startCluster(t, "1", "2", "3")
+		defer nodes[0].Stop()
+		defer nodes[1].Stop()
+
+		err := nodes[0].Retire(time.Second, "3")
+		assert.ErrorIs(t, err, ErrRetirementNotAgreed)
+		assert.ErrorContains(t, err, "'3' is alive")
+		err = nodes[0].Retire(time.Second, "never-seen")
+		assert.ErrorIs(t, err, ErrRetirementNotAgreed)
+		assert.ErrorContains(t, err, "'never-seen' is not a known member")
+
+		nodes[2].Stop()
+		waitForMemberStateOf(t, MemberDead, nodes[0], "3")
+		waitForMemberStateOf(t, MemberDead, nodes[1], "3")
+		require.NoError(t, nodes[0].Retire(time.Second, "3"))
+		for _, c := range nodes[:2] {
+			waitForPeersOf(t, []string{"1", "2"}, c, "x")
+			assert.Equal(t, int64(3), c.Value("x"))
+		}
+	})
+
+	t.Run("the retirement is refused by peers still seeing the node alive", func(t *testing.T) {
+		nodes, addresses := startCluster(t, "1", "2")
+		defer nodes[0].Stop()
+		defer nodes[1].Stop()
+		// only known to the second node
+		port := randomPort()
+		c3 := NewZmqMultiGcounter("3", t.TempDir(), "tcp://:"+port)
+		c3.SetMyIP("127.0.0.1")
+		c3.SetMembershipConfig(config)
+		require.NoError(t, c3.Start())
+		defer c3.Stop()
+		c3.UpdatePeers([]string{addresses[1]})
+		nodes[1].UpdatePeers([]string{addresses[0], zmqAddressOf("127.0.0.1", port)})
+		waitForMemberStateOf(t, MemberAlive, nodes[1], "3")
+		declareDead(nodes[0], "3")
+
+		err := nodes[0].Retire(time.Second, "3")
+		assert.ErrorIs(t, err, ErrRetirementNotAgreed)
+		assert.ErrorContains(t, err, "refused by 2")
+	})
+
+	t.Run("peers not answering prevent the retirement", func(t *testing.T) {
+		nodes, _ := startCluster(t, "1", "2")
+		defer nodes[0].Stop()
+		// not yet known to be dead
+		nodes[1].Stop()
+		declareDead(nodes[0], "gone")
+
+		err := nodes[0].Retire(200*time.Millisecond, "gone")
+		assert.ErrorIs(t, err, ErrRetirementNotAgreed)
+		assert.ErrorContains(t, err, "no answer")
+		assert.Nil(t, nodes[0].GetCounter("x").GetState().Retired)
+	})
+
+	t.Run("chained retirements preserve the total", func(t *testing.T) {
+		nodes, _ := startCluster(t, "1", "2", "3", "4")
+		defer nodes[0].Stop()
+		defer nodes[1].Stop()
+
+		require.NoError(t, nodes[3].Leave(2*time.Second))
+		waitForPeersOf(t, []string{"1", "2", "3"}, nodes[2], "x")
+		nodes[2].Increment("x")
+		waitForMultiGcounterValueOf(t, 5, nodes[0], "x")
+		require.NoError(t, nodes[2].Leave(2*time.Second))
+		nodes[1].Increment("x")
+
+		for _, c := range nodes[:2] {
+			waitForPeersOf(t, []string{"1", "2"}, c, "x")
+			waitForMultiGcounterValueOf(t, 6, c, "x")
+			retired := c.GetCounter("x").GetState().Retired
+			assert.Equal(t, uint64(2), retired.Epoch)
+			assert.Equal(t, int64(3), retired.Total())
+		}
+	})
+
+	t.Run("replicas too far behind pull the live slots again", func(t *testing.T) {
+		nodes, _ := startCluster(t, "1", "2", "3")
+		for _, c := range nodes {
+			defer c.Stop()
+		}
+		// a newer replica not having heard of the third node yet
+		state := GCounterState{Name: "x", Peers: map[string]int64{"1": 1, "2": 1}}
+		for i := range retiredEpochWindow + 2 {
+			state.Peers[fmt.Sprint("gone-", i)] = 1
+		}
+		newer := NewGCounterFromState("", state)
+		for i := range retiredEpochWindow + 2 {
+			newer.Retire(fmt.Sprint("gone-", i))
+		}
+
+		nodes[0].MergeWith(newer)
+		for _, c := range nodes {
+			waitForPeersOf(t, []string{"1", "2", "3"}, c, "x")
+			waitForMultiGcounterValueOf(t, int64(retiredEpochWindow+5), c, "x")
+		}
+	})
+
+	t.Run("peers refuse other rounds while a retirement is in flight", func(t *testing.T) {
+		nodes, _ := startCluster(t, "1", "2", "3")
+		defer nodes[0].Stop()
+		defer nodes[1].Stop()
+		// not answering, yet not known to be dead
+		nodes[2].Stop()
+		declareDead(nodes[0], "gone")
+		declareDead(nodes[1], "gone", "other")
+
+		first := make(chan error, 1)
+		go func() {
+			first <- nodes[0].Retire(time.Second, "gone")
+		}()
+		waitFor(t, func() bool { return retirementLeaseOf(nodes[1]) != nil })
+		err := nodes[1].Retire(time.Second, "other")
+		assert.ErrorIs(t, err, ErrRetirementNotAgreed)
+		assert.ErrorContains(t, err, "coordinated by 1 is in flight")
+
+		assert.ErrorContains(t, <-first, "no answer")
+		// released by the coordinator giving up
+		waitFor(t, func() bool { return retirementLeaseOf(nodes[1]) == nil })
+		assert.Nil(t, retirementLeaseOf(nodes[1]))
+	})
+
+	t.Run("a node retired by its peers keeps its last increments and stops", func(t *testing.T) {
+		nodes, addresses := startCluster(t, "1")
+		defer nodes[0].Stop()
+		dir := t.TempDir()
+		start := func() *ZmqMultiGcounter {
+			port := randomPort()
+			c := NewZmqMultiGcounter("2", dir, "tcp://:"+port)
+			c.SetMyIP("127.0.0.1")
+			c.SetMembershipConfig(config)
+			require.NoError(t, c.LoadAllSync())
+			require.NoError(t, c.Start())
+			c.UpdatePeers(addresses)
+			nodes[0].UpdatePeers([]string{zmqAddressOf("127.0.0.1", port)})
+			return c
+		}
+		c := start()
+		c.Increment("x")
+		c.Increment("x")
+		waitForMultiGcounterValueOf(t, 3, nodes[0], "x")
+		c.Stop()
+
+		// counting on while considered dead
+		offline := NewZmqMultiGcounter("2", dir, "tcp://:"+randomPort())
+		require.NoError(t, offline.LoadAllSync())
+		offline.Increment("x")
+		offline.Increment("x")
+		waitForMultiGcounterValueOf(t, 5, offline, "x")
+		offline.PersistSync()
+		waitForMemberStateOf(t, MemberDead, nodes[0], "2")
+		require.NoError(t, nodes[0].Retire(time.Second, "2"))
+		assert.Equal(t, int64(3), nodes[0].Value("x"))
+
+		c = start()
+		defer c.Stop()
+		waitFor(t, func() bool { return c.IdentityRetired() != nil })
+		assert.ErrorIs(t, c.IdentityRetired(), ErrIdentityRetired)
+		assert.ErrorIs(t, c.TryIncrement("x"), ErrIdentityRetired)
+		waitForMultiGcounterValueOf(t, 5, nodes[0], "x")
+		assert.Equal(t, int64(5), c.Value("x"))
+		assert.Empty(t, nodes[0].GetCounter("x").GetState().Peers["2"])
+	})
+
+	t.Run("a node restarted after leaving counts with a new identity", func(t *testing.T) {
+		nodes, addresses := startCluster(t, "1")
+		defer nodes[0].Stop()
+		dir := t.TempDir()
+		start := func() *ZmqMultiGcounter {
+			port := randomPort()
+			c, err := NewZmqMultiGcounterWithStoredIdentity(dir, "tcp://:"+port)
+			require.NoError(t, err)
+			c.SetMyIP("127.0.0.1")
+			c.SetMembershipConfig(config)
+			require.NoError(t, c.LoadAllSync())
+			require.NoError(t, c.Start())
+			c.UpdatePeers(addresses)
+			nodes[0].UpdatePeers([]string{zmqAddressOf("127.0.0.1", port)})
+			waitForPeerProtocolOf(t, c, addresses[0])
+			waitForPeerProtocolOf(t, nodes[0], zmqAddressOf("127.0.0.1", port))
+			return c
+		}
+		c := start()
+		left := c.Identity()
+		c.Increment("x")
+		waitForMultiGcounterValueOf(t, 2, nodes[0], "x")
+		require.NoError(t, c.Leave(2*time.Second))
+		assert.NoFileExists(t, filepath.Join(dir, IdentityFilename))
+
+		// the retired identity cannot count anymore
+		restarted := NewZmqMultiGcounter(left, dir, "tcp://:"+randomPort())
+		require.NoError(t, restarted.LoadAllSync())
+		assert.ErrorIs(t, restarted.Start(), ErrIdentityRetired)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, IdentityFilename), []byte(left), 0644))
+		_, err := NewZmqMultiGcounterWithStoredIdentity(dir, "tcp://:"+randomPort())
+		assert.ErrorIs(t, err, ErrIdentityRetired)
+		require.NoError(t, os.Remove(filepath.Join(dir, IdentityFilename)))
+
+		c = start()
+		defer c.Stop()
+		assert.NotEqual(t, left, c.Identity())
+		c.Increment("x")
+		waitForMultiGcounterValueOf(t, 3, nodes[0], "x")
+		waitForMultiGcounterValueOf(t, 3, c, "x")
+	})
+}
+
+func waitForPeersOf(t *testing.T, expectedPeers []string, c *ZmqMultiGcounter, name string) {
+	peersOf := func() []string {
+		var res []string
+		for peer := range c.GetCounter(name).GetState().Peers {
+			res = append(res, peer)
+		}
+		return res
+	}
+	waitFor(t, func() bool { return len(expectedPeers) == len(peersOf()) })
+	assert.ElementsMatch(t, expectedPeers, peersOf())
+}
+
+// declareDead stands for the gossip of a failure detected elsewhere
+func declareDead(c *ZmqMultiGcounter, identities ...string) {
+	for _, identity := range identities {
+		c.membership.Apply(MemberUpdate{Identity: identity, State: MemberDead})
+	}
+}
+
+func retirementLeaseOf(c *ZmqMultiGcounter) *retirementLease {
+	var res *retirementLease
+	phony.Block(c, func() {
+		res = c.retirementLease
+	})
+	return res
+}
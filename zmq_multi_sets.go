@@ -0,0 +1,48 @@
+package percounter
+
+import (
+	"github.com/Arceliar/phony"
+)
+
+func (z *ZmqMultiGcounter) SetSetObserver(o SetObserver) {
+	phony.Block(z, func() {
+		z.setObserver = o
+	})
+}
+
+func (z *ZmqMultiGcounter) AddToGSet(name, element string) {
+	z.Act(z, func() {
+		set := newPersistentGSetOf(z.getOrCreateReplicaSync(GSetCRDTType, name))
+		set.AddFromActor(z, element)
+	})
+}
+
+func (z *ZmqMultiGcounter) GSetElements(name string) []string {
+	return z.GetGSet(name).Elements()
+}
+
+func (z *ZmqMultiGcounter) GetGSet(name string) *PersistentGSet {
+	return newPersistentGSetOf(z.getReplica(GSetCRDTType, name))
+}
+
+func (z *ZmqMultiGcounter) AddToORSet(name, element string) {
+	z.Act(z, func() {
+		set := newPersistentORSetOf(z.getOrCreateReplicaSync(ORSetCRDTType, name))
+		set.AddFromActor(z, element)
+	})
+}
+
+func (z *ZmqMultiGcounter) RemoveFromORSet(name, element string) {
+	z.Act(z, func() {
+		set := newPersistentORSetOf(z.getOrCreateReplicaSync(ORSetCRDTType, name))
+		set.RemoveFromActor(z, element)
+	})
+}
+
+func (z *ZmqMultiGcounter) ORSetElements(name string) []string {
+	return z.GetORSet(name).Elements()
+}
+
+func (z *ZmqMultiGcounter) GetORSet(name string) *PersistentORSet {
+	return newPersistentORSetOf(z.getReplica(ORSetCRDTType, name))
+}
@@ -0,0 +1,62 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterSets(t *testing.T) {
+	t.Run("exchanging set state changes", func(t *testing.T) {
+		port1 := randomPort()
+		port2 := randomPort()
+		c1 := NewZmqMultiGcounter("1", t.TempDir(), "tcp://:"+port1)
+		defer c1.Stop()
+		assert.NoError(t, c1.Start())
+		c1.AddToGSet(name1, "a")
+		c1.AddToORSet(name2, "x")
+		waitForSetElementsOf(t, []string{"a"}, func() []string { return c1.GSetElements(name1) })
+
+		c2 := NewZmqMultiGcounter("2", t.TempDir(), "tcp://:"+port2)
+		defer c2.Stop()
+		assert.NoError(t, c2.Start())
+
+		// the initial state is sent upon connection
+		c1.UpdatePeers([]string{"tcp://localhost:" + port2})
+		waitForSetElementsOf(t, []string{"a"}, func() []string { return c2.GSetElements(name1) })
+		waitForSetElementsOf(t, []string{"x"}, func() []string { return c2.ORSetElements(name2) })
+
+		// changes are propagated in both directions
+		c2.UpdatePeers([]string{"tcp://localhost:" + port1})
+		c2.AddToGSet(name1, "b")
+		c2.RemoveFromORSet(name2, "x")
+		c2.AddToORSet(name2, "y")
+		waitForSetElementsOf(t, []string{"a", "b"}, func() []string { return c1.GSetElements(name1) })
+		waitForSetElementsOf(t, []string{"y"}, func() []string { return c1.ORSetElements(name2) })
+
+		c1.PersistSync()
+		c2.PersistSync()
+	})
+
+	t.Run("eagerly loading sets", func(t *testing.T) {
+		tempDir := t.TempDir()
+		{
+			c1 := NewZmqMultiGcounter("1", tempDir, "tcp://:"+randomPort())
+			c1.AddToGSet(name1, "a")
+			c1.AddToORSet(name2, "b")
+			waitForSetLenOf(t, 1, func() []string { return c1.ORSetElements(name2) })
+			c1.PersistSync()
+		}
+
+		testObserver := &testSetObserver{}
+		c1 := NewZmqMultiGcounter("1", tempDir, "tcp://:"+randomPort())
+		c1.SetSetObserver(testObserver)
+		assert.NoError(t, c1.LoadAllSync())
+		assert.Len(t, replicasOfType(c1, GSetNetworkMessage), 1)
+		assert.Len(t, replicasOfType(c1, ORSetNetworkMessage), 1)
+		assert.ElementsMatch(t, []SetEvent{
+			{name1, []string{"a"}},
+			{name2, []string{"b"}},
+		}, testObserver.Seen())
+	})
+}
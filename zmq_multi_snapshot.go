@@ -0,0 +1,115 @@
+package percounter
+
+import (
+	"archive/tar"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Arceliar/phony"
+)
+
+// Snapshot writes the states of all replicas as a tar archive of their files while the node is running.
+// Each replica is consistent on its own, the others possibly changing meanwhile: the archive is no point-in-time view
+func (z *ZmqMultiGcounter) Snapshot(w io.Writer) error {
+	var snapshots map[replicaKey]CRDT
+	phony.Block(z, func() {
+		snapshots = make(map[replicaKey]CRDT, len(z.inner))
+		for key, replica := range z.inner {
+			snapshots[key] = replica.Snapshot()
+		}
+	})
+	keys := make([]replicaKey, 0, len(snapshots))
+	for key := range snapshots {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b replicaKey) int {
+		return cmp.Or(cmp.Compare(a.typeTag, b.typeTag), cmp.Compare(a.name, b.name))
+	})
+
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for _, key := range keys {
+		crdtType, ok := LookupCRDTType(key.typeTag)
+		if !ok {
+			return fmt.Errorf("unknown CRDT type '%s'", key.typeTag)
+		}
+		data, err := snapshots[key].Marshal()
+		if err != nil {
+			return fmt.Errorf("%s: %w", key.name, err)
+		}
+		err = tw.WriteHeader(&tar.Header{
+			Name:    key.name + crdtType.Extension,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// Restore merges the replica states of a snapshot into the node and propagates them to the peers.
+// The whole snapshot is read and validated before merging
+func (z *ZmqMultiGcounter) Restore(r io.Reader) error {
+	type restored struct {
+		crdtType CRDTType
+		name     string
+		state    CRDT
+	}
+	replicas := []restored{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		filename := path.Base(header.Name)
+		crdtType, ok := lookupCRDTTypeByExtension(filepath.Ext(filename))
+		if !ok {
+			log.Printf("%s: skipping unknown snapshot entry %s", z.identity, header.Name)
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", header.Name, err)
+		}
+		name := getFilenameWithoutExtension(filename)
+		state := crdtType.New(z.identity, name)
+		if err := state.Unmarshal(data); err != nil {
+			return fmt.Errorf("deserializing %s: %w", header.Name, err)
+		}
+		replicas = append(replicas, restored{crdtType, name, state})
+	}
+
+	merged := []*PersistentCRDT{}
+	phony.Block(z, func() {
+		for _, r := range replicas {
+			replica := z.getOrCreateReplicaSync(r.crdtType, r.name)
+			replica.MergeWith(r.state)
+			merged = append(merged, replica)
+		}
+	})
+	for i, replica := range merged {
+		// waits for the merge to complete
+		z.SetCRDTState(replicas[i].crdtType.Tag, replicas[i].name, replica.Snapshot())
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package percounter
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZmqMultiGcounterSnapshot(t *testing.T) {
+	newNode := func(t *testing.T, identity string) *ZmqMultiGcounter {
+		c := NewZmqMultiGcounter(identity, t.TempDir(), "tcp://:"+randomPort())
+		require.NoError(t, c.Start())
+		t.Cleanup(c.Stop)
+		return c
+	}
+
+	t.Run("a snapshot is an archive of the replica files", func(t *testing.T) {
+		c := newNode(t, "1")
+		c.Increment("x")
+		c.AddToGSet("s", "a")
+		waitForSetElementsOf(t, []string{"a"}, func() []string { return c.GSetElements("s") })
+
+		var archive bytes.Buffer
+		require.NoError(t, c.Snapshot(&archive))
+		assert.Equal(t, []string{"x.gcounter", "s.gset"}, archiveEntriesOf(t, archive.Bytes()))
+	})
+
+	t.Run("snapshots are restored into a fresh node", func(t *testing.T) {
+		c1 := newNode(t, "1")
+		c1.Increment("x")
+		c1.Increment("x")
+		c1.AddToGSet("s", "a")
+		c1.SetRegister("r", "v")
+		waitForRegisterValueOf(t, "v", c1, "r")
+		waitForSetElementsOf(t, []string{"a"}, func() []string { return c1.GSetElements("s") })
+		var archive bytes.Buffer
+		require.NoError(t, c1.Snapshot(&archive))
+
+		c2 := newNode(t, "2")
+		require.NoError(t, c2.Restore(&archive))
+		assert.Equal(t, int64(2), c2.Value("x"))
+		assert.Equal(t, []string{"a"}, c2.GSetElements("s"))
+		assert.Equal(t, "v", c2.RegisterValue("r"))
+	})
+
+	t.Run("snapshots are merged into a live node", func(t *testing.T) {
+		c1 := newNode(t, "1")
+		c1.Increment("x")
+		c1.Increment("x")
+		c1.Increment("x")
+		waitForMultiGcounterValueOf(t, 3, c1, "x")
+		var archive bytes.Buffer
+		require.NoError(t, c1.Snapshot(&archive))
+
+		c2 := newNode(t, "2")
+		c2.Increment("x")
+		c2.Increment("x")
+		waitForMultiGcounterValueOf(t, 2, c2, "x")
+		require.NoError(t, c2.Restore(bytes.NewReader(archive.Bytes())))
+		assert.Equal(t, int64(5), c2.Value("x"))
+
+		// restoring again changes nothing
+		require.NoError(t, c2.Restore(bytes.NewReader(archive.Bytes())))
+		assert.Equal(t, int64(5), c2.Value("x"))
+	})
+
+	t.Run("invalid snapshots are rejected as a whole", func(t *testing.T) {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		writeArchiveEntry(t, tw, "a.gcounter", []byte(`{"name":"a","peers":{"1":1}}`))
+		writeArchiveEntry(t, tw, "b.gcounter", []byte(`not json`))
+		require.NoError(t, tw.Close())
+
+		c := newNode(t, "1")
+		assert.Error(t, c.Restore(&archive))
+		assert.Equal(t, int64(0), c.Value("a"))
+
+		assert.Error(t, c.Restore(bytes.NewReader([]byte("not a tar archive, but long enough to be read as a header block"))))
+	})
+}
+
+func archiveEntriesOf(t *testing.T, archive []byte) []string {
+	res := []string{}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return res
+		}
+		require.NoError(t, err)
+		res = append(res, header.Name)
+	}
+}
+
+func writeArchiveEntry(t *testing.T, tw *tar.Writer, name string, data []byte) {
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}))
+	_, err := tw.Write(data)
+	require.NoError(t, err)
+}
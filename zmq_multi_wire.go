@@ -0,0 +1,114 @@
+package percounter
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/Arceliar/phony"
+)
+
+// EnableBinaryWireFormat should be called before Start, peers not supporting it receive JSON
+func (z *ZmqMultiGcounter) EnableBinaryWireFormat() {
+	phony.Block(z, func() {
+		z.binaryWireFormat = true
+	})
+}
+
+// wireMessage encodes a message lazily, once per format
+type wireMessage struct {
+	state      *NetworkedGCounterState
+	jsonData   []byte
+	binaryData []byte
+}
+
+func (m *wireMessage) json() ([]byte, error) {
+	if m.jsonData == nil {
+		data, err := json.Marshal(m.state)
+		if err != nil {
+			return nil, err
+		}
+		m.jsonData = data
+	}
+	return m.jsonData, nil
+}
+
+func (m *wireMessage) binary() ([]byte, error) {
+	if m.binaryData == nil {
+		data, err := EncodeBinaryState(m.state)
+		if err != nil {
+			return nil, err
+		}
+		m.binaryData = data
+	}
+	return m.binaryData, nil
+}
+
+// broadcastSync encodes the message for each peer as negotiated
+func (z *ZmqMultiGcounter) broadcastSync(state *NetworkedGCounterState) {
+	m := &wireMessage{state: state}
+	if !z.binaryWireFormat && z.compression == nil {
+		data, err := m.json()
+		if err != nil {
+			log.Printf("%s: error serializing %s: %v", z.identity, state.Type, err)
+			return
+		}
+		z.cluster.BroadcastMessage(data)
+		return
+	}
+	for _, peer := range z.peers {
+		z.sendWireMessageSync(peer, m)
+	}
+}
+
+func (z *ZmqMultiGcounter) sendSync(peer string, state *NetworkedGCounterState) {
+	z.sendWireMessageSync(peer, &wireMessage{state: state})
+}
+
+func (z *ZmqMultiGcounter) sendWireMessageSync(peer string, m *wireMessage) {
+	data, err := z.encodeForPeerSync(peer, m)
+	if err != nil {
+		log.Printf("%s: error serializing %s: %v", z.identity, m.state.Type, err)
+		return
+	}
+	z.cluster.SendMessageToPeer(peer, data)
+}
+
+func (z *ZmqMultiGcounter) encodeForPeerSync(peer string, m *wireMessage) ([]byte, error) {
+	var data []byte
+	var err error
+	if z.binaryWireFormat && z.supportsSync(peer, BinaryWireCapability) {
+		data, err = m.binary()
+	} else {
+		data, err = m.json()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if z.shouldCompressSync(data) && z.supportsSync(peer, GzipCapability) {
+		compressed, err := gzipCompress(data, z.compression.config.Level)
+		if err != nil {
+			log.Printf("%s: sending uncompressed, compression failed: %v", z.identity, err)
+			return data, nil
+		}
+		return compressed, nil
+	}
+	return data, nil
+}
+
+// decodeMessage accepts compressed and binary messages regardless of the own configuration
+func decodeMessage(message []byte) (NetworkedGCounterState, error) {
+	payload := message
+	if isCompressed(message) {
+		var err error
+		payload, err = gzipDecompress(message)
+		if err != nil {
+			return NetworkedGCounterState{}, err
+		}
+	}
+	if isBinaryEncoded(payload) {
+		return DecodeBinaryState(payload)
+	}
+	state := NetworkedGCounterState{}
+	err := json.Unmarshal(payload, &state)
+	return state, err
+}
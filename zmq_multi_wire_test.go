@@ -0,0 +1,76 @@
+package percounter
+
+import (
+	"testing"
+
+	"github.com/Arceliar/phony"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZmqMultiGcounterBinaryWireFormat(t *testing.T) {
+	t.Run("binary to peers supporting it, JSON to the others", func(t *testing.T) {
+		newNode := func(identity, port string, binary bool) (*ZmqMultiGcounter, *testClusterObserver) {
+			c := NewZmqMultiGcounter(identity, t.TempDir(), "tcp://:"+port)
+			c.SetMyIP("127.0.0.1")
+			if binary {
+				c.EnableBinaryWireFormat()
+			}
+			observer := newTestClusterObserver()
+			c.SetClusterObserver(observer)
+			assert.NoError(t, c.Start())
+			return c, observer
+		}
+		port1 := randomPort()
+		port2 := randomPort()
+		port3 := randomPort()
+		c1, _ := newNode("1", port1, true)
+		defer c1.Stop()
+		c2, observer2 := newNode("2", port2, true)
+		defer c2.Stop()
+		c3, observer3 := newNode("3", port3, false)
+		defer c3.Stop()
+		c1.UpdatePeers([]string{zmqAddressOf("127.0.0.1", port2), zmqAddressOf("127.0.0.1", port3)})
+		waitForWireFormatOf(t, true, c1, zmqAddressOf("127.0.0.1", port2))
+		waitForWireFormatOf(t, false, c1, zmqAddressOf("127.0.0.1", port3))
+
+		c1.Increment("x")
+		c1.AddToORSet("s", "a")
+		waitForMultiGcounterValueOf(t, 1, c2, "x")
+		waitForMultiGcounterValueOf(t, 1, c3, "x")
+		waitForSetElementsOf(t, []string{"a"}, func() []string { return c2.ORSetElements("s") })
+		waitForSetElementsOf(t, []string{"a"}, func() []string { return c3.ORSetElements("s") })
+
+		assert.NotEmpty(t, binaryMessagesOf(observer2))
+		assert.Empty(t, binaryMessagesOf(observer3))
+	})
+}
+
+func binaryMessagesOf(o *testClusterObserver) []testMessageEvent {
+	res := []testMessageEvent{}
+	for _, m := range o.MessagesReceived() {
+		if isBinaryEncoded([]byte(m.msg)) {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func supportsBinaryWireFormat(c *ZmqMultiGcounter, peer string) (bool, bool) {
+	var supported, known bool
+	phony.Block(c, func() {
+		var protocol PeerProtocol
+		protocol, known = c.peerProtocols[peer]
+		supported = protocol.Supports(BinaryWireCapability)
+	})
+	return supported, known
+}
+
+func waitForWireFormatOf(t *testing.T, expectedBinary bool, c *ZmqMultiGcounter, peer string) {
+	waitFor(t, func() bool {
+		supported, known := supportsBinaryWireFormat(c, peer)
+		return known && supported == expectedBinary
+	})
+	supported, known := supportsBinaryWireFormat(c, peer)
+	assert.True(t, known)
+	assert.Equal(t, expectedBinary, supported)
+}